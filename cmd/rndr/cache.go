@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/oklog/run"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func registerCache(cmd *kingpin.Application, g *run.Group, future func() log.Logger) {
+	c := cmd.Command("cache", "Manage rndr cache in user cache directory (e.g $XDG_CACHE_HOME/rndr).")
+
+	p := c.Command("prune", "Remove resources cached by 'rndr output --cache'.")
+	olderThan := p.Flag("older-than", "Remove only resources not used for given duration e.g '168h'. All are removed if zero.").Default("0s").Duration()
+	p.Action(func(_ *kingpin.ParseContext) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger := future()
+
+			cacheDir, err := rndr.DefaultCacheDir()
+			if err != nil {
+				return err
+			}
+			removed, err := rndr.PruneRenderCache(ctx, cacheDir, *olderThan)
+			if err != nil {
+				return err
+			}
+			level.Info(logger).Log("msg", "pruned render cache", "dir", cacheDir, "removed", removed)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/observatorium/rndr/pkg/rndr/crd"
+	"github.com/oklog/run"
+	"gopkg.in/alecthomas/kingpin.v2"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+func registerCRD(cmd *kingpin.Application, g *run.Group, future func() log.Logger) {
+	c := cmd.Command("crd", "Generate Kubernetes Custom Resource Definition with template values as the resource spec.")
+	spec := c.Flag("spec", "Path to the YAML file with spec defined in github.com/observatorium/rndr/pkg/rndr.Spec").
+		Short('s').Required().ExistingFile()
+	output := c.Flag("output", "Path to the output YAML file. If empty, CRD is printed to stdout.").Short('o').String()
+	group := c.Flag("group", "API group of the resource.").Default(crd.DefaultGroup).String()
+	kind := c.Flag("kind", "Kind of the resource. Defaults to upper camel case spec name.").String()
+	plural := c.Flag("plural", "Plural name of the resource. Defaults to plural of lower case kind.").String()
+	versions := c.Flag("api-version", "Served API version of the resource. Can be repeated, the last one is the storage version.").
+		Default(crd.DefaultVersion).Strings()
+	clusterScoped := c.Flag("cluster-scoped", "Make resources cluster scoped instead of namespaced.").Bool()
+
+	c.Action(func(_ *kingpin.ParseContext) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger := future()
+
+			s, err := readSpec(ctx, logger, *spec)
+			if err != nil {
+				return err
+			}
+
+			namespaced := !*clusterScoped
+			d, err := rndr.GenerateCRD(ctx, logger, s.Name, s.Template.API, crd.Options{
+				Group:      *group,
+				Kind:       *kind,
+				Plural:     *plural,
+				Versions:   *versions,
+				Namespaced: &namespaced,
+			})
+			if err != nil {
+				return err
+			}
+			b, err := k8syaml.Marshal(d)
+			if err != nil {
+				return err
+			}
+
+			if *output == "" {
+				_, err = os.Stdout.Write(b)
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(*output), os.ModePerm); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(*output, b, os.ModePerm)
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
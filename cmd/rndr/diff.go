@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/efficientgo/tools/core/pkg/errcapture"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/kingpinv2"
+	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/observatorium/rndr/pkg/rndr/diff"
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func registerDiff(cmd *kingpin.Application, g *run.Group, future func() log.Logger) {
+	d := cmd.Command("diff", "Render template in memory and compare resources with the ones in given directory or stream object by object. "+
+		"Objects are matched by apiVersion, kind, namespace and name, so file layout, key ordering and formatting are ignored. Exits with error on drift.")
+	spec := d.Flag("spec", "Path to the YAML file with spec defined in github.com/observatorium/rndr/pkg/rndr.Spec").
+		Short('s').Required().ExistingFile()
+	against := d.Flag("against", "Directory with rendered resources (YAML and JSON files, recursively) or multi-document YAML or JSON stream file to compare with. '-' for stdin.").
+		Short('a').Required().String()
+	values := kingpinv2.Flag(d, "values", "Values YAML as defined in passed --template api.").PathsOrContent()
+	env := d.Flag("environment", "Name of the spec environment to render instead of rendering given values.").Short('e').String()
+	format := d.Flag("format", "Format of the drift report written to stdout. 'unified' is a unified diff of each drifted object, 'json' is a JSON report.").
+		Default(string(diff.Unified)).Enum(string(diff.Unified), string(diff.JSON))
+
+	d.Action(func(_ *kingpin.ParseContext) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger := future()
+
+			s, err := readSpec(ctx, logger, *spec)
+			if err != nil {
+				return err
+			}
+
+			layers, err := values.Contents()
+			if err != nil {
+				return err
+			}
+			var vYAML []byte
+			switch {
+			case *env != "" && len(layers) > 0:
+				return errors.New("values flags can't be used together with environment")
+			case *env != "":
+				e, ok := s.Environments[*env]
+				if !ok {
+					return errors.Errorf("environment with name %q was specified in flag but not present in spec.", *env)
+				}
+				vYAML, err = rndr.ReadValues(e.Values...)
+			case len(layers) == 0:
+				return errors.New("flag values-file, values or environment is required for running this command.")
+			default:
+				vYAML, err = rndr.MergeValueLayers(layers...)
+			}
+			if err != nil {
+				return err
+			}
+
+			groups, err := rndr.Render(ctx, logger, s.Name, *s.Template, vYAML)
+			if err != nil {
+				return err
+			}
+			rendered, err := diff.FromGroups(groups)
+			if err != nil {
+				return err
+			}
+			found, err := readObjects(*against)
+			if err != nil {
+				return err
+			}
+
+			report, err := diff.Compare(rendered, found)
+			if err != nil {
+				return err
+			}
+			if err := report.Write(os.Stdout, diff.Format(*format)); err != nil {
+				return err
+			}
+			if report.Drift() {
+				return errors.Errorf("%d objects drifted from %v", len(report.Changes), *against)
+			}
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
+
+func readObjects(path string) (_ diff.Objects, err error) {
+	if path == "-" {
+		return diff.Read(os.Stdin, "stdin")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return diff.ReadDir(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer errcapture.Do(&err, f.Close, "close stream file")
+	return diff.Read(f, path)
+}
@@ -57,8 +57,13 @@ func main() {
 
 	var logger log.Logger
 	var g run.Group
-	registerOutput(app, &g, func() log.Logger { return logger })
+	watching := registerOutput(app, &g, func() log.Logger { return logger })
 	registerPackage(app, &g, func() log.Logger { return logger })
+	registerSpec(app, &g, func() log.Logger { return logger })
+	registerCRD(app, &g, func() log.Logger { return logger })
+	registerDiff(app, &g, func() log.Logger { return logger })
+	registerTest(app, &g, func() log.Logger { return logger })
+	registerCache(app, &g, func() log.Logger { return logger })
 
 	cmd, err := app.Parse(os.Args[1:])
 	if err != nil {
@@ -69,6 +74,11 @@ func main() {
 
 	g.Add(run.SignalHandler(context.Background(), syscall.SIGINT, syscall.SIGTERM))
 	if err := g.Run(); err != nil {
+		if _, ok := err.(run.SignalError); ok && cmd == "output" && *watching {
+			// Watch mode runs until interrupted, so it's a clean exit.
+			level.Info(logger).Log("msg", "exiting", "reason", err)
+			return
+		}
 		if *logLevel == "debug" {
 			// Use %+v for github.com/pkg/errors error to print with stack.
 			level.Error(logger).Log("err", fmt.Sprintf("%+v", errors.Wrapf(err, "%s command failed", cmd)))
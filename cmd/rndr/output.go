@@ -2,55 +2,288 @@ package main
 
 import (
 	"context"
-	"io/ioutil"
-	"path/filepath"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/observatorium/rndr/pkg/kingpinv2"
 	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/observatorium/rndr/pkg/rndr/diff"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	rndrwatch "github.com/observatorium/rndr/pkg/rndr/watch"
 	"github.com/oklog/run"
 	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-func registerOutput(cmd *kingpin.Application, g *run.Group, future func() log.Logger) {
-	o := cmd.Command("output", "Render output defined in spec given values.")
+// registerOutput registers output command. It returns watch flag, since interrupt is the only way to stop watching.
+func registerOutput(cmd *kingpin.Application, g *run.Group, future func() log.Logger) (watching *bool) {
+	o := cmd.Command("output", "Render output defined in spec given values. Multiple values files are deep-merged in order, so later ones override earlier ones.")
 	spec := o.Flag("spec", "Path to the YAML file with spec defined in github.com/observatorium/rndr/pkg/rndr.Spec").
 		Short('s').Required().ExistingFile()
-	outDir := o.Flag("output", "Output directory").Short('o').Default(".gen").ExistingDir()
-	values := kingpinv2.Flag(o, "values", "Values YAML as defined in passed --template api").Required().PathOrContent()
+	outDir := o.Flag("output", "Output directory. If '-' (given as --output=-, since -o - is parsed as a flag), resources are written to stdout in --format ordered by group name.").Short('o').Default(".gen").String()
+	toStdout := o.Flag("stdout", "Write resources to stdout instead of output directory. Same as --output=-.").Bool()
+	format := o.Flag("format", "Format of resources written to stdout. 'yaml' is a multi-document YAML stream, 'json' is a JSON v1 List.").
+		Default(string(rndr.YAMLStream)).Enum(string(rndr.YAMLStream), string(rndr.JSONList))
+	values := kingpinv2.Flag(o, "values", "Values YAML as defined in passed --template api.").PathsOrContent()
+	envs := o.Flag("environment", "Name of the spec environment to render into its output directory instead of rendering given values. Can be repeated.").
+		Short('e').Strings()
+	allEnvs := o.Flag("all-environments", "Render all spec environments into their output directories instead of rendering given values.").Bool()
+	layout := o.Flag("layout", "Layout of output files. 'group' writes <group>/<index>-<item>.yaml files, 'kind' writes [<namespace>-]<kind>-<name>.yaml files, "+
+		"'stream' writes single multi-document resources.yaml file and 'pattern' writes files with paths from --layout-pattern.").
+		Default(string(rndr.GroupLayout)).Enum(layouts()...)
+	pattern := o.Flag("layout-pattern", "Go template of the output file path for 'pattern' layout e.g '{{ .Namespace }}/{{ .Kind | lower }}-{{ .Name }}.yaml'. "+
+		"Available fields: APIVersion, Kind, Namespace, Name, Group, Item, Index and function: lower. Resources with the same path are written into the same file.").String()
+	fileMode := o.Flag("file-mode", "Octal mode of output files.").Default("0644").String()
+	clean := o.Flag("clean", "Remove files written into output directory by the previous run that were not written this time (e.g before resources were renamed). Files are tracked in "+rndr.ManifestFile+" file in output directory.").Bool()
+
+	watch := o.Flag("watch", "Keep running and render again whenever spec, values files or template sources (e.g jsonnet function files "+
+		"and their imports or API files) change, until interrupted. Changed objects are logged.").Bool()
+	cache := o.Flag("cache", "Cache rendered resources in rndr directory within user cache directory (e.g $XDG_CACHE_HOME/rndr), keyed by "+
+		"hash of the spec template, its sources (e.g jsonnet function files and their imports), values and rndr version. "+
+		"Cached resources are used without invoking the renderer until any of those changes. See 'rndr cache prune'.").Bool()
+	debounce := o.Flag("watch-debounce", "Time to wait for more changes before rendering again in watch mode.").Default("300ms").Duration()
 
 	o.Action(func(_ *kingpin.ParseContext) error {
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			logger := future()
 
-			specFile, err := filepath.Abs(*spec)
+			mode, err := strconv.ParseUint(*fileMode, 8, 32)
 			if err != nil {
-				return errors.Wrap(err, "abs")
+				return errors.Wrapf(err, "parse file mode %v", *fileMode)
 			}
-			bSpec, err := ioutil.ReadFile(specFile)
-			if err != nil {
-				return errors.Wrap(err, "read spec file")
+			if rndr.Layout(*layout) == rndr.PatternLayout && *pattern == "" {
+				return errors.New("layout-pattern flag is required for pattern layout")
 			}
-			s, err := rndr.ParseSpec(bSpec, filepath.Dir(specFile))
-			if err != nil {
-				return err
+			outOpts := rndr.OutputOptions{Layout: rndr.Layout(*layout), Pattern: *pattern, FileMode: os.FileMode(mode), Clean: *clean}
+
+			stdout := *toStdout || *outDir == "-"
+			if stdout && *clean {
+				return errors.New("clean flag can't be used when writing to stdout")
+			}
+			if stdout && *watch {
+				return errors.New("watch flag can't be used when writing to stdout")
+			}
+			if info, err := os.Stat(*outDir); !stdout && (err != nil || !info.IsDir()) {
+				return errors.Errorf("output directory %q does not exist", *outDir)
+			}
+			if *allEnvs && len(*envs) > 0 {
+				return errors.New("both environment and all-environments flags set")
 			}
 
-			if s.Template == nil {
-				return errors.New("template is not specified. Ref or empty template is not yet supported")
+			// Spec is read again on every render in watch mode, so the last successfully read one is kept to know
+			// which files to watch.
+			var lastSpec *rndr.Spec
+			render := func(ctx context.Context) (map[string]rndrapi.Groups, error) {
+				s, err := readSpec(ctx, logger, *spec)
+				if err != nil {
+					return nil, err
+				}
+				lastSpec = &s
+
+				layers, err := values.Contents()
+				if err != nil {
+					return nil, err
+				}
+
+				newRenderFn := func() (rndrapi.RenderFunc, error) {
+					if !*cache {
+						return rndr.NewRenderFunc(ctx, logger, s.Name, *s.Template)
+					}
+					cacheDir, err := rndr.DefaultCacheDir()
+					if err != nil {
+						return nil, err
+					}
+					return rndr.NewCachedRenderFunc(ctx, logger, s.Name, *s.Template, cacheDir)
+				}
+
+				if *allEnvs || len(*envs) > 0 {
+					if stdout {
+						return nil, errors.New("environments can't be written to stdout; use --values-file to render single environment")
+					}
+					if len(layers) > 0 {
+						return nil, errors.New("values flags can't be used together with environments; add values to spec environments instead")
+					}
+					chosen, err := chosenEnvironments(s, *envs, *allEnvs)
+					if err != nil {
+						return nil, err
+					}
+					renderFn, err := newRenderFn()
+					if err != nil {
+						return nil, err
+					}
+					return rndr.RenderEnvironments(ctx, logger, rndr.EnvironmentsOptions{
+						Render:       renderFn,
+						Environments: chosen,
+						OutputDir:    *outDir,
+						Output:       outOpts,
+					})
+				}
+
+				if len(layers) == 0 {
+					return nil, errors.New("flag values-file or values is required for running this command without environments and content cannot be empty.")
+				}
+				vYAML, err := rndr.MergeValueLayers(layers...)
+				if err != nil {
+					return nil, err
+				}
+				renderFn, err := newRenderFn()
+				if err != nil {
+					return nil, err
+				}
+				groups, err := renderFn(ctx, vYAML)
+				if err != nil {
+					return nil, err
+				}
+				if stdout {
+					return nil, rndr.WriteStream(os.Stdout, groups, rndr.StreamFormat(*format))
+				}
+				return map[string]rndrapi.Groups{"": groups}, rndr.WriteOutput(groups, *outDir, outOpts)
 			}
 
-			vYAML, err := values.Content()
+			if !*watch {
+				_, err := render(ctx)
+				return err
+			}
+
+			valuesFiles, err := values.Paths()
 			if err != nil {
 				return err
 			}
+			for _, f := range valuesFiles {
+				if f == "-" {
+					return errors.New("values can't be read from stdin in watch mode")
+				}
+			}
+			rendered, err := render(ctx)
+			if err != nil {
+				level.Error(logger).Log("msg", "render failed; waiting for changes", "err", err)
+			}
+			files := func() ([]string, error) {
+				ret := append([]string{*spec}, valuesFiles...)
+				if lastSpec == nil {
+					return ret, nil
+				}
+				if *allEnvs || len(*envs) > 0 {
+					// Environments could be renamed in the meantime, so watch values of all of them.
+					for _, e := range lastSpec.Environments {
+						ret = append(ret, e.Values...)
+					}
+				}
+				sources, err := rndr.Sources(*lastSpec.Template)
+				if err != nil {
+					return nil, err
+				}
+				return append(ret, sources...), nil
+			}
 
-			return rndr.RenderTemplate(ctx, logger, s.Name, *s.Template, vYAML, *outDir)
+			level.Info(logger).Log("msg", "watching for changes; interrupt to stop")
+			return rndrwatch.Watch(ctx, logger, *debounce, files, func(ctx context.Context) {
+				next, err := render(ctx)
+				if err != nil {
+					level.Error(logger).Log("msg", "render failed; waiting for changes", "err", err)
+					return
+				}
+				if err := logChanges(logger, rendered, next); err != nil {
+					level.Warn(logger).Log("msg", "failed to compare rendered objects", "err", err)
+				}
+				rendered = next
+			})
 		}, func(err error) {
 			cancel()
 		})
 		return nil
 	})
+	return watch
+}
+
+func chosenEnvironments(s rndr.Spec, names []string, all bool) (map[string]rndr.Environment, error) {
+	chosen := s.Environments
+	if !all {
+		chosen = make(map[string]rndr.Environment, len(names))
+		for _, e := range names {
+			env, ok := s.Environments[e]
+			if !ok {
+				return nil, errors.Errorf("environment with name %q was specified in flag but not present in spec.", e)
+			}
+			chosen[e] = env
+		}
+	}
+	if len(chosen) == 0 {
+		return nil, errors.New("no environments in spec")
+	}
+	return chosen, nil
+}
+
+// maxLoggedChanges limits number of objects listed in the changes log line.
+const maxLoggedChanges = 10
+
+// logChanges logs a summary of objects that changed between renders of each environment. Values render is under empty
+// environment name.
+func logChanges(logger log.Logger, prev, next map[string]rndrapi.Groups) error {
+	names := make([]string, 0, len(next))
+	for n := range next {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		before, err := diff.FromGroups(prev[n])
+		if err != nil {
+			return err
+		}
+		after, err := diff.FromGroups(next[n])
+		if err != nil {
+			return err
+		}
+		report, err := diff.Compare(after, before)
+		if err != nil {
+			return err
+		}
+
+		var added, removed, changed int
+		objects := make([]string, 0, maxLoggedChanges)
+		for _, c := range report.Changes {
+			prefix := "~"
+			switch c.Type {
+			case diff.Missing:
+				added++
+				prefix = "+"
+			case diff.Stale:
+				removed++
+				prefix = "-"
+			default:
+				changed++
+			}
+			if len(objects) < maxLoggedChanges {
+				objects = append(objects, prefix+c.ID.String())
+			}
+		}
+		if len(report.Changes) > maxLoggedChanges {
+			objects = append(objects, fmt.Sprintf("and %d more", len(report.Changes)-maxLoggedChanges))
+		}
+
+		keyvals := []interface{}{"msg", "rendered", "added", added, "removed", removed, "changed", changed}
+		if n != "" {
+			keyvals = append(keyvals, "environment", n)
+		}
+		if len(objects) > 0 {
+			keyvals = append(keyvals, "objects", strings.Join(objects, ", "))
+		}
+		level.Info(logger).Log(keyvals...)
+	}
+	return nil
+}
+
+func layouts() []string {
+	var ret []string
+	for _, l := range rndr.Layouts() {
+		ret = append(ret, string(l))
+	}
+	return ret
 }
@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	"io/ioutil"
-	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/observatorium/rndr/pkg/rndr"
@@ -18,22 +19,16 @@ func registerPackage(cmd *kingpin.Application, g *run.Group, future func() log.L
 		Short('s').Required().ExistingFile()
 	overrOutDir := p.Flag("output", "Optional override directory for output. Works only when single output was chosen").
 		Short('o').String()
-	pkgs := p.Arg("name", "List or single package name from provided spec. If empty all package will be rendered in random order.").Strings()
+	pkgs := p.Arg("name", "List or single package name from provided spec. If empty all packages will be rendered. "+
+		"Packages are rendered concurrently, each after packages from its dependsOn that were chosen too.").Strings()
+	parallelism := p.Flag("parallelism", "Maximum number of packages rendered at once.").Default(strconv.Itoa(runtime.NumCPU())).Int()
 
 	p.Action(func(_ *kingpin.ParseContext) error {
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			logger := future()
 
-			specFile, err := filepath.Abs(*spec)
-			if err != nil {
-				return errors.Wrap(err, "abs")
-			}
-			bSpec, err := ioutil.ReadFile(specFile)
-			if err != nil {
-				return errors.Wrap(err, "read spec file")
-			}
-			s, err := rndr.ParseSpec(bSpec, filepath.Dir(specFile))
+			s, err := readSpec(ctx, logger, *spec)
 			if err != nil {
 				return err
 			}
@@ -58,11 +53,26 @@ func registerPackage(cmd *kingpin.Application, g *run.Group, future func() log.L
 				}
 			}
 
-			for p, pkg := range chosen {
-				if err := rndr.RenderPackage(ctx, logger, s.Name, s.Authors, pkg, overrOutDir); err != nil {
-					return errors.Wrapf(err, "render %v", p)
+			if *overrOutDir != "" {
+				for p, pkg := range chosen {
+					pkg.OutputDir = *overrOutDir
+					chosen[p] = pkg
+				}
+			}
+
+			results, err := rndr.RenderPackages(ctx, logger, s.Name, s.Authors, *s.Template, chosen, *parallelism)
+			if err != nil {
+				return err
+			}
+			var failed []string
+			for _, r := range results {
+				if r.Err != nil {
+					failed = append(failed, r.Name)
 				}
 			}
+			if len(failed) > 0 {
+				return errors.Errorf("%d of %d packages failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+			}
 			return nil
 		}, func(err error) {
 			cancel()
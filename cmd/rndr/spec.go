@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// readSpec reads and parses spec file. It warns if spec uses older format version. Template references are resolved
+// using the lock file next to the spec. Lock file is written only if some references were not pinned yet.
+func readSpec(ctx context.Context, logger log.Logger, file string) (rndr.Spec, error) {
+	specFile, err := filepath.Abs(file)
+	if err != nil {
+		return rndr.Spec{}, errors.Wrap(err, "abs")
+	}
+	b, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return rndr.Spec{}, errors.Wrap(err, "read spec file")
+	}
+	s, err := rndr.ParseSpec(b, filepath.Dir(specFile))
+	if err != nil {
+		return rndr.Spec{}, errors.Wrapf(err, "parse spec file %v", file)
+	}
+	if v, _ := rndr.SpecAPIVersion(b); v != rndr.CurrentSpecVersion() {
+		level.Warn(logger).Log("msg", "spec uses older format version; run 'rndr spec migrate' to update it", "file", file, "apiVersion", v, "current", rndr.CurrentSpecVersion())
+	}
+	if s.TemplateRef == nil {
+		return s, nil
+	}
+
+	lock, err := rndr.ReadLock(rndr.LockFile(specFile))
+	if err != nil {
+		return rndr.Spec{}, err
+	}
+	locked := make(map[string]string, len(lock.Digests))
+	for r, d := range lock.Digests {
+		locked[r] = d
+	}
+	if err := resolveTemplate(ctx, logger, &s, lock); err != nil {
+		return rndr.Spec{}, err
+	}
+	// Lock file is only written when new references were pinned; use 'rndr spec lock' to update pinned ones.
+	if reflect.DeepEqual(locked, lock.Digests) {
+		return s, nil
+	}
+	if err := rndr.WriteLock(rndr.LockFile(specFile), lock); err != nil {
+		return rndr.Spec{}, errors.Wrap(err, "write lock file")
+	}
+	level.Info(logger).Log("msg", "pinned new template references", "lock", rndr.LockFile(specFile), "pinned", len(lock.Digests)-len(locked))
+	return s, nil
+}
+
+func resolveTemplate(ctx context.Context, logger log.Logger, s *rndr.Spec, lock *rndr.Lock) error {
+	cacheDir, err := rndr.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	t, err := rndr.ResolveTemplate(ctx, logger, *s, cacheDir, lock)
+	if err != nil {
+		return err
+	}
+	s.Template = &t
+	return nil
+}
+
+func registerSpec(cmd *kingpin.Application, g *run.Group, future func() log.Logger) {
+	s := cmd.Command("spec", "Manage spec files.")
+
+	m := s.Command("migrate", "Rewrite spec files in older format versions to the current version. Comments are kept.")
+	files := m.Arg("files", "Spec files to migrate.").Required().ExistingFiles()
+	dryRun := m.Flag("dry-run", "Print migrated specs to stdout instead of rewriting files.").Bool()
+	m.Action(func(_ *kingpin.ParseContext) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger := future()
+
+			for _, f := range *files {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				b, err := ioutil.ReadFile(f)
+				if err != nil {
+					return err
+				}
+				v, err := rndr.SpecAPIVersion(b)
+				if err != nil {
+					return errors.Wrapf(err, "migrate %v", f)
+				}
+				migrated := b
+				if v != rndr.CurrentSpecVersion() {
+					if migrated, err = rndr.MigrateSpec(b); err != nil {
+						return errors.Wrapf(err, "migrate %v", f)
+					}
+				}
+				if *dryRun {
+					if _, err := os.Stdout.Write(migrated); err != nil {
+						return err
+					}
+					continue
+				}
+				if v == rndr.CurrentSpecVersion() {
+					level.Info(logger).Log("msg", "spec is up to date", "file", f)
+					continue
+				}
+				if err := ioutil.WriteFile(f, migrated, os.ModePerm); err != nil {
+					return err
+				}
+				level.Info(logger).Log("msg", "migrated spec", "file", f, "from", v, "to", rndr.CurrentSpecVersion())
+			}
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+
+	l := s.Command("lock", "Resolve template references of spec files again and pin them in lock files next to specs.")
+	lockFiles := l.Arg("files", "Spec files to lock.").Required().ExistingFiles()
+	l.Action(func(_ *kingpin.ParseContext) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger := future()
+
+			for _, f := range *lockFiles {
+				specFile, err := filepath.Abs(f)
+				if err != nil {
+					return errors.Wrap(err, "abs")
+				}
+				b, err := ioutil.ReadFile(specFile)
+				if err != nil {
+					return err
+				}
+				s, err := rndr.ParseSpec(b, filepath.Dir(specFile))
+				if err != nil {
+					return errors.Wrapf(err, "parse spec file %v", f)
+				}
+				if s.TemplateRef == nil {
+					level.Info(logger).Log("msg", "spec has no template reference, nothing to lock", "file", f)
+					continue
+				}
+
+				lock := &rndr.Lock{}
+				if err := resolveTemplate(ctx, logger, &s, lock); err != nil {
+					return errors.Wrapf(err, "lock %v", f)
+				}
+				if err := rndr.WriteLock(rndr.LockFile(specFile), lock); err != nil {
+					return errors.Wrap(err, "write lock file")
+				}
+				level.Info(logger).Log("msg", "locked template references", "file", f, "lock", rndr.LockFile(specFile), "pinned", len(lock.Digests))
+			}
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/observatorium/rndr/pkg/rndr/rndrtest"
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func registerTest(cmd *kingpin.Application, g *run.Group, future func() log.Logger) {
+	t := cmd.Command("test", "Render each <name>.values.yaml test case and compare resources with <name>.golden directory object by object. "+
+		"Optional <name>.assert.yaml file adds assertions e.g expected objects or rendering error. See github.com/observatorium/rndr/pkg/rndr/rndrtest.")
+	spec := t.Flag("spec", "Path to the YAML file with spec defined in github.com/observatorium/rndr/pkg/rndr.Spec").
+		Short('s').Required().ExistingFile()
+	dir := t.Flag("dir", "Directory with test cases. Defaults to the spec directory.").Short('d').ExistingDir()
+	update := t.Flag("update", "Regenerate golden directories instead of comparing with them.").Bool()
+
+	t.Action(func(_ *kingpin.ParseContext) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger := future()
+
+			s, err := readSpec(ctx, logger, *spec)
+			if err != nil {
+				return err
+			}
+			if *dir == "" {
+				*dir = filepath.Dir(*spec)
+			}
+			cases, err := rndrtest.Discover(*dir)
+			if err != nil {
+				return err
+			}
+			if len(cases) == 0 {
+				return errors.Errorf("no test cases found in %v", *dir)
+			}
+
+			render, err := rndr.NewRenderFunc(ctx, logger, s.Name, *s.Template)
+			if err != nil {
+				return err
+			}
+			failed := 0
+			for _, r := range rndrtest.Run(ctx, render, cases, *update) {
+				if r.Err != nil {
+					failed++
+					level.Error(logger).Log("msg", "test case failed", "case", r.Case.Name, "err", r.Err)
+					continue
+				}
+				level.Info(logger).Log("msg", "test case passed", "case", r.Case.Name, "updated", *update)
+			}
+			if failed > 0 {
+				return errors.Errorf("%d of %d test cases failed", failed, len(cases))
+			}
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
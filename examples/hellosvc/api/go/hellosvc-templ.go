@@ -15,9 +15,9 @@ func Default() HelloService {
 		Message:   "hello",
 	}
 
+	// NOTE: `app.kubernetes.io/instance` label is added by template, since it depends on the name.
 	h.PodLabelSelector = map[string]string{
 		"app.kubernetes.io/name":      "hellosvc",
-		"app.kubernetes.io/instance":  h.Name,
 		"app.kubernetes.io/component": "demo",
 	}
 	h.CommonLabels = map[string]string{
@@ -30,21 +30,24 @@ func Default() HelloService {
 	return h
 }
 
+// HelloService configures example hello service deployment.
 type HelloService struct {
 	Name      string
 	Namespace string
 	Version   string
 	Replicas  int
+	// Resources are Kubernetes container resource requirements.
 	Resources corev1.ResourceRequirements
 	Ports     Ports
+
 	// TODO(bwplotka): With Go we could play in having '+' prefix telling to add values only. Experiment with this.
+
+	// NOTE: `app.kubernetes.io/instance` label is added by template, since it depends on the name.
 	CommonLabels     map[string]string
 	PodLabelSelector map[string]string
 
 	Message string
 
-	// Extra allows to provide raw bytes in renderer specific language allowing adhoc adjustments right before resources generation
-	// allowing quick adjustments. Use on your own responsibility.
 	// Extra allows to provide raw bytes in renderer specific language allowing adhoc
 	// adjustments right before resources generation allowing quick adjustments.
 	// Use on your own responsibility.
@@ -0,0 +1,137 @@
+// Code generated by rndr. DO NOT EDIT.
+// helloservice library. Values are merged into defaults from values.libsonnet.
+local defaults = import 'values.libsonnet';
+
+function(values={}) (
+  local v = std.mergePatch(defaults, values);
+  {
+    deployment: {
+      "apiVersion": "apps/v1",
+      "kind": "Deployment",
+      "metadata": {
+        "labels": {
+          "app.kubernetes.io/component": "demo",
+          "app.kubernetes.io/instance": v.name,
+          "app.kubernetes.io/name": "hellosvc",
+          "app.kubernetes.io/version": "1.8"
+        },
+        "name": v.name,
+        "namespace": v.namespace
+      },
+      "spec": {
+        "replicas": v.replicas,
+        "selector": {
+          "matchLabels": {
+            "app.kubernetes.io/component": "demo",
+            "app.kubernetes.io/instance": v.name,
+            "app.kubernetes.io/name": "hellosvc"
+          }
+        },
+        "template": {
+          "metadata": {
+            "labels": {
+              "app.kubernetes.io/component": "demo",
+              "app.kubernetes.io/instance": v.name,
+              "app.kubernetes.io/name": "hellosvc",
+              "app.kubernetes.io/version": "1.8"
+            }
+          },
+          "spec": {
+            "affinity": {
+              "podAntiAffinity": {
+                "preferredDuringSchedulingIgnoredDuringExecution": [
+                  {
+                    "podAffinityTerm": {
+                      "labelSelector": {
+                        "matchExpressions": [
+                          {
+                            "key": "app.kubernetes.io/name",
+                            "operator": "In",
+                            "values": [
+                              "hellosvc"
+                            ]
+                          }
+                        ]
+                      },
+                      "namespaces": [
+                        v.namespace
+                      ],
+                      "topologyKey": "kubernetes.io/hostname"
+                    },
+                    "weight": 100
+                  }
+                ]
+              }
+            },
+            "containers": [
+              {
+                "image": "paulbouwer/hello-kubernetes:1.8",
+                "livenessProbe": {
+                  "failureThreshold": 4,
+                  "httpGet": {
+                    "path": "/-/healthy",
+                    "port": 80,
+                    "scheme": "HTTP"
+                  },
+                  "periodSeconds": 30
+                },
+                "name": v.name,
+                "ports": [
+                  {
+                    "containerPort": 80,
+                    "name": "http"
+                  }
+                ],
+                "readinessProbe": {
+                  "failureThreshold": 20,
+                  "httpGet": {
+                    "path": "/-/ready",
+                    "port": 80,
+                    "scheme": "HTTP"
+                  },
+                  "periodSeconds": 5
+                },
+                "resources": {
+                  "limits": {
+                    "memory": "200m"
+                  }
+                },
+                "terminationMessagePolicy": "FallbackToLogsOnError"
+              }
+            ],
+            "terminationGracePeriodSeconds": 1
+          }
+        }
+      }
+    },
+    service: {
+      "apiVersion": "v1",
+      "kind": "Service",
+      "metadata": {
+        "labels": {
+          "app.kubernetes.io/component": "demo",
+          "app.kubernetes.io/instance": v.name,
+          "app.kubernetes.io/name": "hellosvc",
+          "app.kubernetes.io/version": "1.8"
+        },
+        "name": v.name,
+        "namespace": v.namespace
+      },
+      "spec": {
+        "ports": [
+          {
+            "name": "http",
+            "port": 80,
+            "targetPort": 80
+          }
+        ],
+        "selector": {
+          "app.kubernetes.io/component": "demo",
+          "app.kubernetes.io/instance": v.name,
+          "app.kubernetes.io/name": "hellosvc"
+        },
+        "type": "LoadBalancer"
+      }
+    },
+  }
+)
@@ -0,0 +1,32 @@
+{
+  // NOTE: `app.kubernetes.io/instance` label is added by template, since it depends on the name.
+  // Type: map of string.
+  commonLabels: {
+    "app.kubernetes.io/component": "demo",
+    "app.kubernetes.io/name": "hellosvc",
+    "app.kubernetes.io/version": "1.8",
+  },
+  // Type: string.
+  message: "hello",
+  // Type: string.
+  name: "example",
+  // Type: string.
+  namespace: "default",
+  // Type: map of string.
+  podLabelSelector: {
+    "app.kubernetes.io/component": "demo",
+    "app.kubernetes.io/name": "hellosvc",
+  },
+  // Type: object.
+  ports: {
+    // Type: integer.
+    http: 80,
+  },
+  // Type: integer.
+  replicas: 1,
+  // Resources are Kubernetes container resource requirements.
+  // Type: object.
+  resources: {},
+  // Type: string.
+  version: "1.8",
+}
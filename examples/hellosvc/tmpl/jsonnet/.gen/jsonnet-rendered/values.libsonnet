@@ -0,0 +1,8 @@
+{
+  // Type: string.
+  name: "my-special-precious-one",
+  // Type: string.
+  namespace: "special",
+  // Type: integer.
+  replicas: 3,
+}
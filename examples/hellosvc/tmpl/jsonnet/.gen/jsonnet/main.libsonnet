@@ -0,0 +1,11 @@
+// Code generated by rndr. DO NOT EDIT.
+// helloservice library. Values are merged into defaults from values.libsonnet.
+local defaults = import 'values.libsonnet';
+
+function(values={}) (
+  local v = std.mergePatch(defaults, values);
+  local groups = [
+    (import 'template/hellosvc.libsonnet')(v),
+  ];
+  std.foldl(function(objects, g) objects + g, groups, {})
+)
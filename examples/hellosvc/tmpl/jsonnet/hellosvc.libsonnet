@@ -1,39 +1,15 @@
-// No need to define defaults here - rndr will allow to have consistent defaults defined in proto or go.
-local defaults = {
-  local defaults = self,
-  name: 'example',
-  namespace: 'default',
-  version: '1.8',
-  replicas: 1,
-  resources: {},
-  ports: {
-    http: 80,
-  },
-  message: 'hello',
-  tracing: {},
-
-  commonLabels:: {
-    'app.kubernetes.io/name': 'hellosvc',
-    'app.kubernetes.io/instance': defaults.name,
-    'app.kubernetes.io/version': defaults.version,
-    'app.kubernetes.io/component': 'demo',
-  },
-
-  podLabelSelector:: {
-    [labelName]: defaults.commonLabels[labelName]
-    for labelName in std.objectFields(defaults.commonLabels)
-    if labelName != 'app.kubernetes.io/version'
-  },
-};
-
 // values definition is availabile in ../api/
-// TODO(bwplotka): Generate validation and safety check if this file is using correct field names etc from go/protobuf definition.
+// No need to define defaults here - rndr validates values and fills defaults using Default() defined in ../api/go.
 function(values) {
   local hs = self,
 
-  config:: defaults + values,
+  config:: values {
+    // Instance label depends on the name, so it can't be part of API defaults.
+    commonLabels: { 'app.kubernetes.io/instance': values.name } + super.commonLabels,
+    podLabelSelector: { 'app.kubernetes.io/instance': values.name } + super.podLabelSelector,
+  },
 
-  // Safety checks for combined config of defaults and params.
+  // Safety checks for config.
   assert std.isNumber(hs.config.replicas) && hs.config.replicas >= 0 : 'hello pod replicas has to be number >= 0',
   assert std.isObject(hs.config.resources),
 
@@ -5,12 +5,22 @@ go 1.15
 require (
 	github.com/brancz/locutus v0.0.0-20210118164634-ff6bf1183da1
 	github.com/efficientgo/tools/core v0.0.0-20210120193558-db1e3eb63de3
+	github.com/evanphx/json-patch v4.9.0+incompatible
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-kit/kit v0.10.0
+	github.com/google/go-jsonnet v0.17.0
+	github.com/jhump/protoreflect v1.9.0
 	github.com/oklog/run v1.1.0
 	github.com/openproto/protoconfig/go v0.0.0-20210120170055-746d71fbb221
 	github.com/pkg/errors v0.9.1
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.0.0
+	google.golang.org/protobuf v1.25.1-0.20200805231151-a709e31e5d12
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
+	helm.sh/helm/v3 v3.5.0
+	k8s.io/apimachinery v0.20.1
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace github.com/brancz/locutus => ../locutus
@@ -2,7 +2,11 @@ package kingpinv2
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -21,6 +25,8 @@ type Clause struct {
 
 	hiddenContent  bool
 	defaultContent string
+
+	merge func(contents ...[]byte) ([]byte, error)
 }
 
 type FlagClause interface {
@@ -33,11 +39,13 @@ type AllClause interface {
 	HiddenContent() AllClause
 	DefaultPath(values string) PathOrContentClause
 	DefaultContent(values string) PathOrContentClause
+	Merge(merge func(contents ...[]byte) ([]byte, error)) AllClause
 	PathOrContentClause
 }
 
 type PathOrContentClause interface {
 	PathOrContent() *PathOrContent
+	PathsOrContent() *PathsOrContent
 }
 
 func Flag(cmd FlagClause, flagName string, help string) AllClause {
@@ -66,55 +74,81 @@ func (f *Clause) HiddenPath() AllClause {
 	return f
 }
 
+// Merge sets function that merges content of multiple files (e.g when path is a directory) into one. Without it,
+// PathOrContent.Content returns error if path matches more than one file.
+func (f *Clause) Merge(merge func(contents ...[]byte) ([]byte, error)) AllClause {
+	f.merge = merge
+	return f
+}
+
 // Required makes the flag required. You can not provide a Default() value to a Required() flag.
 func (f *Clause) Required() AllClause {
 	f.required = true
 	return f
 }
 
-// PathOrContent is a flag type that defines two flags to fetch bytes. Either from file (*-file flag) or content (* flag).
-type PathOrContent struct {
-	flagName string
-
-	required bool
+// stdin is read when path is `-`.
+var stdin io.Reader = os.Stdin
 
-	path    *string
-	content *string
-}
+const pathHelp = "Path can be '-' for stdin, directory (all *.yaml, *.yml and *.json files in lexical order), glob or file:// URL."
 
-func (f *Clause) PathOrContent() *PathOrContent {
+// flags registers path and content flags. Path flag clause is returned, so it can be parsed as single or repeated value.
+func (f *Clause) flags(pathHelpSuffix string) (path *kingpin.FlagClause, content *string) {
 	pathFlagName := fmt.Sprintf("%s-file", f.name)
-	contentFlagName := f.name
 
-	c := f.cmd.Flag(pathFlagName, fmt.Sprintf("Path to %s", f.help))
+	help := fmt.Sprintf("Path to %s %s%s", f.help, pathHelp, pathHelpSuffix)
+	path = f.cmd.Flag(pathFlagName, withDefault(help, f.defaultPath))
 	if f.hiddenPath {
-		c = c.Hidden()
+		path = path.Hidden()
 	}
 	if f.defaultPath != "" {
-		// TODO(bwplotka): Add default to help.
-		c = c.Default(f.defaultPath)
+		path = path.Default(f.defaultPath)
 	}
-	pathFlag := c.PlaceHolder("<file-path>").String()
+	path = path.PlaceHolder("<file-path>")
 
-	c = f.cmd.Flag(contentFlagName, fmt.Sprintf("Alternative to '%s' flag (lower priority). Content of %s", pathFlagName, f.help))
+	help = fmt.Sprintf("Alternative to '%s' flag (lower priority). Content of %s", pathFlagName, f.help)
+	c := f.cmd.Flag(f.name, withDefault(help, f.defaultContent))
 	if f.hiddenContent {
 		c = c.Hidden()
 	}
 	if f.defaultContent != "" {
-		// TODO(bwplotka): Add default to help.
 		c = c.Default(f.defaultContent)
 	}
-	contentFlag := c.PlaceHolder("<content>").String()
+	return path, c.PlaceHolder("<content>").String()
+}
+
+// withDefault adds default to the help, since placeholders hide it from usage.
+func withDefault(help string, def string) string {
+	if def == "" {
+		return help
+	}
+	return fmt.Sprintf("%s (default: %q)", help, def)
+}
+
+// PathOrContent is a flag type that defines two flags to fetch bytes. Either from file (*-file flag) or content (* flag).
+type PathOrContent struct {
+	flagName string
 
+	required bool
+	merge    func(contents ...[]byte) ([]byte, error)
+
+	path    *string
+	content *string
+}
+
+func (f *Clause) PathOrContent() *PathOrContent {
+	pathFlag, contentFlag := f.flags("")
 	return &PathOrContent{
 		flagName: f.name,
 		required: f.required,
-		path:     pathFlag,
+		merge:    f.merge,
+		path:     pathFlag.String(),
 		content:  contentFlag,
 	}
 }
 
 // Content returns content of the file. Flag that specifies path has priority.
+// Content of multiple files (e.g directory) is merged using Merge function.
 // It returns error if the content is empty and required flag is set to true.
 func (p *PathOrContent) Content() ([]byte, error) {
 	contentFlagName := p.flagName
@@ -126,11 +160,20 @@ func (p *PathOrContent) Content() ([]byte, error) {
 
 	var content []byte
 	if len(*p.path) > 0 {
-		c, err := ioutil.ReadFile(*p.path)
+		contents, err := readPaths(fileFlagName, *p.path)
 		if err != nil {
-			return nil, errors.Wrapf(err, "loading YAML file %s for %s", *p.path, fileFlagName)
+			return nil, err
+		}
+		switch {
+		case len(contents) == 1:
+			content = contents[0]
+		case p.merge == nil:
+			return nil, errors.Errorf("%s %s matched %d files, but only single file is supported", fileFlagName, *p.path, len(contents))
+		default:
+			if content, err = p.merge(contents...); err != nil {
+				return nil, errors.Wrapf(err, "merge files matched by %s %s", fileFlagName, *p.path)
+			}
 		}
-		content = c
 	} else {
 		content = []byte(*p.content)
 	}
@@ -141,3 +184,153 @@ func (p *PathOrContent) Content() ([]byte, error) {
 
 	return content, nil
 }
+
+// PathsOrContent is a flag type like PathOrContent, but *-file flag can be repeated to fetch bytes from multiple files.
+type PathsOrContent struct {
+	flagName string
+
+	required bool
+
+	paths   *[]string
+	content *string
+}
+
+func (f *Clause) PathsOrContent() *PathsOrContent {
+	pathsFlag, contentFlag := f.flags(" Can be repeated.")
+	return &PathsOrContent{
+		flagName: f.name,
+		required: f.required,
+		paths:    pathsFlag.Strings(),
+		content:  contentFlag,
+	}
+}
+
+// Contents returns content of each file in order they were specified (files matched by single path are in lexical order)
+// or the content flag, if no file was specified.
+// It returns error if there is no content and required flag is set to true.
+func (p *PathsOrContent) Contents() ([][]byte, error) {
+	contentFlagName := p.flagName
+	fileFlagName := fmt.Sprintf("%s-file", p.flagName)
+
+	if len(*p.paths) > 0 && len(*p.content) > 0 {
+		return nil, errors.Errorf("both %s and %s flags set.", fileFlagName, contentFlagName)
+	}
+
+	contents, err := readPaths(fileFlagName, *p.paths...)
+	if err != nil {
+		return nil, err
+	}
+	if len(*p.content) > 0 {
+		contents = append(contents, []byte(*p.content))
+	}
+
+	if len(contents) == 0 && p.required {
+		return nil, errors.Errorf("flag %s or %s is required for running this command and content cannot be empty.", fileFlagName, contentFlagName)
+	}
+
+	return contents, nil
+}
+
+// Paths returns files matched by *-file flags in order they were specified (files matched by single path are in lexical
+// order). Stdin is returned as `-`.
+func (p *PathsOrContent) Paths() ([]string, error) {
+	var files []string
+	for _, path := range *p.paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		matched, err := expandPath(strings.TrimPrefix(path, "file://"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s-file %s", p.flagName, path)
+		}
+		files = append(files, matched...)
+	}
+	return files, nil
+}
+
+// readPaths returns content of all files given paths match, in order.
+func readPaths(fileFlagName string, paths ...string) ([][]byte, error) {
+	var (
+		contents  [][]byte
+		readStdin bool
+	)
+	for _, path := range paths {
+		if path == "-" {
+			if readStdin {
+				return nil, errors.Errorf("stdin can be specified only once for %s", fileFlagName)
+			}
+			readStdin = true
+
+			c, err := ioutil.ReadAll(stdin)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading stdin for %s", fileFlagName)
+			}
+			contents = append(contents, c)
+			continue
+		}
+
+		files, err := expandPath(strings.TrimPrefix(path, "file://"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s %s", fileFlagName, path)
+		}
+		for _, f := range files {
+			c, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "loading YAML file %s for %s", f, fileFlagName)
+			}
+			contents = append(contents, c)
+		}
+	}
+	return contents, nil
+}
+
+// expandPath returns files given path matches in lexical order. Directories match YAML and JSON files they contain
+// (not recursively), globs match files (not directories) the same way as filepath.Glob. Existing path is never treated
+// as glob, so files with glob characters in names (e.g `values[prod].yaml`) can be used as they are.
+func expandPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil && strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() {
+				continue
+			}
+			files = append(files, m)
+		}
+		if len(files) == 0 {
+			return nil, errors.New("glob does not match any file")
+		}
+		return files, nil
+	}
+	if err != nil {
+		// Reading the file returns the error with flag name.
+		return []string{path}, nil
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, i := range infos {
+		if i.IsDir() {
+			continue
+		}
+		switch filepath.Ext(i.Name()) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(path, i.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("directory does not have any YAML or JSON file")
+	}
+	return files, nil
+}
@@ -0,0 +1,105 @@
+package kingpinv2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestPathOrContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kingpinv2")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "values", "nested"), os.ModePerm))
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "literal"), os.ModePerm))
+	for f, c := range map[string]string{
+		"values/2-env.yaml":          "b: 2\n",
+		"values/1-base.json":         `{"a": 1}`,
+		"values/3-cluster.yml":       "c: 3\n",
+		"values/README.md":           "not values",
+		"values/nested/ignored.yaml": "d: 4\n",
+		"literal/values[prod].yaml":  "e: 5\n",
+		"literal/valuesp.yaml":       "f: 6\n",
+	} {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, f), []byte(c), os.ModePerm))
+	}
+	t.Cleanup(func() { stdin = os.Stdin })
+	stdin = strings.NewReader("from: stdin\n")
+
+	join := func(contents ...[]byte) ([]byte, error) { return bytes.Join(contents, []byte("---\n")), nil }
+	parse := func(t *testing.T, args ...string) (*PathOrContent, *PathsOrContent) {
+		t.Helper()
+
+		app := kingpin.New("test", "")
+		single := Flag(app, "single", "single").Merge(join).PathOrContent()
+		multi := Flag(app, "multi", "multi").PathsOrContent()
+		_, err := app.Parse(args)
+		testutil.Ok(t, err)
+		return single, multi
+	}
+
+	for _, tcase := range []struct {
+		path     string
+		expected []string
+	}{
+		{path: filepath.Join(dir, "values", "2-env.yaml"), expected: []string{"b: 2\n"}},
+		{path: "file://" + filepath.Join(dir, "values", "2-env.yaml"), expected: []string{"b: 2\n"}},
+		{path: "-", expected: []string{"from: stdin\n"}},
+		{path: filepath.Join(dir, "values"), expected: []string{`{"a": 1}`, "b: 2\n", "c: 3\n"}},
+		{path: filepath.Join(dir, "values", "*.y*ml"), expected: []string{"b: 2\n", "c: 3\n"}},
+		// Existing file is not a glob.
+		{path: filepath.Join(dir, "literal", "values[prod].yaml"), expected: []string{"e: 5\n"}},
+		{path: filepath.Join(dir, "literal", "values[op].yaml"), expected: []string{"f: 6\n"}},
+	} {
+		t.Run(tcase.path, func(t *testing.T) {
+			stdin = strings.NewReader("from: stdin\n")
+			single, multi := parse(t, "--single-file="+tcase.path, "--multi-file="+tcase.path, "--multi-file="+filepath.Join(dir, "values", "1-base.json"))
+
+			c, err := single.Content()
+			testutil.Ok(t, err)
+			testutil.Equals(t, strings.Join(tcase.expected, "---\n"), string(c))
+
+			stdin = strings.NewReader("from: stdin\n")
+			cs, err := multi.Contents()
+			testutil.Ok(t, err)
+			var got []string
+			for _, c := range cs {
+				got = append(got, string(c))
+			}
+			testutil.Equals(t, append(tcase.expected, `{"a": 1}`), got)
+
+			paths, err := multi.Paths()
+			testutil.Ok(t, err)
+			testutil.Equals(t, len(got), len(paths))
+			testutil.Equals(t, filepath.Join(dir, "values", "1-base.json"), paths[len(paths)-1])
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		app := kingpin.New("test", "")
+		single := Flag(app, "single", "single").PathOrContent()
+		_, err := app.Parse([]string{"--single-file=" + filepath.Join(dir, "values")})
+		testutil.Ok(t, err)
+		_, err = single.Content()
+		testutil.NotOk(t, err)
+
+		_, multi := parse(t, "--multi-file=-", "--multi-file=-")
+		_, err = multi.Contents()
+		testutil.NotOk(t, err)
+
+		_, multi = parse(t, "--multi-file="+filepath.Join(dir, "values", "*.txt"))
+		_, err = multi.Contents()
+		testutil.NotOk(t, err)
+
+		_, multi = parse(t, "--multi-file="+filepath.Join(dir, "values"), "--multi=a: 1")
+		_, err = multi.Contents()
+		testutil.NotOk(t, err)
+	})
+}
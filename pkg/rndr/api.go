@@ -0,0 +1,37 @@
+package rndr
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/crd"
+	"github.com/observatorium/rndr/pkg/rndr/engines/golang"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonschema"
+	"github.com/observatorium/rndr/pkg/rndr/engines/proto"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+)
+
+// LoadAPI resolves template API definition into values schema and defaults.
+func LoadAPI(ctx context.Context, logger log.Logger, a API) (rndrapi.API, error) {
+	switch {
+	case a.Go != nil:
+		return golang.Load(ctx, logger, *a.Go)
+	case a.Proto != nil:
+		return proto.Load(ctx, logger, *a.Proto)
+	case a.JSONSchema != nil:
+		return jsonschema.Load(ctx, logger, *a.JSONSchema)
+	default:
+		return rndrapi.API{}, errors.New("no template api was specified")
+	}
+}
+
+// GenerateCRD generates Custom Resource Definition with template values schema as the resource `spec`. Schema has
+// descriptions and defaults taken from the template API, so the resource can be used to configure the template.
+func GenerateCRD(ctx context.Context, logger log.Logger, name string, a API, opts crd.Options) (*crd.CustomResourceDefinition, error) {
+	api, err := LoadAPI(ctx, logger, a)
+	if err != nil {
+		return nil, errors.Wrap(err, "load template API")
+	}
+	return crd.Generate(name, api, opts)
+}
@@ -0,0 +1,30 @@
+package rndr
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/crd"
+	"github.com/observatorium/rndr/pkg/rndr/engines/golang"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// TestGenerateCRD checks CRD generated from the example Go API against the one committed in the example, which
+// `rndr crd` generates with the same options.
+func TestGenerateCRD(t *testing.T) {
+	d, err := GenerateCRD(context.Background(), log.NewNopLogger(), "helloservice", API{Go: &golang.TemplateAPI{
+		Default: "github.com/observatorium/rndr/examples/hellosvc/api/go.Default()",
+		Struct:  "github.com/observatorium/rndr/examples/hellosvc/api/go.HelloService",
+		Dir:     "../../examples/hellosvc/tmpl/jsonnet",
+	}}, crd.Options{Kind: "HelloService"})
+	testutil.Ok(t, err)
+
+	b, err := k8syaml.Marshal(d)
+	testutil.Ok(t, err)
+	expected, err := ioutil.ReadFile("../../examples/hellosvc/expected/crd/helloservices.yaml")
+	testutil.Ok(t, err)
+	testutil.Equals(t, string(expected), string(b))
+}
@@ -0,0 +1,229 @@
+package rndr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/efficientgo/tools/core/pkg/merrors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/observatorium/rndr/pkg/version"
+	"github.com/pkg/errors"
+)
+
+// renderCacheDir is a directory within cache directory (see DefaultCacheDir) rendered resources are cached in.
+const renderCacheDir = "renders"
+
+// NewCachedRenderFunc is like NewRenderFunc, but caches rendered resources in cacheDir (see DefaultCacheDir). Cache key
+// is a hash of rndr version, template name and definition, content of its sources (see Sources) and values, so
+// resources are returned from the cache without loading template API or invoking renderer until any of those changes.
+// Paths are hashed relative to the template Dir, so the same template in a different directory (e.g another checkout)
+// uses the same cache entries.
+// Files template reads that are not its sources (e.g ones read by process renderer command, but not declared in its
+// Inputs) are not part of the key.
+func NewCachedRenderFunc(ctx context.Context, logger log.Logger, name string, t Template, cacheDir string) (rndrapi.RenderFunc, error) {
+	h, err := templateHash(name, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "hash template")
+	}
+	dir := filepath.Join(cacheDir, renderCacheDir)
+
+	var (
+		mtx      sync.Mutex
+		renderFn rndrapi.RenderFunc
+	)
+	// Template API is loaded only once and only if some values were not rendered before.
+	load := func() (rndrapi.RenderFunc, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if renderFn != nil {
+			return renderFn, nil
+		}
+		var err error
+		renderFn, err = NewRenderFunc(ctx, logger, name, t)
+		return renderFn, err
+	}
+
+	return func(ctx context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		key := sha256.New()
+		writeHashed(key, h)
+		writeHashed(key, valuesYAML)
+		file := filepath.Join(dir, hex.EncodeToString(key.Sum(nil))+".json")
+
+		groups, err := readCached(file)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to read render cache; rendering", "file", file, "err", err)
+		}
+		if groups != nil {
+			level.Debug(logger).Log("msg", "render cache hit", "template", name, "file", file)
+			return groups, nil
+		}
+		level.Debug(logger).Log("msg", "render cache miss", "template", name, "file", file)
+
+		render, err := load()
+		if err != nil {
+			return nil, err
+		}
+		groups, err = render(ctx, valuesYAML)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeCached(file, groups); err != nil {
+			level.Warn(logger).Log("msg", "failed to write render cache", "file", file, "err", err)
+		}
+		return groups, nil
+	}, nil
+}
+
+// templateHash returns hash of rndr version, template name and definition and content of its sources.
+func templateHash(name string, t Template) ([]byte, error) {
+	dir, err := filepath.Abs(t.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	writeHashed(h, []byte(version.Version))
+	writeHashed(h, []byte(name))
+
+	// ParseSpec makes template paths absolute; definition is hashed with paths relative to template directory.
+	def, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(def, &v); err != nil {
+		return nil, err
+	}
+	if def, err = json.Marshal(relativePaths(v, dir)); err != nil {
+		return nil, err
+	}
+	writeHashed(h, def)
+
+	sources, err := Sources(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range sources {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		writeHashed(h, []byte(filepath.ToSlash(rel)))
+		writeHashed(h, b)
+	}
+	return h.Sum(nil), nil
+}
+
+// relativePaths returns v decoded from JSON with absolute paths made relative to dir.
+func relativePaths(v interface{}, dir string) interface{} {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		for k, e := range o {
+			o[k] = relativePaths(e, dir)
+		}
+	case []interface{}:
+		for i, e := range o {
+			o[i] = relativePaths(e, dir)
+		}
+	case string:
+		if !filepath.IsAbs(o) {
+			return o
+		}
+		if rel, err := filepath.Rel(dir, o); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return v
+}
+
+// writeHashed writes length prefixed b, so different inputs can't result in the same hashed bytes.
+func writeHashed(h hash.Hash, b []byte) {
+	fmt.Fprintf(h, "%d:", len(b))
+	_, _ = h.Write(b)
+}
+
+// readCached returns cached resources or nil if there are none. Cache file modification time is bumped on hit, so
+// recently used entries are kept when pruning.
+func readCached(file string) (rndrapi.Groups, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	groups := rndrapi.Groups{}
+	if err := json.Unmarshal(b, &groups); err != nil {
+		return nil, errors.Wrap(err, "parse cached resources")
+	}
+	// Failing to bump modification time only makes entry pruned earlier.
+	now := time.Now()
+	_ = os.Chtimes(file, now, now)
+	return groups, nil
+}
+
+// writeCached writes resources into the cache file atomically, so concurrent runs never read partial file.
+func writeCached(file string, groups rndrapi.Groups) error {
+	b, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return merrors.New(err, os.Remove(f.Name())).Err()
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// PruneRenderCache removes resources cached by NewCachedRenderFunc in cacheDir that were not used for olderThan
+// duration, or all of them if olderThan is zero. It returns number of removed entries, also when ctx is cancelled.
+func PruneRenderCache(ctx context.Context, cacheDir string, olderThan time.Duration) (int, error) {
+	dir := filepath.Join(cacheDir, renderCacheDir)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, i := range infos {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if i.IsDir() || (olderThan > 0 && time.Since(i.ModTime()) < olderThan) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, i.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,158 @@
+package rndr
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonschema"
+	"github.com/observatorium/rndr/pkg/rndr/engines/process"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestNewCachedRenderFunc(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("process renderer script requires /bin/sh")
+	}
+
+	dir, err := ioutil.TempDir("", "rndr-cache")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	write := func(file, content string) {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), os.ModePerm))
+	}
+	write("values.schema.json", `{"type": "object", "properties": {"name": {"type": "string", "default": "hello"}}}`)
+	// Renderer counts its invocations and reads declared input.
+	write("render.sh", "#!/bin/sh\necho x >> "+filepath.Join(dir, "invocations")+"\necho 'kind: ConfigMap'\necho 'metadata: {name: cm}'\ncat "+filepath.Join(dir, "data.yaml")+"\n")
+	write("data.yaml", "data: {a: b}\n")
+	invocations := func() int {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "invocations"))
+		if os.IsNotExist(err) {
+			return 0
+		}
+		testutil.Ok(t, err)
+		return strings.Count(string(b), "x")
+	}
+
+	tmpl := Template{
+		API:      API{JSONSchema: &jsonschema.TemplateAPI{File: filepath.Join(dir, "values.schema.json")}},
+		Renderer: TemplateRenderer{Process: &process.TemplateRenderer{Command: filepath.Join(dir, "render.sh"), Inputs: []string{filepath.Join(dir, "data.yaml")}}},
+		Dir:      dir,
+	}
+	cacheDir := filepath.Join(dir, "cache")
+	ctx := context.Background()
+	render := func(valuesYAML string) rndrapi.Groups {
+		t.Helper()
+		fn, err := NewCachedRenderFunc(ctx, log.NewNopLogger(), "hello", tmpl, cacheDir)
+		testutil.Ok(t, err)
+		groups, err := fn(ctx, []byte(valuesYAML))
+		testutil.Ok(t, err)
+		return groups
+	}
+
+	expected := rndrapi.Groups{"hello": {{Item: "configmap-cm", Object: []byte("kind: ConfigMap\nmetadata: {name: cm}\ndata: {a: b}\n")}}}
+	testutil.Equals(t, expected, render("name: a\n"))
+	testutil.Equals(t, 1, invocations())
+	testutil.Equals(t, expected, render("name: a\n"))
+	testutil.Equals(t, 1, invocations())
+
+	// Different values.
+	render("name: b\n")
+	testutil.Equals(t, 2, invocations())
+
+	// Changed source.
+	write("values.schema.json", `{"type": "object", "properties": {"name": {"type": "string", "default": "hi"}}}`)
+	render("name: a\n")
+	testutil.Equals(t, 3, invocations())
+
+	// Changed declared input.
+	write("data.yaml", "data: {a: c}\n")
+	render("name: a\n")
+	testutil.Equals(t, 4, invocations())
+
+	// Invalid values are not cached.
+	fn, err := NewCachedRenderFunc(ctx, log.NewNopLogger(), "hello", tmpl, cacheDir)
+	testutil.Ok(t, err)
+	_, err = fn(ctx, []byte("name: 1\n"))
+	testutil.NotOk(t, err)
+
+	removed, err := PruneRenderCache(ctx, cacheDir, 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 4, removed)
+
+	render("name: a\n")
+	testutil.Equals(t, 5, invocations())
+}
+
+func TestTemplateHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-cache")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	// Same template in two directories, with paths made absolute like ParseSpec does.
+	tmpl := func(d string) Template {
+		testutil.Ok(t, os.MkdirAll(d, os.ModePerm))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(d, "values.schema.json"), []byte(`{"type": "object"}`), os.ModePerm))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(d, "render.sh"), []byte("#!/bin/sh\n"), os.ModePerm))
+		return Template{
+			API:      API{JSONSchema: &jsonschema.TemplateAPI{File: filepath.Join(d, "values.schema.json")}},
+			Renderer: TemplateRenderer{Process: &process.TemplateRenderer{Command: filepath.Join(d, "render.sh")}},
+			Dir:      d,
+		}
+	}
+	a, b := tmpl(filepath.Join(dir, "a")), tmpl(filepath.Join(dir, "b"))
+
+	ha, err := templateHash("hello", a)
+	testutil.Ok(t, err)
+	hb, err := templateHash("hello", b)
+	testutil.Ok(t, err)
+	testutil.Equals(t, ha, hb)
+
+	testutil.Ok(t, ioutil.WriteFile(b.API.JSONSchema.File, []byte(`{"type": "object", "properties": {}}`), os.ModePerm))
+	hb, err = templateHash("hello", b)
+	testutil.Ok(t, err)
+	testutil.Assert(t, string(ha) != string(hb), "changed source has to change hash")
+}
+
+func TestPruneRenderCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-cache")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	renders := filepath.Join(dir, renderCacheDir)
+	testutil.Ok(t, os.MkdirAll(renders, os.ModePerm))
+	for _, f := range []string{"old.json", "new.json"} {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(renders, f), []byte("{}"), os.ModePerm))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	testutil.Ok(t, os.Chtimes(filepath.Join(renders, "old.json"), old, old))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	removed, err := PruneRenderCache(ctx, dir, 0)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, context.Canceled, err)
+	testutil.Equals(t, 0, removed)
+
+	removed, err = PruneRenderCache(context.Background(), dir, time.Hour)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, removed)
+	_, err = os.Stat(filepath.Join(renders, "new.json"))
+	testutil.Ok(t, err)
+
+	removed, err = PruneRenderCache(context.Background(), dir, 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, removed)
+
+	// Nothing cached yet is not an error.
+	removed, err = PruneRenderCache(context.Background(), filepath.Join(dir, "nope"), 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, removed)
+}
@@ -0,0 +1,224 @@
+// Package crd generates Kubernetes Custom Resource Definitions with template values as the resource `spec`, so template
+// can be configured with custom resources (e.g by generated operator).
+package crd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultGroup is API group used if none is specified.
+	DefaultGroup = "rndr.observatorium.io"
+	// DefaultVersion is API version used if none is specified.
+	DefaultVersion = "v1alpha1"
+)
+
+// Options configures the custom resource.
+type Options struct {
+	// Group is an API group of the resource. Defaults to DefaultGroup.
+	Group string
+	// Kind is a kind of the resource. Defaults to upper camel case template name e.g `HelloService` for `hello-service`.
+	Kind string
+	// Plural is a plural lower case name of the resource. Defaults to plural of lower case Kind e.g `helloservices`.
+	Plural string
+	// Versions are served API versions of the resource with the same schema. The last one is the storage version.
+	// Defaults to DefaultVersion.
+	Versions []string
+	// Namespaced controls if resources are namespaced. Defaults to true.
+	Namespaced *bool
+}
+
+// WithDefaults returns options with all defaults for the template of given name filled.
+func (o Options) WithDefaults(name string) Options {
+	if o.Group == "" {
+		o.Group = DefaultGroup
+	}
+	if o.Kind == "" {
+		o.Kind = kindOf(name)
+	}
+	if o.Plural == "" {
+		o.Plural = Plural(o.Kind)
+	}
+	if len(o.Versions) == 0 {
+		o.Versions = []string{DefaultVersion}
+	}
+	if o.Namespaced == nil {
+		namespaced := true
+		o.Namespaced = &namespaced
+	}
+	return o
+}
+
+// Name returns name of the Custom Resource Definition e.g `helloservices.rndr.observatorium.io`.
+func (o Options) Name() string {
+	return o.Plural + "." + o.Group
+}
+
+// APIVersion returns apiVersion of storage version of the resource e.g `rndr.observatorium.io/v1alpha1`.
+func (o Options) APIVersion() string {
+	return o.Group + "/" + o.Versions[len(o.Versions)-1]
+}
+
+// CustomResourceDefinition is `apiextensions.k8s.io/v1` CustomResourceDefinition.
+type CustomResourceDefinition struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   Metadata `json:"metadata"`
+	Spec       Spec     `json:"spec"`
+}
+
+type Metadata struct {
+	Name string `json:"name"`
+}
+
+type Spec struct {
+	Group    string    `json:"group"`
+	Names    Names     `json:"names"`
+	Scope    string    `json:"scope"`
+	Versions []Version `json:"versions"`
+}
+
+type Names struct {
+	Kind     string `json:"kind"`
+	ListKind string `json:"listKind"`
+	Plural   string `json:"plural"`
+	Singular string `json:"singular"`
+}
+
+type Version struct {
+	Name         string                 `json:"name"`
+	Served       bool                   `json:"served"`
+	Storage      bool                   `json:"storage"`
+	Schema       Validation             `json:"schema"`
+	Subresources map[string]interface{} `json:"subresources,omitempty"`
+}
+
+type Validation struct {
+	OpenAPIV3Schema *rndrapi.Schema `json:"openAPIV3Schema"`
+}
+
+// Generate returns Custom Resource Definition with template values schema as the `spec` of the resource. API defaults
+// are put into the schema, so Kubernetes fills them in and resources can skip required values that have defaults.
+// Resource has status subresource that allows any content, so operators can report their state.
+func Generate(name string, api rndrapi.API, opts Options) (*CustomResourceDefinition, error) {
+	opts = opts.WithDefaults(name)
+	if api.Schema == nil {
+		return nil, errors.New("template API has no schema")
+	}
+	if api.Schema.Type != "object" && !api.Schema.XPreserveUnknownFields {
+		return nil, errors.Errorf("template API has to be an object to be used as custom resource spec, got %q", api.Schema.Type)
+	}
+
+	defaults := map[string]interface{}{}
+	if err := yaml.Unmarshal(api.Defaults, &defaults); err != nil {
+		return nil, errors.Wrap(err, "parse API defaults")
+	}
+	spec := withDefaults(api.Schema, defaults)
+	if spec.Description == "" {
+		spec.Description = fmt.Sprintf("Values of %s template.", name)
+	}
+	schema := &rndrapi.Schema{
+		Type:        "object",
+		Description: fmt.Sprintf("%s configures %s deployment.", opts.Kind, name),
+		Properties: map[string]*rndrapi.Schema{
+			"spec":   spec,
+			"status": {Type: "object", XPreserveUnknownFields: true},
+		},
+	}
+
+	scope := "Namespaced"
+	if !*opts.Namespaced {
+		scope = "Cluster"
+	}
+	crd := &CustomResourceDefinition{
+		APIVersion: "apiextensions.k8s.io/v1",
+		Kind:       "CustomResourceDefinition",
+		Metadata:   Metadata{Name: opts.Name()},
+		Spec: Spec{
+			Group: opts.Group,
+			Names: Names{
+				Kind:     opts.Kind,
+				ListKind: opts.Kind + "List",
+				Plural:   opts.Plural,
+				Singular: strings.ToLower(opts.Kind),
+			},
+			Scope: scope,
+		},
+	}
+	for i, v := range opts.Versions {
+		crd.Spec.Versions = append(crd.Spec.Versions, Version{
+			Name:         v,
+			Served:       true,
+			Storage:      i == len(opts.Versions)-1,
+			Schema:       Validation{OpenAPIV3Schema: schema},
+			Subresources: map[string]interface{}{"status": map[string]interface{}{}},
+		})
+	}
+	return crd, nil
+}
+
+// withDefaults returns copy of the schema with given defaults. Objects with properties get defaults per property
+// and an empty object default, so defaults of nested properties are applied even if the object is not specified.
+func withDefaults(s *rndrapi.Schema, defaults interface{}) *rndrapi.Schema {
+	c := *s
+	m, ok := defaults.(map[string]interface{})
+	if !ok || len(s.Properties) == 0 {
+		if defaults != nil {
+			c.Default = defaults
+		}
+		return &c
+	}
+
+	c.Properties = make(map[string]*rndrapi.Schema, len(s.Properties))
+	for k, p := range s.Properties {
+		d, ok := m[k]
+		if !ok {
+			c.Properties[k] = p
+			continue
+		}
+		c.Properties[k] = withDefaults(p, d)
+	}
+	c.Default = map[string]interface{}{}
+	return &c
+}
+
+// kindOf returns upper camel case kind for template name e.g `HelloService` for `hello-service`.
+func kindOf(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Plural returns plural lower case resource name for given kind, following Kubernetes conventions
+// (e.g `ingresses` for `Ingress`, `networkpolicies` for `NetworkPolicy`).
+func Plural(kind string) string {
+	k := strings.ToLower(kind)
+	switch {
+	case k == "":
+		return ""
+	case strings.HasSuffix(k, "s"), strings.HasSuffix(k, "x"), strings.HasSuffix(k, "z"),
+		strings.HasSuffix(k, "ch"), strings.HasSuffix(k, "sh"):
+		return k + "es"
+	case strings.HasSuffix(k, "y") && len(k) > 1 && !strings.ContainsRune("aeiou", rune(k[len(k)-2])):
+		return k[:len(k)-1] + "ies"
+	default:
+		return k + "s"
+	}
+}
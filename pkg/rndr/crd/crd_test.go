@@ -0,0 +1,65 @@
+package crd
+
+import (
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestGenerate(t *testing.T) {
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type:     "object",
+			Required: []string{"name", "ports"},
+			Properties: map[string]*rndrapi.Schema{
+				"name":  {Type: "string"},
+				"extra": {Type: "string"},
+				"ports": {
+					Type:       "object",
+					Properties: map[string]*rndrapi.Schema{"http": {Type: "integer"}},
+				},
+				"labels": {Type: "object", AdditionalProperties: &rndrapi.Schema{Type: "string"}},
+			},
+		},
+		Defaults: []byte("name: example\nports:\n  http: 80\nlabels:\n  app: hello\n"),
+	}
+
+	namespaced := false
+	c, err := Generate("hello-service", api, Options{Versions: []string{"v1alpha1", "v1beta1"}, Namespaced: &namespaced})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "helloservices.rndr.observatorium.io", c.Metadata.Name)
+	testutil.Equals(t, Names{Kind: "HelloService", ListKind: "HelloServiceList", Plural: "helloservices", Singular: "helloservice"}, c.Spec.Names)
+	testutil.Equals(t, "Cluster", c.Spec.Scope)
+	testutil.Equals(t, 2, len(c.Spec.Versions))
+	testutil.Assert(t, !c.Spec.Versions[0].Storage)
+	testutil.Assert(t, c.Spec.Versions[1].Storage)
+
+	spec := c.Spec.Versions[1].Schema.OpenAPIV3Schema.Properties["spec"]
+	testutil.Equals(t, "Values of hello-service template.", spec.Description)
+	testutil.Equals(t, map[string]interface{}{}, spec.Default)
+	testutil.Equals(t, "example", spec.Properties["name"].Default)
+	testutil.Equals(t, nil, spec.Properties["extra"].Default)
+	testutil.Equals(t, map[string]interface{}{}, spec.Properties["ports"].Default)
+	testutil.Equals(t, 80, spec.Properties["ports"].Properties["http"].Default)
+	testutil.Equals(t, map[string]interface{}{"app": "hello"}, spec.Properties["labels"].Default)
+
+	// API schema is not modified.
+	testutil.Equals(t, nil, api.Schema.Properties["name"].Default)
+
+	_, err = Generate("hello", rndrapi.API{Schema: &rndrapi.Schema{Type: "string"}}, Options{})
+	testutil.NotOk(t, err)
+}
+
+func TestPlural(t *testing.T) {
+	for kind, plural := range map[string]string{
+		"HelloService":  "helloservices",
+		"Ingress":       "ingresses",
+		"NetworkPolicy": "networkpolicies",
+		"Gateway":       "gateways",
+		"Box":           "boxes",
+		"Deployment":    "deployments",
+	} {
+		testutil.Equals(t, plural, Plural(kind))
+	}
+}
@@ -0,0 +1,348 @@
+// Package diff compares rendered resources with resources written before (e.g committed output directory) object by
+// object. Objects are matched by their apiVersion, kind, namespace and name, so file layout, key ordering and
+// formatting do not matter.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
+)
+
+// ID identifies object.
+type ID struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Source is set only for objects without name, so they don't clash with each other.
+	Source string `json:"source,omitempty"`
+}
+
+func (id ID) String() string {
+	if id.Name == "" {
+		return fmt.Sprintf("%s %s <unnamed in %s>", id.APIVersion, id.Kind, id.Source)
+	}
+	if id.Namespace == "" {
+		return fmt.Sprintf("%s %s %s", id.APIVersion, id.Kind, id.Name)
+	}
+	return fmt.Sprintf("%s %s %s/%s", id.APIVersion, id.Kind, id.Namespace, id.Name)
+}
+
+// Object is a parsed resource.
+type Object struct {
+	// Source is where the object comes from e.g file path.
+	Source string
+	Value  interface{}
+}
+
+// Objects are objects by their ID.
+type Objects map[ID]Object
+
+// FromGroups returns objects of rendered resources.
+func FromGroups(groups rndrapi.Groups) (Objects, error) {
+	objs := Objects{}
+	for g, rs := range groups {
+		for _, r := range rs {
+			if err := objs.add(r.Object, g+"/"+r.Item, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return objs, nil
+}
+
+// Read returns objects from YAML or JSON stream. `List` objects are read as their items.
+func Read(r io.Reader, source string) (Objects, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %v", source)
+	}
+	objs := Objects{}
+	if err := objs.add(b, source, false); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// ReadDir returns objects from all YAML and JSON files in directory, recursively. Documents without apiVersion or kind
+// (e.g values files) are not objects, so they are skipped.
+func ReadDir(dir string) (Objects, error) {
+	objs := Objects{}
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return objs.add(b, filepath.ToSlash(rel), true)
+	}); err != nil {
+		return nil, errors.Wrapf(err, "read %v", dir)
+	}
+	return objs, nil
+}
+
+// add adds objects from YAML or JSON documents. If skipNonObjects is true, documents without apiVersion or kind are
+// skipped instead of failing.
+func (objs Objects) add(b []byte, source string, skipNonObjects bool) error {
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	for i := 0; ; i++ {
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrapf(err, "parse %v", source)
+		}
+		if v == nil {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); skipNonObjects && (!ok || m["apiVersion"] == nil || m["kind"] == nil) {
+			continue
+		}
+		src := source
+		if i > 0 {
+			src = fmt.Sprintf("%s#%d", source, i)
+		}
+		if err := objs.addObject(v, src); err != nil {
+			return err
+		}
+	}
+}
+
+func (objs Objects) addObject(v interface{}, source string) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("%v: expected object, got %T", source, v)
+	}
+	id := ID{}
+	id.APIVersion, _ = m["apiVersion"].(string)
+	id.Kind, _ = m["kind"].(string)
+	if meta, ok := m["metadata"].(map[string]interface{}); ok {
+		id.Name, _ = meta["name"].(string)
+		id.Namespace, _ = meta["namespace"].(string)
+	}
+	if id.Name == "" {
+		id.Source = source
+	}
+
+	if items, ok := m["items"].([]interface{}); ok && strings.HasSuffix(id.Kind, "List") {
+		for i, item := range items {
+			if err := objs.addObject(item, fmt.Sprintf("%s[%d]", source, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if other, ok := objs[id]; ok {
+		return errors.Errorf("%v: object %v is already defined in %v", source, id, other.Source)
+	}
+	// Numbers are compared by value regardless of their YAML type e.g 1 is the same as 1.0.
+	n, err := Normalize(v)
+	if err != nil {
+		return errors.Wrapf(err, "%v: normalize object %v", source, id)
+	}
+	objs[id] = Object{Source: source, Value: n}
+	return nil
+}
+
+// Normalize round trips v through JSON, so all numbers are float64 and values decoded from YAML compare as objects do.
+// Non-string keys (e.g `1: foo`) are converted to strings, like in JSON.
+func Normalize(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(stringKeys(v))
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	if err := json.Unmarshal(b, &n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func stringKeys(v interface{}) interface{} {
+	switch o := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(o))
+		for k, e := range o {
+			m[fmt.Sprintf("%v", k)] = stringKeys(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(o))
+		for k, e := range o {
+			m[k] = stringKeys(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(o))
+		for i, e := range o {
+			l[i] = stringKeys(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// ChangeType is a type of the object drift.
+type ChangeType string
+
+const (
+	// Missing object is rendered, but not found.
+	Missing ChangeType = "missing"
+	// Stale object is found, but not rendered anymore.
+	Stale ChangeType = "stale"
+	// Changed object is rendered differently.
+	Changed ChangeType = "changed"
+)
+
+// Change is a drift of a single object.
+type Change struct {
+	ID   ID         `json:"id"`
+	Type ChangeType `json:"type"`
+	// Source is a source of found object, RenderedSource is a source of rendered object.
+	Source         string `json:"source,omitempty"`
+	RenderedSource string `json:"renderedSource,omitempty"`
+	// Diff is unified diff from found to rendered object.
+	Diff string `json:"diff"`
+}
+
+// Report is a result of the comparison.
+type Report struct {
+	Changes []Change `json:"changes"`
+}
+
+// Drift returns true if any object drifted.
+func (r Report) Drift() bool {
+	return len(r.Changes) > 0
+}
+
+// Compare compares rendered objects with found ones. Changes are sorted by object ID.
+func Compare(rendered, found Objects) (Report, error) {
+	ids := make([]ID, 0, len(rendered)+len(found))
+	for id := range rendered {
+		ids = append(ids, id)
+	}
+	for id := range found {
+		if _, ok := rendered[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	r := Report{Changes: []Change{}}
+	for _, id := range ids {
+		rend, rok := rendered[id]
+		f, fok := found[id]
+		c := Change{ID: id, Source: f.Source, RenderedSource: rend.Source}
+		switch {
+		case !fok:
+			c.Type = Missing
+		case !rok:
+			c.Type = Stale
+		case reflect.DeepEqual(rend.Value, f.Value):
+			continue
+		default:
+			c.Type = Changed
+		}
+
+		var err error
+		if c.Diff, err = unified(id, f, rend); err != nil {
+			return Report{}, err
+		}
+		r.Changes = append(r.Changes, c)
+	}
+	return r, nil
+}
+
+func unified(id ID, found, rendered Object) (string, error) {
+	lines := func(o Object) ([]string, error) {
+		if o.Value == nil {
+			return nil, nil
+		}
+		b := bytes.Buffer{}
+		e := yaml.NewEncoder(&b)
+		e.SetIndent(2)
+		if err := e.Encode(o.Value); err != nil {
+			return nil, errors.Wrapf(err, "encode %v", id)
+		}
+		return difflib.SplitLines(strings.TrimSuffix(b.String(), "\n")), nil
+	}
+	a, err := lines(found)
+	if err != nil {
+		return "", err
+	}
+	b, err := lines(rendered)
+	if err != nil {
+		return "", err
+	}
+	from, to := "/dev/null", "/dev/null"
+	if found.Source != "" {
+		from = "found/" + found.Source
+	}
+	if rendered.Source != "" {
+		to = "rendered/" + rendered.Source
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A: a, B: b, FromFile: from, ToFile: to, Context: 3,
+	})
+}
+
+// Format is a format of the report.
+type Format string
+
+const (
+	// Unified report has unified diff of each drifted object.
+	Unified Format = "unified"
+	// JSON report is Report in JSON.
+	JSON Format = "json"
+)
+
+// Write writes report in given format.
+func (r Report) Write(w io.Writer, f Format) error {
+	switch f {
+	case Unified:
+		for _, c := range r.Changes {
+			if _, err := fmt.Fprintf(w, "%s: %s\n%s", c.Type, c.ID, c.Diff); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSON:
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	default:
+		return errors.Errorf("unknown report format %q", f)
+	}
+}
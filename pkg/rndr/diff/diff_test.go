@@ -0,0 +1,142 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestCompare(t *testing.T) {
+	rendered, err := FromGroups(rndrapi.Groups{
+		"hello": {
+			{Item: "deployment", Object: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: hello\n  namespace: prod\nspec:\n  replicas: 3\n  paused: false\n")},
+			{Item: "service", Object: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: hello\n  namespace: prod\nspec:\n  type: ClusterIP\n")},
+			{Item: "config", Object: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: hello-new\n  namespace: prod\n")},
+		},
+	})
+	testutil.Ok(t, err)
+
+	dir, err := ioutil.TempDir("", "rndr-diff")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "nested"), os.ModePerm))
+	// Same deployment with different key order, formatting and number type.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "nested", "deployment.json"), []byte(`{"kind": "Deployment", "spec": {"paused": false, "replicas": 3.0},
+"metadata": {"namespace": "prod", "name": "hello"}, "apiVersion": "apps/v1"}`), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "all.yaml"), []byte(`---
+apiVersion: v1
+kind: Service
+metadata: {name: hello, namespace: prod}
+spec:
+  type: LoadBalancer
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: hello-old, namespace: prod}
+`), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a resource"), os.ModePerm))
+	// Values and other documents without apiVersion and kind are not resources.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "values.yaml"), []byte("name: hello\nreplicas: 3\n"), os.ModePerm))
+
+	found, err := ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(found))
+
+	report, err := Compare(rendered, found)
+	testutil.Ok(t, err)
+	testutil.Assert(t, report.Drift(), "expected drift")
+	testutil.Equals(t, []Change{
+		{
+			ID:             ID{APIVersion: "v1", Kind: "ConfigMap", Namespace: "prod", Name: "hello-new"},
+			Type:           Missing,
+			RenderedSource: "hello/config",
+			Diff: `--- /dev/null
++++ rendered/hello/config
+@@ -0,0 +1,5 @@
++apiVersion: v1
++kind: ConfigMap
++metadata:
++  name: hello-new
++  namespace: prod
+`,
+		},
+		{
+			ID:     ID{APIVersion: "v1", Kind: "ConfigMap", Namespace: "prod", Name: "hello-old"},
+			Type:   Stale,
+			Source: "all.yaml#1[0]",
+			Diff: `--- found/all.yaml#1[0]
++++ /dev/null
+@@ -1,5 +0,0 @@
+-apiVersion: v1
+-kind: ConfigMap
+-metadata:
+-  name: hello-old
+-  namespace: prod
+`,
+		},
+		{
+			ID:             ID{APIVersion: "v1", Kind: "Service", Namespace: "prod", Name: "hello"},
+			Type:           Changed,
+			Source:         "all.yaml",
+			RenderedSource: "hello/service",
+			Diff: `--- found/all.yaml
++++ rendered/hello/service
+@@ -4,4 +4,4 @@
+   name: hello
+   namespace: prod
+ spec:
+-  type: LoadBalancer
++  type: ClusterIP
+`,
+		},
+	}, report.Changes)
+
+	b := bytes.Buffer{}
+	testutil.Ok(t, report.Write(&b, Unified))
+	testutil.Assert(t, strings.HasPrefix(b.String(), "missing: v1 ConfigMap prod/hello-new\n--- /dev/null\n"), b.String())
+
+	b.Reset()
+	testutil.Ok(t, report.Write(&b, JSON))
+	got := Report{}
+	testutil.Ok(t, json.Unmarshal(b.Bytes(), &got))
+	testutil.Equals(t, report, got)
+
+	t.Run("no drift", func(t *testing.T) {
+		report, err := Compare(rendered, rendered)
+		testutil.Ok(t, err)
+		testutil.Assert(t, !report.Drift(), "expected no drift, got %v", report)
+	})
+	t.Run("duplicated object", func(t *testing.T) {
+		_, err := Read(strings.NewReader("kind: A\nmetadata: {name: a}\n---\nkind: A\nmetadata: {name: a}\n"), "stream")
+		testutil.NotOk(t, err)
+	})
+	t.Run("unnamed objects", func(t *testing.T) {
+		objs, err := Read(strings.NewReader("kind: A\n---\nkind: A\n"), "stream")
+		testutil.Ok(t, err)
+		testutil.Equals(t, Objects{
+			{Kind: "A", Source: "stream"}:   {Source: "stream", Value: map[string]interface{}{"kind": "A"}},
+			{Kind: "A", Source: "stream#1"}: {Source: "stream#1", Value: map[string]interface{}{"kind": "A"}},
+		}, objs)
+	})
+	t.Run("non-string keys", func(t *testing.T) {
+		found, err := Read(strings.NewReader("kind: ConfigMap\nmetadata: {name: a}\ndata:\n  1: foo\n"), "stream")
+		testutil.Ok(t, err)
+		rendered, err := Read(strings.NewReader("kind: ConfigMap\nmetadata: {name: a}\ndata:\n  1: bar\n"), "rendered")
+		testutil.Ok(t, err)
+		report, err := Compare(rendered, found)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(report.Changes))
+		testutil.Equals(t, Changed, report.Changes[0].Type)
+	})
+}
@@ -1,8 +1,263 @@
 package golang
 
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/efficientgo/tools/core/pkg/errcapture"
+	"github.com/efficientgo/tools/core/pkg/logerrcapture"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateAPI references Go struct that defines template values.
+// Values field names are taken from `json` tags. Fields without tags are named in lowerCamelCase e.g `PodLabelSelector`
+// is expected as `podLabelSelector`.
 type TemplateAPI struct {
 	// Default is a <full package path>.<public function> to be invoked to get valid struct filled in Entry
 	Default string
 	// Struct is a <full package path>.<public struct> name that should be used as the entry point for API struct.
 	Struct string
+
+	// Dir is a directory from which Go modules are looked up. ParseSpec sets it to the spec directory.
+	Dir string `yaml:"-"`
+}
+
+// Load resolves Go API into values schema and default values.
+// Since Go does not allow to load code dynamically, this builds and runs small program that inspects the API struct
+// using reflection. Program is written to a temporary directory and added to the module that contains API package
+// using build overlay, so it uses module's dependencies without writing anything into the module directory.
+// Similar approach to https://github.com/golang/mock/blob/master/mockgen/mockgen.go#L378.
+func Load(ctx context.Context, logger log.Logger, api TemplateAPI) (_ rndrapi.API, err error) {
+	structPkg, structName, err := splitRef(api.Struct)
+	if err != nil {
+		return rndrapi.API{}, errors.Wrap(err, "api.go.struct")
+	}
+
+	args := programArgs{StructPackage: structPkg, Struct: structName}
+	if api.Default != "" {
+		args.DefaultPackage, args.Default, err = splitRef(strings.TrimSuffix(api.Default, "()"))
+		if err != nil {
+			return rndrapi.API{}, errors.Wrap(err, "api.go.default")
+		}
+	}
+
+	modDir, err := findModule(api.Dir, structPkg)
+	if err != nil {
+		return rndrapi.API{}, err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "rndr-api-")
+	if err != nil {
+		return rndrapi.API{}, err
+	}
+	defer logerrcapture.Do(logger, func() error { return os.RemoveAll(tmpDir) }, "remove tmp dir")
+
+	if err := writeProgram(filepath.Join(tmpDir, "main.go"), args); err != nil {
+		return rndrapi.API{}, errors.Wrap(err, "write api program")
+	}
+	// Program package only exists in the overlay; nothing is created in the module directory.
+	pkgDir := "." + filepath.Base(tmpDir)
+	overlay, err := json.Marshal(map[string]map[string]string{
+		"Replace": {filepath.Join(modDir, pkgDir, "main.go"): filepath.Join(tmpDir, "main.go")},
+	})
+	if err != nil {
+		return rndrapi.API{}, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "overlay.json"), overlay, os.ModePerm); err != nil {
+		return rndrapi.API{}, errors.Wrap(err, "write overlay")
+	}
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "go", "run", "-overlay="+filepath.Join(tmpDir, "overlay.json"), "./"+pkgDir)
+	cmd.Dir = modDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	level.Debug(logger).Log("msg", "running Go API program", "dir", tmpDir)
+	if err := cmd.Run(); err != nil {
+		return rndrapi.API{}, errors.Wrapf(err, "run Go API program for %v; stderr: %v", api.Struct, stderr.String())
+	}
+
+	out := struct {
+		Schema  *rndrapi.Schema `json:"schema"`
+		Default interface{}     `json:"default"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return rndrapi.API{}, errors.Wrap(err, "parse Go API program output")
+	}
+
+	ret := rndrapi.API{Schema: out.Schema}
+	if out.Default != nil {
+		ret.Defaults, err = yaml.Marshal(out.Default)
+		if err != nil {
+			return rndrapi.API{}, err
+		}
+	}
+	return ret, nil
+}
+
+// splitRef splits <full package path>.<name> into package path and name.
+func splitRef(ref string) (pkg string, name string, _ error) {
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i < strings.LastIndex(ref, "/") || i == len(ref)-1 {
+		return "", "", errors.Errorf("expected <full package path>.<name>, got %q", ref)
+	}
+	return ref[:i], ref[i+1:], nil
+}
+
+// Sources returns Go files of packages with API struct and default function and of packages they transitively import
+// from the same module, together with go.mod and go.sum of the module, so changes to the API can be detected.
+func Sources(api TemplateAPI) ([]string, error) {
+	pkgs := []string{api.Struct}
+	if api.Default != "" {
+		pkgs = append(pkgs, strings.TrimSuffix(api.Default, "()"))
+	}
+
+	var ret []string
+	seen := map[string]struct{}{}
+	for _, ref := range pkgs {
+		pkg, _, err := splitRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		modDir, err := findModule(api.Dir, pkg)
+		if err != nil {
+			return nil, err
+		}
+		files, err := moduleDeps(modDir, pkg)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range []string{"go.mod", "go.sum"} {
+			if _, err := os.Stat(filepath.Join(modDir, f)); err == nil {
+				files = append(files, filepath.Join(modDir, f))
+			}
+		}
+		for _, f := range files {
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = struct{}{}
+			ret = append(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+// moduleDeps returns Go files of given package and packages it transitively imports from the module in modDir.
+func moduleDeps(modDir string, pkg string) ([]string, error) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd := exec.Command("go", "list", "-deps", "-json", pkg)
+	cmd.Dir = modDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "list dependencies of %v; stderr: %v", pkg, stderr.String())
+	}
+
+	var ret []string
+	d := json.NewDecoder(&stdout)
+	for {
+		p := struct {
+			Dir      string
+			GoFiles  []string
+			CgoFiles []string
+			Module   *struct{ Main bool }
+		}{}
+		if err := d.Decode(&p); err != nil {
+			if err == io.EOF {
+				return ret, nil
+			}
+			return nil, errors.Wrap(err, "parse go list output")
+		}
+		// Standard library and other modules are pinned by Go version and go.sum.
+		if p.Module == nil || !p.Module.Main {
+			continue
+		}
+		for _, f := range append(p.GoFiles, p.CgoFiles...) {
+			ret = append(ret, filepath.Join(p.Dir, f))
+		}
+	}
+}
+
+// findModule looks for local Go module that contains given package, starting from dir and going up.
+// It returns root directory of the module that package belongs to (it can be nested module).
+func findModule(dir string, pkg string) (string, error) {
+	pkgDir, err := packageDir(dir, pkg)
+	if err != nil {
+		return "", err
+	}
+	return nearestModule(pkgDir)
+}
+
+// packageDir looks for directory of given package in local Go modules, starting from dir and going up.
+func packageDir(dir string, pkg string) (string, error) {
+	d, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		modPath, err := modulePath(filepath.Join(d, "go.mod"))
+		if err != nil {
+			return "", err
+		}
+		if modPath != "" && (pkg == modPath || strings.HasPrefix(pkg, modPath+"/")) {
+			pkgDir := filepath.Join(d, filepath.FromSlash(strings.TrimPrefix(pkg, modPath)))
+			if s, err := os.Stat(pkgDir); err == nil && s.IsDir() {
+				return pkgDir, nil
+			}
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", errors.Errorf("package %v not found in any local Go module in %v or its parent directories", pkg, dir)
+		}
+		d = parent
+	}
+}
+
+func nearestModule(dir string) (string, error) {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", errors.Errorf("no go.mod found for %v", dir)
+		}
+		d = parent
+	}
+}
+
+// modulePath returns module path declared in given go.mod file or empty string if file does not exist.
+func modulePath(goMod string) (_ string, err error) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer errcapture.Do(&err, f.Close, "close go.mod")
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(l, "module") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(l, "module")), `"`), nil
+		}
+	}
+	return "", s.Err()
 }
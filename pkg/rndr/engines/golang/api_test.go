@@ -0,0 +1,76 @@
+package golang
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("not existing package", func(t *testing.T) {
+		_, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{Struct: "example.com/nope.Config", Dir: "testdata/api"})
+		testutil.NotOk(t, err)
+	})
+	t.Run("struct and default", func(t *testing.T) {
+		api, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{
+			Struct:  "example.com/api.Config",
+			Default: "example.com/api.Default()",
+			Dir:     "testdata/api",
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, &rndrapi.Schema{
+			Type:        "object",
+			Description: "Config configures example.",
+			Properties: map[string]*rndrapi.Schema{
+				"name":     {Type: "string", Description: "Name is a name of the deployment."},
+				"replicas": {Type: "integer", Format: "int64", Description: "Replicas is a number of pods."},
+				"port":     {Type: "integer", Format: "int32"},
+				"labels":   {Type: "object", AdditionalProperties: &rndrapi.Schema{Type: "string"}},
+				"limits": {
+					Type:        "object",
+					Description: "Limits are pod limits.",
+					Properties:  map[string]*rndrapi.Schema{"cpu": {Type: "number"}},
+					Required:    []string{"cpu"},
+					Nullable:    true,
+				},
+				"requests": {
+					Type:        "object",
+					Description: "Limits are resource limits.",
+					Properties:  map[string]*rndrapi.Schema{"cpu": {Type: "number"}},
+					Required:    []string{"cpu"},
+					Nullable:    true,
+				},
+				"extra":   {Type: "string"},
+				"version": {Type: "string", Description: "Version is a version of the image."},
+			},
+			Required: []string{"name", "replicas", "limits", "version"},
+		}, api.Schema)
+		testutil.Equals(t, "name: example\nport: 80\nreplicas: 1\nversion: \"1.8\"\n", string(api.Defaults))
+
+		// Nothing is written into the module.
+		files, err := ioutil.ReadDir("testdata/api")
+		testutil.Ok(t, err)
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		testutil.Equals(t, []string{"api.go", "go.mod", "version"}, names)
+	})
+}
+
+func TestSources(t *testing.T) {
+	files, err := Sources(TemplateAPI{Struct: "example.com/api.Config", Default: "example.com/api.Default()", Dir: "testdata/api"})
+	testutil.Ok(t, err)
+	dir, err := filepath.Abs("testdata/api")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{
+		filepath.Join(dir, "version", "version.go"),
+		filepath.Join(dir, "api.go"),
+		filepath.Join(dir, "go.mod"),
+	}, files)
+}
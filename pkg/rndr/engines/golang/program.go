@@ -0,0 +1,455 @@
+package golang
+
+import (
+	"os"
+	"text/template"
+
+	"github.com/efficientgo/tools/core/pkg/errcapture"
+)
+
+type programArgs struct {
+	StructPackage string
+	Struct        string
+
+	DefaultPackage string
+	Default        string
+}
+
+func writeProgram(file string, args programArgs) (err error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer errcapture.Do(&err, f.Close, "close program file")
+
+	return programTmpl.Execute(f, args)
+}
+
+// programTmpl is a Go program that prints JSON with schema of the API struct and result of Default function.
+// It has to depend on standard library only, as it's built within module of the API package.
+// It uses `[[` and `]]` delimiters, so Go composite literals do not need escaping.
+// NOTE(bwplotka): Naming rules has to be consistent with TemplateAPI documentation.
+var programTmpl = template.Must(template.New("").Delims("[[", "]]").Parse(`// Code generated by rndr. DO NOT EDIT.
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	apistruct "[[ .StructPackage ]]"
+[[- if .Default ]]
+	apidefault "[[ .DefaultPackage ]]"
+[[- end ]]
+)
+
+type schema struct {
+	Type                   string             ` + "`json:\"type,omitempty\"`" + `
+	Format                 string             ` + "`json:\"format,omitempty\"`" + `
+	Description            string             ` + "`json:\"description,omitempty\"`" + `
+	Properties             map[string]*schema ` + "`json:\"properties,omitempty\"`" + `
+	AdditionalProperties   *schema            ` + "`json:\"additionalProperties,omitempty\"`" + `
+	Items                  *schema            ` + "`json:\"items,omitempty\"`" + `
+	Required               []string           ` + "`json:\"required,omitempty\"`" + `
+	Nullable               bool               ` + "`json:\"nullable,omitempty\"`" + `
+	AnyOf                  []*schema          ` + "`json:\"anyOf,omitempty\"`" + `
+	XIntOrString           bool               ` + "`json:\"x-kubernetes-int-or-string,omitempty\"`" + `
+	XPreserveUnknownFields bool               ` + "`json:\"x-kubernetes-preserve-unknown-fields,omitempty\"`" + `
+}
+
+var (
+	jsonMarshaler   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	typ       reflect.Type
+
+	// goName and owner are Go name of the field and struct type that declares it, used to look its comment up.
+	goName string
+	owner  reflect.Type
+}
+
+type typeDoc struct {
+	doc    string
+	fields map[string]string
+}
+
+// docs are comments of struct types and their fields by package path and type name.
+var docs = map[string]map[string]typeDoc{}
+
+func docOf(t reflect.Type) typeDoc {
+	if t.PkgPath() == "" || t.Name() == "" {
+		return typeDoc{}
+	}
+	if _, ok := docs[t.PkgPath()]; !ok {
+		docs[t.PkgPath()] = parseDocs(t.PkgPath())
+	}
+	return docs[t.PkgPath()][t.Name()]
+}
+
+// parseDocs parses comments of struct types from the package source. Comments are nice to have, so packages
+// that can't be found or parsed have no comments.
+func parseDocs(pkgPath string) map[string]typeDoc {
+	ret := map[string]typeDoc{}
+	wd, err := os.Getwd()
+	if err != nil {
+		return ret
+	}
+	p, err := build.Import(pkgPath, wd, build.FindOnly)
+	if err != nil {
+		return ret
+	}
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(token.NewFileSet(), p.Dir, notTest, parser.ParseComments)
+	if err != nil {
+		return ret
+	}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, d := range f.Decls {
+				gd, ok := d.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					doc := ts.Doc
+					if doc == nil && len(gd.Specs) == 1 {
+						doc = gd.Doc
+					}
+					td := typeDoc{doc: doc.Text(), fields: map[string]string{}}
+					for _, sf := range st.Fields.List {
+						c := sf.Doc
+						if c == nil {
+							c = sf.Comment
+						}
+						for _, n := range sf.Names {
+							td.fields[n.Name] = c.Text()
+						}
+					}
+					ret[ts.Name.Name] = td
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// description returns comment as single line description and markers, which are comment lines starting with ` + "`+`" + `
+// e.g ` + "`+optional`" + `.
+func description(comment string) (string, []string) {
+	var lines, markers []string
+	for _, l := range strings.Split(comment, "\n") {
+		l = strings.TrimSpace(l)
+		switch {
+		case l == "":
+		case strings.HasPrefix(l, "+"):
+			markers = append(markers, l)
+		default:
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, " "), markers
+}
+
+// required returns if field is required. Fields are required unless they can be omitted in JSON or are nilable.
+// This can be overridden with ` + "`+optional`" + ` and ` + "`+required`" + ` markers (or their kubebuilder equivalents).
+func required(f field, markers []string) bool {
+	for _, m := range markers {
+		switch m {
+		case "+optional", "+kubebuilder:validation:Optional":
+			return false
+		case "+required", "+kubebuilder:validation:Required":
+			return true
+		}
+	}
+	return !f.omitEmpty && !nilable(f.typ)
+}
+
+func lowerCamel(s string) string {
+	r := []rune(s)
+	for i := 0; i < len(r); i++ {
+		if !unicode.IsUpper(r[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+func fields(t reflect.Type, index []int) []field {
+	var ret []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		idx := append(append([]int{}, index...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			ret = append(ret, fields(ft, idx)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = lowerCamel(f.Name)
+		}
+		omitEmpty := false
+		for _, o := range opts[1:] {
+			if o == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		ret = append(ret, field{name: name, index: idx, omitEmpty: omitEmpty, typ: f.Type, goName: f.Name, owner: t})
+	}
+	return ret
+}
+
+func nilable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+func describe(t reflect.Type, seen map[reflect.Type]bool) *schema {
+	if t.Kind() == reflect.Ptr {
+		s := describe(t.Elem(), seen)
+		s.Nullable = true
+		return s
+	}
+
+	switch t.PkgPath() + "." + t.Name() {
+	case "k8s.io/apimachinery/pkg/api/resource.Quantity", "k8s.io/apimachinery/pkg/util/intstr.IntOrString":
+		return &schema{AnyOf: []*schema{{Type: "integer"}, {Type: "string"}}, XIntOrString: true}
+	case "k8s.io/apimachinery/pkg/apis/meta/v1.Time", "time.Time":
+		return &schema{Type: "string", Format: "date-time"}
+	case "time.Duration":
+		return &schema{Type: "integer"}
+	}
+	if t.Implements(jsonUnmarshaler) || reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		return &schema{XPreserveUnknownFields: true}
+	}
+	if t.Implements(textUnmarshaler) || reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return &schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Raw bytes are expected as string.
+			return &schema{Type: "string"}
+		}
+		return &schema{Type: "array", Items: describe(t.Elem(), seen)}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: describe(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// Recursive type, we can't describe it further.
+			return &schema{Type: "object", XPreserveUnknownFields: true}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &schema{Type: "object", Properties: map[string]*schema{}}
+		s.Description, _ = description(docOf(t).doc)
+		for _, f := range fields(t, nil) {
+			fs := describe(f.typ, seen)
+			// Field comment is more specific than comment of the field type, so it's preferred.
+			d, markers := description(docOf(f.owner).fields[f.goName])
+			if d != "" {
+				fs.Description = d
+			}
+			s.Properties[f.name] = fs
+			if required(f, markers) {
+				s.Required = append(s.Required, f.name)
+			}
+		}
+		return s
+	default:
+		return &schema{XPreserveUnknownFields: true}
+	}
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p
+}
+
+// encode returns value in form that can be marshalled to JSON with field names following naming rules.
+// Nil pointers, maps, slices and interfaces are omitted.
+func encode(v reflect.Value) (interface{}, bool, error) {
+	if nilable(v.Type()) && v.IsNil() {
+		return nil, false, nil
+	}
+	if v.Type().Implements(jsonMarshaler) || reflect.PtrTo(v.Type()).Implements(jsonMarshaler) ||
+		v.Type().Implements(textMarshaler) || reflect.PtrTo(v.Type()).Implements(textMarshaler) {
+		b, err := json.Marshal(addressable(v).Interface())
+		if err != nil {
+			return nil, false, err
+		}
+		var o interface{}
+		if err := json.Unmarshal(b, &o); err != nil {
+			return nil, false, err
+		}
+		return o, true, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return encode(v.Elem())
+	case reflect.Struct:
+		ret := map[string]interface{}{}
+	fieldLoop:
+		for _, f := range fields(v.Type(), nil) {
+			fv := v
+			for _, i := range f.index {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						continue fieldLoop
+					}
+					fv = fv.Elem()
+				}
+				fv = fv.Field(i)
+			}
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			o, ok, err := encode(fv)
+			if err != nil {
+				return nil, false, fmt.Errorf("%v: %w", f.name, err)
+			}
+			if ok {
+				ret[f.name] = o
+			}
+		}
+		return ret, true, nil
+	case reflect.Map:
+		ret := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			o, ok, err := encode(iter.Value())
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				ret[fmt.Sprint(iter.Key().Interface())] = o
+			}
+		}
+		return ret, true, nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return string(b), true, nil
+		}
+		ret := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			o, _, err := encode(v.Index(i))
+			if err != nil {
+				return nil, false, err
+			}
+			ret = append(ret, o)
+		}
+		return ret, true, nil
+	default:
+		return v.Interface(), true, nil
+	}
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	out := struct {
+		Schema  *schema     ` + "`json:\"schema\"`" + `
+		Default interface{} ` + "`json:\"default,omitempty\"`" + `
+	}{}
+
+	t := reflect.TypeOf(apistruct.[[ .Struct ]]{})
+	out.Schema = describe(t, map[reflect.Type]bool{})
+[[- if .Default ]]
+
+	d := reflect.Indirect(reflect.ValueOf(apidefault.[[ .Default ]]()))
+	if d.Type() != t {
+		return fmt.Errorf("[[ .DefaultPackage ]].[[ .Default ]]() returns %v, expected [[ .StructPackage ]].[[ .Struct ]]", d.Type())
+	}
+	o, _, err := encode(d)
+	if err != nil {
+		return fmt.Errorf("encode default: %w", err)
+	}
+	out.Default = o
+[[- end ]]
+	return json.NewEncoder(os.Stdout).Encode(out)
+}
+`))
@@ -0,0 +1,36 @@
+package api
+
+import "example.com/api/version"
+
+// Config configures example.
+type Config struct {
+	// Name is a name of
+	// the deployment.
+	Name     string
+	Replicas int // Replicas is a number of pods.
+	// +optional
+	HTTPPort int32 `json:"port"`
+	Labels   map[string]string
+	// Limits are pod limits.
+	// +required
+	Limits   *Limits `json:"limits,omitempty"`
+	Requests *Limits `json:"requests,omitempty"`
+	Extra    []byte
+	Meta
+
+	ignored string
+}
+
+type Meta struct {
+	// Version is a version of the image.
+	Version string
+}
+
+// Limits are resource limits.
+type Limits struct {
+	CPU float64
+}
+
+func Default() Config {
+	return Config{Name: "example", Replicas: 1, HTTPPort: 80, Meta: Meta{Version: version.Default}, ignored: "x"}
+}
@@ -0,0 +1,4 @@
+package version
+
+// Default is a default version of the image.
+const Default = "1.8"
@@ -2,16 +2,192 @@ package helm
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/parametrize"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	k8syaml "sigs.k8s.io/yaml"
 )
 
 type PackageOptions struct {
+	// Version is a chart version. Defaults to 0.1.0.
+	Version string
+	// AppVersion is a version of the application the chart deploys.
+	AppVersion string `yaml:"appVersion"`
+	// Templatable is a list of dot separated values paths (e.g `replicas` or `ports.http`) that stay configurable
+	// through chart values. All other values are rendered with API defaults when packaging.
+	// Only string and number values that template puts verbatim in resources can be templated.
+	Templatable []string
+}
+
+// Package generates Helm chart in given directory. Chart templates contain resources rendered with API defaults, where
+// templatable values are replaced with references to chart values.
+func Package(ctx context.Context, logger log.Logger, name, author string, api rndrapi.API, render rndrapi.RenderFunc, opts PackageOptions, outDir string) (err error) {
+	defaults := map[string]interface{}{}
+	if err := yaml.Unmarshal(api.Defaults, &defaults); err != nil {
+		return errors.Wrap(err, "parse API defaults")
+	}
+
+	params, err := parametrize.New(api.Schema, defaults, opts.Templatable)
+	if err != nil {
+		return err
+	}
+	groups, err := params.Render(ctx, logger, render, defaults)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(outDir, "templates"), os.ModePerm); err != nil {
+		return err
+	}
+
+	meta := &chart.Metadata{
+		APIVersion:  chart.APIVersionV2,
+		Name:        name,
+		Description: fmt.Sprintf("A Helm chart for %s generated by rndr.", name),
+		Type:        "application",
+		Version:     opts.Version,
+		AppVersion:  opts.AppVersion,
+		Maintainers: maintainers(author),
+	}
+	if meta.Version == "" {
+		meta.Version = "0.1.0"
+	}
+	if err := meta.Validate(); err != nil {
+		return errors.Wrap(err, "validate Chart.yaml")
+	}
+	// Chart metadata has JSON tags only.
+	b, err := k8syaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(outDir, chartfileName), b, os.ModePerm); err != nil {
+		return err
+	}
 
+	values := map[string]interface{}{}
+	for _, p := range params {
+		if p.Default != nil {
+			parametrize.Set(values, p.Path, p.Default)
+		}
+	}
+	if err := writeYAML(filepath.Join(outDir, "values.yaml"), values); err != nil {
+		return err
+	}
+
+	b, err = json.MarshalIndent(valuesSchema(params), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(outDir, "values.schema.json"), append(b, '\n'), os.ModePerm); err != nil {
+		return err
+	}
+
+	groupNames := make([]string, 0, len(groups))
+	for g := range groups {
+		groupNames = append(groupNames, g)
+	}
+	sort.Strings(groupNames)
+
+	for _, g := range groupNames {
+		for i, r := range groups[g] {
+			o, err := params.Replace(r.Object, escapeTemplate, valuesRef)
+			if err != nil {
+				return errors.Wrapf(err, "template %v from %v group", r.Item, g)
+			}
+			if err := ioutil.WriteFile(filepath.Join(outDir, "templates", fmt.Sprintf("%s-%d-%s.yaml", g, i, r.Item)), o, os.ModePerm); err != nil {
+				return err
+			}
+		}
+	}
+	level.Info(logger).Log("msg", "generated helm chart", "dir", outDir, "templatable", strings.Join(opts.Templatable, ","))
+	return nil
 }
 
-func Package(_ context.Context, logger log.Logger, name, author string, opts PackageOptions, outDir string) (err error) {
-	return errors.New("not implemented")
+const chartfileName = "Chart.yaml"
+
+// maintainers parses author(s) in form of RFC 5322 address list e.g `Team <team@example.com>, other@example.com`.
+// If that fails, author is used as maintainer name.
+func maintainers(author string) []*chart.Maintainer {
+	addrs, err := mail.ParseAddressList(author)
+	if err != nil {
+		return []*chart.Maintainer{{Name: author}}
+	}
+	ret := make([]*chart.Maintainer, 0, len(addrs))
+	for _, a := range addrs {
+		m := &chart.Maintainer{Name: a.Name, Email: a.Address}
+		if m.Name == "" {
+			m.Name = a.Address
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
 
-}
\ No newline at end of file
+// escapeTemplate makes sure Go template actions that might be part of the resources (e.g in Prometheus alerts) are
+// printed as is by Helm.
+func escapeTemplate(s string) string {
+	return strings.ReplaceAll(s, "{{", `{{ "{{" }}`)
+}
+
+func valuesRef(p parametrize.Parameter, whole bool) string {
+	ref := ".Values." + p.Path
+	if strings.ContainsAny(p.Path, "-/") {
+		ref = fmt.Sprintf("(index .Values %s)", quotedPath(p.Path))
+	}
+	if whole && p.Schema.Type == "string" {
+		return fmt.Sprintf("{{ %s | quote }}", ref)
+	}
+	return fmt.Sprintf("{{ %s }}", ref)
+}
+
+func quotedPath(path string) string {
+	parts := strings.Split(path, ".")
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%q", parts[i])
+	}
+	return strings.Join(parts, " ")
+}
+
+// valuesSchema returns JSON Schema for chart values.yaml containing only templatable values.
+func valuesSchema(params parametrize.Parameters) *rndrapi.Schema {
+	root := &rndrapi.Schema{Type: "object", Properties: map[string]*rndrapi.Schema{}}
+	for _, p := range params {
+		s := root
+		parts := strings.Split(p.Path, ".")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := s.Properties[part]
+			if !ok {
+				child = &rndrapi.Schema{Type: "object", Properties: map[string]*rndrapi.Schema{}}
+				s.Properties[part] = child
+			}
+			s = child
+		}
+		last := parts[len(parts)-1]
+		s.Properties[last] = &rndrapi.Schema{Type: p.Schema.Type, Description: p.Schema.Description, Enum: p.Schema.Enum}
+		if p.Default != nil {
+			s.Required = append(s.Required, last)
+		}
+	}
+	return root
+}
+
+func writeYAML(file string, o interface{}) error {
+	b, err := yaml.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, os.ModePerm)
+}
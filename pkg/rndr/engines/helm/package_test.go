@@ -0,0 +1,88 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-helm-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type: "object",
+			Properties: map[string]*rndrapi.Schema{
+				"name":     {Type: "string"},
+				"version":  {Type: "string"},
+				"replicas": {Type: "integer"},
+				"message":  {Type: "string"},
+			},
+		},
+		Defaults: []byte("name: example\nversion: \"1.8\"\nreplicas: 1\nmessage: '{{ hello }}'\n"),
+	}
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		v := struct {
+			Name, Version, Message string
+			Replicas               int
+		}{}
+		if err := yaml.Unmarshal(valuesYAML, &v); err != nil {
+			return nil, err
+		}
+		return rndrapi.Groups{"hello": {{Item: "deployment", Object: []byte(fmt.Sprintf(`kind: Deployment
+metadata:
+  name: %s
+  annotations:
+    message: '%s'
+spec:
+  replicas: %d
+  image: hello:%s
+`, v.Name, v.Message, v.Replicas, v.Version))}}}, nil
+	}
+
+	testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hellosvc", "Team <team@example.com>", api, render, PackageOptions{
+		AppVersion:  "1.8",
+		Templatable: []string{"name", "version", "replicas"},
+	}, dir))
+
+	b, err := ioutil.ReadFile(dir + "/values.yaml")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "name: example\nreplicas: 1\nversion: \"1.8\"\n", string(b))
+
+	// Generated chart has to reproduce template output.
+	groups, err := Render(log.NewNopLogger(), "test", TemplateRenderer{Chart: dir}, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, rndrapi.Groups{"hellosvc": {{Item: "hello-0-deployment", Object: []byte(`kind: Deployment
+metadata:
+  name: "example"
+  annotations:
+    message: '{{ hello }}'
+spec:
+  replicas: 1
+  image: "hello:1.8"
+`)}}}, groups)
+
+	groups, err = Render(log.NewNopLogger(), "test", TemplateRenderer{Chart: dir}, []byte("name: special\nversion: \"1.9\"\nreplicas: 3\n"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, rndrapi.Groups{"hellosvc": {{Item: "hello-0-deployment", Object: []byte(`kind: Deployment
+metadata:
+  name: "special"
+  annotations:
+    message: '{{ hello }}'
+spec:
+  replicas: 3
+  image: "hello:1.9"
+`)}}}, groups)
+
+	_, err = Render(log.NewNopLogger(), "test", TemplateRenderer{Chart: dir}, []byte("replicas: many\n"))
+	testutil.NotOk(t, err)
+}
@@ -1,20 +1,247 @@
 package helm
 
 import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
 type TemplateRenderer struct {
-	// Chart is a chart name.
+	// Chart is a chart name if repo is specified. Otherwise it's a local or absolute path to the chart directory
+	// or packaged chart (.tgz).
 	Chart string
-	// Repo is an URL to the chart repository if remote.
+	// Repo is an URL to the chart repository if remote. It can be also a local or absolute path to the directory with
+	// repository index.yaml.
+	// For remote repositories chart is looked up in the local helm repository cache (same as `helm repo add/update`
+	// and `helm pull` use), so no network calls are made while rendering.
 	Repo string
 	// Version is a chart version within the repo.
 	Version string
 }
 
-func Render(logger log.Logger, name string, c TemplateRenderer, valuesJSON []byte) (groups rndrapi.Groups, err error) {
-	return nil, errors.Errorf("helm renderer is not implemented")
+// Render renders chart with values YAML used as chart values. Rendered manifests are grouped by chart and subchart
+// e.g `mychart` and `mychart-subchart`.
+func Render(logger log.Logger, name string, c TemplateRenderer, valuesYAML []byte) (groups rndrapi.Groups, err error) {
+	chartPath, err := locateChart(c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "locate chart from options %+v", c)
+	}
+
+	level.Debug(logger).Log("msg", "loading chart", "path", chartPath)
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load chart %v", chartPath)
+	}
+	if err := chrt.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "validate chart %v", chartPath)
+	}
+	if chrt.Metadata.Type == "library" {
+		return nil, errors.Errorf("chart %v is a library chart and cannot be rendered", chrt.Name())
+	}
+
+	vals, err := chartutil.ReadValues(valuesYAML)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse values")
+	}
+	if err := chartutil.ProcessDependencies(chrt, vals); err != nil {
+		return nil, errors.Wrap(err, "process chart dependencies")
+	}
+
+	renderVals, err := chartutil.ToRenderValues(chrt, vals, chartutil.ReleaseOptions{
+		Name:      name,
+		Namespace: "default",
+		Revision:  1,
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := engine.Render(chrt, renderVals)
+	if err != nil {
+		return nil, errors.Wrapf(err, "render chart %v", chrt.Name())
+	}
+	return splitManifests(files)
+}
+
+// splitManifests splits rendered template files into resources grouped by (sub)chart they come from.
+func splitManifests(files map[string]string) (rndrapi.Groups, error) {
+	fileNames := make([]string, 0, len(files))
+	for f := range files {
+		fileNames = append(fileNames, f)
+	}
+	sort.Strings(fileNames)
+
+	groups := rndrapi.Groups{}
+	for _, f := range fileNames {
+		// Skip partials and notes, those are never manifests.
+		if strings.HasPrefix(path.Base(f), "_") || strings.HasSuffix(f, "NOTES.txt") {
+			continue
+		}
+
+		i := strings.Index(f, "/templates/")
+		if i < 0 {
+			return nil, errors.Errorf("unexpected template path %v", f)
+		}
+		group := strings.ReplaceAll(f[:i], "/charts/", "-")
+		item := strings.TrimSuffix(path.Base(f), path.Ext(f))
+
+		manifests := releaseutil.SplitManifests(files[f])
+		keys := make([]string, 0, len(manifests))
+		for k := range manifests {
+			keys = append(keys, k)
+		}
+		sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+		var docs [][]byte
+		for _, k := range keys {
+			var o interface{}
+			if err := yaml.Unmarshal([]byte(manifests[k]), &o); err != nil {
+				return nil, errors.Wrapf(err, "parse manifest rendered from %v", f)
+			}
+			// Templates that are conditionally disabled render to nothing or comments only.
+			if o == nil {
+				continue
+			}
+			docs = append(docs, []byte(manifests[k]+"\n"))
+		}
+
+		for j, d := range docs {
+			it := item
+			if len(docs) > 1 {
+				it = fmt.Sprintf("%s-%d", item, j)
+			}
+			groups[group] = append(groups[group], rndrapi.Resource{Item: it, Object: d})
+		}
+	}
+	if len(groups) == 0 {
+		return nil, errors.New("no resources rendered by chart")
+	}
+	return groups, nil
+}
+
+// Sources returns files of the chart, so changes to it can be detected. Packaged chart is a single file.
+func Sources(c TemplateRenderer) ([]string, error) {
+	chartPath, err := locateChart(c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "locate chart from options %+v", c)
+	}
+	var ret []string
+	if err := filepath.Walk(chartPath, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			ret = append(ret, f)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// locateChart returns local path to chart directory or archive.
+func locateChart(c TemplateRenderer) (string, error) {
+	if c.Chart == "" {
+		return "", errors.New("chart not specified")
+	}
+	if c.Repo == "" {
+		if _, err := os.Stat(c.Chart); err != nil {
+			return "", err
+		}
+		return c.Chart, nil
+	}
+
+	var (
+		index *repo.IndexFile
+		dir   string
+		err   error
+	)
+	if u, perr := url.Parse(c.Repo); perr == nil && u.Scheme != "" && u.Scheme != "file" {
+		// Remote repository. Rely on index and charts cached by helm CLI.
+		index, err = loadCachedIndex(c.Repo)
+		if err != nil {
+			return "", err
+		}
+		dir = repositoryCache()
+	} else {
+		dir = strings.TrimPrefix(c.Repo, "file://")
+		index, err = repo.LoadIndexFile(filepath.Join(dir, "index.yaml"))
+		if err != nil {
+			return "", errors.Wrapf(err, "load index of local repository %v", dir)
+		}
+	}
+
+	cv, err := index.Get(c.Chart, c.Version)
+	if err != nil {
+		return "", errors.Wrapf(err, "find chart %v in version %q within %v", c.Chart, c.Version, c.Repo)
+	}
+
+	candidates := []string{filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", cv.Name, cv.Version))}
+	for _, u := range cv.URLs {
+		p, err := url.Parse(u)
+		if err != nil {
+			continue
+		}
+		if !p.IsAbs() {
+			candidates = append(candidates, filepath.Join(dir, filepath.FromSlash(p.Path)))
+		}
+		candidates = append(candidates, filepath.Join(dir, path.Base(p.Path)))
+	}
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.Errorf("chart %v-%v was found in repository index, but its archive is not present in %v. "+
+		"Pull it first e.g. using `helm pull %v --version %v --destination %v`", cv.Name, cv.Version, dir, c.Chart, cv.Version, dir)
+}
+
+// loadCachedIndex loads index for remote repository with given URL from helm repository cache.
+func loadCachedIndex(repoURL string) (*repo.IndexFile, error) {
+	configPath := helmEnvOr("HELM_REPOSITORY_CONFIG", helmpath.ConfigPath("repositories.yaml"))
+	repos, err := repo.LoadFile(configPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load helm repositories file %v", configPath)
+	}
+	for _, r := range repos.Repositories {
+		if strings.TrimSuffix(r.URL, "/") != strings.TrimSuffix(repoURL, "/") {
+			continue
+		}
+		indexPath := filepath.Join(repositoryCache(), helmpath.CacheIndexFile(r.Name))
+		index, err := repo.LoadIndexFile(indexPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "load cached index for repository %v; run `helm repo update` first", r.Name)
+		}
+		return index, nil
+	}
+	return nil, errors.Errorf("repository %v not found in %v; add it first using `helm repo add <name> %v`", repoURL, configPath, repoURL)
+}
+
+func repositoryCache() string {
+	return helmEnvOr("HELM_REPOSITORY_CACHE", helmpath.CachePath("repository"))
+}
+
+func helmEnvOr(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
 }
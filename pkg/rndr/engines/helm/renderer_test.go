@@ -0,0 +1,34 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestRender(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		groups, err := Render(log.NewNopLogger(), "test", TemplateRenderer{Chart: "testdata/hello"}, nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, rndrapi.Groups{"hello": {
+			{Item: "deployment", Object: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-hello\nspec:\n  replicas: 1\n")},
+			{Item: "service-0", Object: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: test-http\n")},
+			{Item: "service-1", Object: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: test-grpc\n")},
+		}}, groups)
+	})
+	t.Run("values with subchart enabled", func(t *testing.T) {
+		groups, err := Render(log.NewNopLogger(), "test", TemplateRenderer{Chart: "testdata/hello"}, []byte("replicas: 3\ndb:\n  enabled: true\n"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, 2, len(groups))
+		testutil.Equals(t, []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-hello\nspec:\n  replicas: 3\n"), groups["hello"][0].Object)
+		testutil.Equals(t, []rndrapi.Resource{
+			{Item: "statefulset", Object: []byte("apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: test-db\n")},
+		}, groups["hello-db"])
+	})
+	t.Run("not existing chart", func(t *testing.T) {
+		_, err := Render(log.NewNopLogger(), "test", TemplateRenderer{Chart: "testdata/nope"}, nil)
+		testutil.NotOk(t, err)
+	})
+}
@@ -0,0 +1,360 @@
+package jsonnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/parametrize"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+type PackageOptions struct {
+	// Vendor controls if template code is vendored into the library, so all values stay configurable. Only jsonnet
+	// templates can be vendored. Otherwise library embeds resources rendered with Values, where only Parameters stay
+	// configurable.
+	Vendor bool
+	// Values is a path to values YAML file resources are rendered with, if template is not vendored. API defaults are
+	// used for values not specified there.
+	Values string
+	// Parameters is a list of dot separated values paths (e.g `replicas` or `ports.http`) that stay configurable through
+	// library values, if template is not vendored. Only string and number values that template puts verbatim in resources
+	// can be parameters.
+	Parameters []string
+}
+
+const (
+	mainFile        = "main.libsonnet"
+	valuesFile      = "values.libsonnet"
+	jsonnetfileFile = "jsonnetfile.json"
+	templateDir     = "template"
+)
+
+// Package generates jsonnet-bundler (https://github.com/jsonnet-bundler/jsonnet-bundler) compatible library in given
+// directory. Library `main.libsonnet` is a `function(values={})` that returns object with resources by their item names,
+// for values merged into defaults from `values.libsonnet`.
+func Package(ctx context.Context, logger log.Logger, name string, api rndrapi.API, renderer *TemplateRenderer, render rndrapi.RenderFunc, opts PackageOptions, outDir string) error {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	var (
+		main, values bytes.Buffer
+		deps         json.RawMessage
+		err          error
+	)
+	fmt.Fprintf(&main, "// Code generated by rndr. DO NOT EDIT.\n// %s library. Values are merged into defaults from %s.\n", name, valuesFile)
+	fmt.Fprintf(&main, "local defaults = import '%s';\n\nfunction(values={}) (\n  local v = std.mergePatch(defaults, values);\n", valuesFile)
+	if opts.Vendor {
+		if renderer == nil {
+			return errors.New("only jsonnet template can be vendored")
+		}
+		if opts.Values != "" || len(opts.Parameters) > 0 {
+			return errors.New("values and parameters can't be used when vendoring template, since all values are configurable")
+		}
+		deps, err = vendorTemplate(logger, *renderer, &main, outDir)
+		if err != nil {
+			return err
+		}
+		defaults := map[string]interface{}{}
+		if err := yaml.Unmarshal(api.Defaults, &defaults); err != nil {
+			return errors.Wrap(err, "parse API defaults")
+		}
+		writeValues(&values, api.Schema, defaults, "")
+	} else {
+		if err := embedResources(ctx, logger, api, render, opts, &main, &values); err != nil {
+			return err
+		}
+	}
+	main.WriteString(")\n")
+	values.WriteString("\n")
+
+	if len(deps) == 0 {
+		deps = json.RawMessage("[]")
+	}
+	b, err := json.MarshalIndent(struct {
+		Version       int             `json:"version"`
+		Dependencies  json.RawMessage `json:"dependencies"`
+		LegacyImports bool            `json:"legacyImports"`
+	}{Version: 1, Dependencies: deps, LegacyImports: true}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for f, content := range map[string][]byte{
+		mainFile:        main.Bytes(),
+		valuesFile:      values.Bytes(),
+		jsonnetfileFile: append(b, '\n'),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(outDir, f), content, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	level.Info(logger).Log("msg", "generated jsonnet library", "dir", outDir, "vendor", opts.Vendor, "parameters", strings.Join(opts.Parameters, ","))
+	return nil
+}
+
+// vendorTemplate copies template jsonnet files into the library and writes their invocation. Files from `vendor` are
+// not copied; dependencies from `jsonnetfile.json` next to the first function file are returned instead, so they are
+// installed by jsonnet-bundler together with the library.
+func vendorTemplate(logger log.Logger, r TemplateRenderer, main *bytes.Buffer, outDir string) (json.RawMessage, error) {
+	if len(r.Functions) == 0 {
+		return nil, errors.New("jsonnet template has no functions")
+	}
+	deps, err := Dependencies(r)
+	if err != nil {
+		return nil, err
+	}
+	functions := make([]string, 0, len(r.Functions))
+	for _, f := range r.Functions {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, abs)
+	}
+	vendor, err := r.VendorDir()
+	if err != nil {
+		return nil, err
+	}
+	rel, err := RelativePaths(vendor, append(append([]string{}, functions...), deps...))
+	if err != nil {
+		return nil, err
+	}
+
+	vendored := false
+	for f, r := range rel {
+		if strings.HasPrefix(r, "vendor/") {
+			vendored = true
+			continue
+		}
+		dst := filepath.Join(outDir, templateDir, filepath.FromSlash(r))
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(dst, b, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	main.WriteString("  local groups = [\n")
+	for _, f := range functions {
+		imp := templateDir + "/" + rel[f]
+		if strings.HasPrefix(rel[f], "vendor/") {
+			imp = strings.TrimPrefix(rel[f], "vendor/")
+		}
+		fmt.Fprintf(main, "    (import '%s')(v),\n", imp)
+	}
+	main.WriteString("  ];\n  std.foldl(function(objects, g) objects + g, groups, {})\n")
+
+	var jbDeps json.RawMessage
+	jf := filepath.Join(filepath.Dir(functions[0]), jsonnetfileFile)
+	b, err := ioutil.ReadFile(jf)
+	switch {
+	case os.IsNotExist(err):
+		if vendored {
+			level.Warn(logger).Log("msg", "template imports files from vendor, but there is no jsonnetfile.json next to it; library dependencies have to be installed manually", "file", jf)
+		}
+	case err != nil:
+		return nil, err
+	default:
+		f := struct {
+			Dependencies json.RawMessage `json:"dependencies"`
+		}{}
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, errors.Wrapf(err, "parse %v", jf)
+		}
+		jbDeps = f.Dependencies
+	}
+	return jbDeps, nil
+}
+
+// embedResources writes resources rendered with values, where parameters are replaced with references to library values.
+// Library values contain parameters only.
+func embedResources(ctx context.Context, logger log.Logger, api rndrapi.API, render rndrapi.RenderFunc, opts PackageOptions, main, values *bytes.Buffer) error {
+	var valuesYAML []byte
+	if opts.Values != "" {
+		b, err := ioutil.ReadFile(opts.Values)
+		if err != nil {
+			return errors.Wrap(err, "read values")
+		}
+		valuesYAML = b
+	}
+	merged, err := rndrapi.MergeValues(api.Defaults, valuesYAML)
+	if err != nil {
+		return err
+	}
+	vals := map[string]interface{}{}
+	if err := yaml.Unmarshal(merged, &vals); err != nil {
+		return errors.Wrap(err, "parse values")
+	}
+
+	params, err := parametrize.New(api.Schema, vals, opts.Parameters)
+	if err != nil {
+		return err
+	}
+	groups, err := params.Render(ctx, logger, render, vals)
+	if err != nil {
+		return err
+	}
+
+	markers := map[string]int{}
+	for i, p := range params {
+		markers[p.Path] = i
+	}
+	marker := func(p parametrize.Parameter, whole bool) string {
+		if whole {
+			return fmt.Sprintf("RNDRJSONNETPARAM%dW", markers[p.Path])
+		}
+		return fmt.Sprintf("RNDRJSONNETPARAM%dP", markers[p.Path])
+	}
+
+	groupNames := make([]string, 0, len(groups))
+	for g := range groups {
+		groupNames = append(groupNames, g)
+	}
+	sort.Strings(groupNames)
+
+	items := map[string]string{}
+	main.WriteString("  {\n")
+	for _, g := range groupNames {
+		for _, r := range groups[g] {
+			if other, ok := items[r.Item]; ok {
+				return errors.Errorf("%v from %v and %v groups have the same name; library object can have only one of them", r.Item, other, g)
+			}
+			items[r.Item] = g
+
+			o, err := params.Replace(r.Object, nil, marker)
+			if err != nil {
+				return errors.Wrapf(err, "parametrize %v from %v group", r.Item, g)
+			}
+			j, err := k8syaml.YAMLToJSON(o)
+			if err != nil {
+				return errors.Wrapf(err, "convert %v from %v group to JSON", r.Item, g)
+			}
+			b := bytes.Buffer{}
+			if err := json.Indent(&b, j, "    ", "  "); err != nil {
+				return err
+			}
+			out := b.String()
+			for i, p := range params {
+				out = strings.ReplaceAll(out, fmt.Sprintf(`"RNDRJSONNETPARAM%dW"`, i), "v"+fieldPath(p.Path))
+				out = strings.ReplaceAll(out, fmt.Sprintf(`RNDRJSONNETPARAM%dP`, i), fmt.Sprintf(`" + v%s + "`, fieldPath(p.Path)))
+			}
+			fmt.Fprintf(main, "    %s: %s,\n", fieldName(r.Item), out)
+		}
+	}
+	main.WriteString("  }\n")
+
+	defaults := map[string]interface{}{}
+	for _, p := range params {
+		if p.Default != nil {
+			parametrize.Set(defaults, p.Path, p.Default)
+		}
+	}
+	writeValues(values, api.Schema, defaults, "")
+	return nil
+}
+
+// writeValues writes values as jsonnet. Object fields described by schema have comments with their description and type.
+func writeValues(b *bytes.Buffer, s *rndrapi.Schema, v interface{}, indent string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		j, _ := json.Marshal(v)
+		b.Write(j)
+		return
+	}
+	if len(m) == 0 {
+		b.WriteString("{}")
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b.WriteString("{\n")
+	for _, k := range keys {
+		var child *rndrapi.Schema
+		if s != nil {
+			child = s.Properties[k]
+			if child == nil {
+				child = s.AdditionalProperties
+			} else {
+				if child.Description != "" {
+					fmt.Fprintf(b, "%s  // %s\n", indent, child.Description)
+				}
+				fmt.Fprintf(b, "%s  // Type: %s.\n", indent, typeOf(child))
+			}
+		}
+		fmt.Fprintf(b, "%s  %s: ", indent, fieldName(k))
+		writeValues(b, child, m[k], indent+"  ")
+		b.WriteString(",\n")
+	}
+	b.WriteString(indent + "}")
+}
+
+func typeOf(s *rndrapi.Schema) string {
+	switch {
+	case s.XIntOrString:
+		return "integer or string"
+	case s.Type == "array" && s.Items != nil:
+		return "array of " + typeOf(s.Items)
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map of " + typeOf(s.AdditionalProperties)
+	case s.Type == "":
+		return "any"
+	default:
+		return s.Type
+	}
+}
+
+var (
+	identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	keywords   = map[string]bool{
+		"assert": true, "else": true, "error": true, "false": true, "for": true, "function": true, "if": true,
+		"import": true, "importstr": true, "importbin": true, "in": true, "local": true, "null": true, "tailstrict": true,
+		"then": true, "self": true, "super": true, "true": true,
+	}
+)
+
+// fieldName returns jsonnet object field name, quoted if needed.
+func fieldName(k string) string {
+	if identifier.MatchString(k) && !keywords[k] {
+		return k
+	}
+	b, _ := json.Marshal(k)
+	return string(b)
+}
+
+// fieldPath returns jsonnet field access expression for dot separated values path e.g `.ports.http`.
+func fieldPath(path string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(path, ".") {
+		if identifier.MatchString(p) && !keywords[p] {
+			b.WriteString("." + p)
+			continue
+		}
+		q, _ := json.Marshal(p)
+		fmt.Fprintf(&b, "[%s]", q)
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package jsonnet
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	gojsonnet "github.com/google/go-jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-jsonnet-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "tmpl", "lib"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "tmpl", "lib", "labels.libsonnet"), []byte("function(name) { app: name }\n"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "tmpl", "jsonnetfile.json"), []byte(`{"version": 1, "dependencies": [{"source": {"local": {"directory": "lib"}}, "version": ""}]}`), os.ModePerm))
+	fn := filepath.Join(dir, "tmpl", "hello.libsonnet")
+	testutil.Ok(t, ioutil.WriteFile(fn, []byte(`local labels = import 'lib/labels.libsonnet';
+function(values) {
+  deployment: {
+    apiVersion: 'apps/v1',
+    kind: 'Deployment',
+    metadata: { name: values.name, namespace: values.namespace, labels: labels(values.name) },
+    spec: { replicas: values.replicas },
+  },
+  'config-map': {
+    apiVersion: 'v1',
+    kind: 'ConfigMap',
+    metadata: { name: values.name + '-config', namespace: values.namespace },
+    data: { port: std.toString(values.ports.http) },
+  },
+}
+`), os.ModePerm))
+
+	renderer := TemplateRenderer{Functions: []string{fn}}
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type:     "object",
+			Required: []string{"name", "namespace", "replicas", "ports"},
+			Properties: map[string]*rndrapi.Schema{
+				"name":      {Type: "string", Description: "Name of the deployment."},
+				"namespace": {Type: "string"},
+				"replicas":  {Type: "integer"},
+				"ports": {
+					Type:       "object",
+					Properties: map[string]*rndrapi.Schema{"http": {Type: "integer"}},
+				},
+			},
+		},
+		Defaults: []byte("name: example\nnamespace: default\nreplicas: 1\nports:\n  http: 80\n"),
+	}
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		v, err := rndrapi.MergeValues(api.Defaults, valuesYAML)
+		if err != nil {
+			return nil, err
+		}
+		return Render(log.NewNopLogger(), "hello", renderer, v)
+	}
+
+	// evaluate returns objects returned by the library for given values, and objects rendered by the template.
+	evaluate := func(t *testing.T, lib string, values string, renderValues string) (got map[string]interface{}, expected map[string]interface{}) {
+		t.Helper()
+
+		vm := gojsonnet.MakeVM()
+		vm.Importer(&gojsonnet.FileImporter{JPaths: []string{dir}})
+		out, err := vm.EvaluateAnonymousSnippet("test.jsonnet", "(import '"+lib+"/main.libsonnet')("+values+")")
+		testutil.Ok(t, err)
+		testutil.Ok(t, json.Unmarshal([]byte(out), &got))
+
+		groups, err := render(context.Background(), []byte(renderValues))
+		testutil.Ok(t, err)
+		expected = map[string]interface{}{}
+		for _, r := range groups["hello"] {
+			o := map[string]interface{}{}
+			testutil.Ok(t, yaml.Unmarshal(r.Object, &o))
+			// Compare through JSON, so numbers have the same type.
+			b, err := json.Marshal(o)
+			testutil.Ok(t, err)
+			var j interface{}
+			testutil.Ok(t, json.Unmarshal(b, &j))
+			expected[r.Item] = j
+		}
+		return got, expected
+	}
+
+	t.Run("vendor", func(t *testing.T) {
+		out := filepath.Join(dir, "vendored")
+		testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hello", api, &renderer, render, PackageOptions{Vendor: true}, out))
+
+		for _, f := range []string{"main.libsonnet", "values.libsonnet", "jsonnetfile.json", "template/hello.libsonnet", "template/lib/labels.libsonnet"} {
+			_, err := os.Stat(filepath.Join(out, f))
+			testutil.Ok(t, err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(out, "values.libsonnet"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, `{
+  // Name of the deployment.
+  // Type: string.
+  name: "example",
+  // Type: string.
+  namespace: "default",
+  // Type: object.
+  ports: {
+    // Type: integer.
+    http: 80,
+  },
+  // Type: integer.
+  replicas: 1,
+}
+`, string(b))
+		b, err = ioutil.ReadFile(filepath.Join(out, "jsonnetfile.json"))
+		testutil.Ok(t, err)
+		jf := struct{ Dependencies []interface{} }{}
+		testutil.Ok(t, json.Unmarshal(b, &jf))
+		testutil.Equals(t, 1, len(jf.Dependencies))
+
+		got, expected := evaluate(t, "vendored", "{}", "")
+		testutil.Equals(t, expected, got)
+		got, expected = evaluate(t, "vendored", "{ name: 'custom', ports: { http: 8080 } }", "name: custom\nports:\n  http: 8080\n")
+		testutil.Equals(t, expected, got)
+	})
+	t.Run("vendor with parameters", func(t *testing.T) {
+		testutil.NotOk(t, Package(context.Background(), log.NewNopLogger(), "hello", api, &renderer, render, PackageOptions{Vendor: true, Parameters: []string{"name"}}, filepath.Join(dir, "err")))
+	})
+	t.Run("vendor without jsonnet renderer", func(t *testing.T) {
+		testutil.NotOk(t, Package(context.Background(), log.NewNopLogger(), "hello", api, nil, render, PackageOptions{Vendor: true}, filepath.Join(dir, "err")))
+	})
+	t.Run("rendered", func(t *testing.T) {
+		values := filepath.Join(dir, "values.yaml")
+		testutil.Ok(t, ioutil.WriteFile(values, []byte("namespace: special\nports:\n  http: 8080\n"), os.ModePerm))
+
+		out := filepath.Join(dir, "rendered")
+		testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hello", api, nil, render, PackageOptions{
+			Values:     values,
+			Parameters: []string{"name", "replicas"},
+		}, out))
+
+		b, err := ioutil.ReadFile(filepath.Join(out, "values.libsonnet"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, "{\n  // Name of the deployment.\n  // Type: string.\n  name: \"example\",\n  // Type: integer.\n  replicas: 1,\n}\n", string(b))
+
+		got, expected := evaluate(t, "rendered", "{}", "namespace: special\nports:\n  http: 8080\n")
+		testutil.Equals(t, expected, got)
+		got, expected = evaluate(t, "rendered", "{ name: 'custom', replicas: 3 }", "name: custom\nreplicas: 3\nnamespace: special\nports:\n  http: 8080\n")
+		testutil.Equals(t, expected, got)
+	})
+}
@@ -3,9 +3,13 @@ package jsonnet
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -15,6 +19,7 @@ import (
 	"github.com/efficientgo/tools/core/pkg/logerrcapture"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	gojsonnet "github.com/google/go-jsonnet"
 	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -31,7 +36,7 @@ type TemplateRenderer struct {
 // TODO(bwplotka): I assume rollout groups allows paralelism. Check that.
 // See https://github.com/brancz/locutus/issues/38 for more details.
 var applyAllLocutusJsonnetTmpl = template.Must(template.New("").Parse(`
-local values = import '{{ .LocutusVirtualConfigPath }}';
+local values = {{ .Values }};
 
 local groups = {
 {{- range .Groups }}
@@ -41,31 +46,31 @@ local groups = {
 
 {
   objects: {
-		[g + '#' + item]: groups[g]
-		for g in std.objectFields(groups)
-		for item in std.objectFields(groups[g])
+    [g + '#' + item]: groups[g][item]
+    for g in std.objectFields(groups)
+    for item in std.objectFields(groups[g])
   },
   rollout: {
     apiVersion: 'workflow.kubernetes.io/v1alpha1',
     kind: 'Rollout',
     metadata: {
-	  template: '{{ .Name }}',
+      template: '{{ .Name }}',
       name: 'rndr-generated-jsonnet',
     },
     spec: {
       groups: [
-		{
-		  name: g,
-		  steps: [
-			{
-			  action: 'CreateOrUpdate',
-			  object: g + '#' + item,
-			}
-			for item in std.objectFields(groups[g])
-		  ],
-		},
-		for g in std.objectFields(groups)
-	  ],
+        {
+          name: g,
+          steps: [
+            {
+              action: 'CreateOrUpdate',
+              object: g + '#' + item,
+            }
+            for item in std.objectFields(groups[g])
+          ],
+        }
+        for g in std.objectFields(groups)
+      ],
     },
   },
 }`))
@@ -92,6 +97,28 @@ func locutusify(entry string, templName string, functionFiles []string) (err err
 	}
 	defer errcapture.Do(&err, f.Close, "close locutus entry")
 
+	return writeEntry(f, templName, fmt.Sprintf("import '%s'", jsonnet.VirtualConfigPath), functionFiles)
+}
+
+// OperatorEntry returns locutus jsonnet entry for operator triggered by custom resources. Resource `spec` merged into
+// given defaults is used as values, so rendered objects are the same as the ones rendered by `rndr`.
+// Function files are imported using given paths, so they have to be relative to the entry file (or absolute).
+func OperatorEntry(templName string, defaultsJSON []byte, functionFiles []string) ([]byte, error) {
+	if len(defaultsJSON) == 0 {
+		defaultsJSON = []byte("{}")
+	}
+	b := bytes.Buffer{}
+	values := fmt.Sprintf(`(
+  local cr = import '%s';
+  std.mergePatch(%s, if std.objectHas(cr, 'spec') then cr.spec else {})
+)`, jsonnet.VirtualConfigPath, defaultsJSON)
+	if err := writeEntry(&b, templName, values, functionFiles); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeEntry(w io.Writer, templName string, values string, functionFiles []string) error {
 	type group struct {
 		Prefix       string
 		FunctionFile string
@@ -103,17 +130,102 @@ func locutusify(entry string, templName string, functionFiles []string) (err err
 		g = append(g, group{FunctionFile: f, Prefix: strings.TrimSuffix(filepath.Base(f), filepath.Ext(filepath.Base(f)))})
 	}
 
-	return applyAllLocutusJsonnetTmpl.Execute(f, struct {
-		Name                     string
-		LocutusVirtualConfigPath string
-		Groups                   []group
+	return applyAllLocutusJsonnetTmpl.Execute(w, struct {
+		Name   string
+		Values string
+		Groups []group
 	}{
-		Name:                     templName,
-		Groups:                   g,
-		LocutusVirtualConfigPath: jsonnet.VirtualConfigPath,
+		Name:   templName,
+		Groups: g,
+		Values: values,
 	})
 }
 
+// VendorDir returns absolute path of the template `vendor` directory, which is next to the first function file (like
+// `jsonnetfile.json` of jsonnet-bundler), so it does not depend on the working directory.
+func (c TemplateRenderer) VendorDir() (string, error) {
+	if len(c.Functions) == 0 {
+		return "", errors.New("jsonnet template has no functions")
+	}
+	abs, err := filepath.Abs(c.Functions[0])
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(abs), "vendor"), nil
+}
+
+// Dependencies returns absolute paths of all files transitively imported by function files. Imports are resolved
+// relative to the importing file or template `vendor` directory (see VendorDir).
+func Dependencies(c TemplateRenderer) ([]string, error) {
+	vendor, err := c.VendorDir()
+	if err != nil {
+		return nil, err
+	}
+	vm := gojsonnet.MakeVM()
+	vm.Importer(&gojsonnet.FileImporter{JPaths: []string{vendor}})
+
+	var ret []string
+	for _, f := range c.Functions {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		deps, err := vm.FindDependencies("", []string{abs})
+		if err != nil {
+			return nil, errors.Wrapf(err, "find imports of %v", f)
+		}
+		ret = append(ret, deps...)
+	}
+	sort.Strings(ret)
+	return dedup(ret), nil
+}
+
+// RelativePaths returns slash separated paths of given absolute files, relative to the directory they are copied to
+// (e.g when template is packaged). Files in given vendor directory (see VendorDir) are kept in `vendor`, since it's where
+// jsonnet looks imports up. Others are relative to their common parent, so relative imports between them keep working.
+func RelativePaths(vendor string, files []string) (map[string]string, error) {
+	root := ""
+	for _, f := range files {
+		if strings.HasPrefix(f, vendor+string(filepath.Separator)) {
+			continue
+		}
+		dir := filepath.Dir(f)
+		if root == "" {
+			root = dir
+			continue
+		}
+		for !strings.HasPrefix(dir+string(filepath.Separator), strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			root = filepath.Dir(root)
+		}
+	}
+
+	ret := make(map[string]string, len(files))
+	for _, f := range files {
+		base := root
+		prefix := ""
+		if strings.HasPrefix(f, vendor+string(filepath.Separator)) {
+			base, prefix = vendor, "vendor"
+		}
+		r, err := filepath.Rel(base, f)
+		if err != nil {
+			return nil, err
+		}
+		ret[f] = path.Join(prefix, filepath.ToSlash(r))
+	}
+	return ret, nil
+}
+
+func dedup(sorted []string) []string {
+	ret := sorted[:0]
+	for i, s := range sorted {
+		if i > 0 && sorted[i-1] == s {
+			continue
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
 // Render renders objects.
 // TOOD(bplotka): Support Locutus rollouts?
 func Render(logger log.Logger, name string, c TemplateRenderer, valuesYAML []byte) (groups rndrapi.Groups, err error) {
@@ -165,14 +277,14 @@ func Render(logger log.Logger, name string, c TemplateRenderer, valuesYAML []byt
 				return nil, errors.Errorf("rollout step rendered by locutus has object that does not exists %v", s.Object)
 			}
 
-			split := strings.Split(s.Object, "#")
+			split := strings.SplitN(s.Object, "#", 2)
 
 			// TODO(bwplotka): Most likely we have to stick to JSON output.
 			b := bytes.Buffer{}
 			m := yaml.NewEncoder(&b)
 			m.SetIndent(2)
 
-			if err := m.Encode(res.Objects[s.Object].Object[split[1]]); err != nil {
+			if err := m.Encode(res.Objects[s.Object].Object); err != nil {
 				return nil, err
 			}
 			ret[g.Name] = append(ret[g.Name], rndrapi.Resource{Item: split[1], Object: b.Bytes()})
@@ -0,0 +1,74 @@
+package jsonnet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brancz/locutus/render/jsonnet"
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	gojsonnet "github.com/google/go-jsonnet"
+)
+
+func TestOperatorEntry(t *testing.T) {
+	entry, err := OperatorEntry("hello", []byte(`{"name": "a", "replicas": 1}`), []string{"hello.libsonnet"})
+	testutil.Ok(t, err)
+
+	vm := gojsonnet.MakeVM()
+	vm.Importer(&gojsonnet.MemoryImporter{Data: map[string]gojsonnet.Contents{
+		jsonnet.VirtualConfigPath: gojsonnet.MakeContents(`{"spec": {"name": "b"}}`),
+		"hello.libsonnet": gojsonnet.MakeContents(
+			"function(values) {\n  configmap: { kind: 'ConfigMap', metadata: { name: values.name }, data: { replicas: std.toString(values.replicas) } },\n  secret: { kind: 'Secret' },\n}\n",
+		),
+	}})
+	out, err := vm.EvaluateAnonymousSnippet("main.jsonnet", string(entry))
+	testutil.Ok(t, err)
+
+	res := struct {
+		Objects map[string]interface{} `json:"objects"`
+	}{}
+	testutil.Ok(t, json.Unmarshal([]byte(out), &res))
+	// Each object is a single resource, so locutus creates or updates them one by one.
+	testutil.Equals(t, map[string]interface{}{
+		"hello#configmap": map[string]interface{}{
+			"kind":     "ConfigMap",
+			"metadata": map[string]interface{}{"name": "b"},
+			"data":     map[string]interface{}{"replicas": "1"},
+		},
+		"hello#secret": map[string]interface{}{"kind": "Secret"},
+	}, res.Objects)
+}
+
+func TestDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-jsonnet-deps")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	write := func(file, content string) string {
+		f := filepath.Join(dir, file)
+		testutil.Ok(t, os.MkdirAll(filepath.Dir(f), os.ModePerm))
+		testutil.Ok(t, ioutil.WriteFile(f, []byte(content), os.ModePerm))
+		return f
+	}
+	fn := write("tmpl/hello.libsonnet", "local labels = import 'labels.libsonnet';\nlocal k = import 'github.com/k/k.libsonnet';\nfunction(values) {}\n")
+	labels := write("tmpl/labels.libsonnet", "{}\n")
+	k := write("tmpl/vendor/github.com/k/k.libsonnet", "{}\n")
+
+	// Vendor directory is found next to the function file, not in the working directory.
+	r := TemplateRenderer{Functions: []string{fn}}
+	deps, err := Dependencies(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{labels, k}, deps)
+
+	vendor, err := r.VendorDir()
+	testutil.Ok(t, err)
+	rel, err := RelativePaths(vendor, append([]string{fn}, deps...))
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{
+		fn:     "hello.libsonnet",
+		labels: "labels.libsonnet",
+		k:      "vendor/github.com/k/k.libsonnet",
+	}, rel)
+}
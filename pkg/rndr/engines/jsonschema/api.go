@@ -0,0 +1,183 @@
+package jsonschema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/efficientgo/tools/core/pkg/merrors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	js "github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// TemplateAPI references JSON Schema that defines template values. Draft 2020-12 is assumed, unless schema specifies
+// different `$schema`. Schema can be written in either JSON or YAML, so existing schemas like Helm `values.schema.json` or
+// Custom Resource Definition can be used directly.
+type TemplateAPI struct {
+	// File is destination to JSON Schema file on local filesystem.
+	File string
+	// Pointer is an optional JSON pointer to the schema within the file e.g `/spec/versions/0/schema/openAPIV3Schema`
+	// for Custom Resource Definition.
+	Pointer string
+}
+
+// Load compiles JSON Schema into values schema and default values. Defaults are taken from `default` keywords.
+// Resolved API validates values with defaults against the full JSON Schema; errors carry JSON pointer paths.
+func Load(_ context.Context, logger log.Logger, api TemplateAPI) (rndrapi.API, error) {
+	file, err := filepath.Abs(api.File)
+	if err != nil {
+		return rndrapi.API{}, err
+	}
+	u := (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+
+	c := js.NewCompiler()
+	c.LoadURL = loadURL
+	compiled, err := c.Compile(u + "#" + api.Pointer)
+	if err != nil {
+		return rndrapi.API{}, errors.Wrapf(err, "compile JSON Schema %v", api.File)
+	}
+
+	b, err := readJSON(api.File)
+	if err != nil {
+		return rndrapi.API{}, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return rndrapi.API{}, errors.Wrapf(err, "parse %v", api.File)
+	}
+	root, ok := resolvePointer(doc, api.Pointer)
+	if !ok {
+		return rndrapi.API{}, errors.Errorf("pointer %q not found in %v", api.Pointer, api.File)
+	}
+
+	r := resolver{doc: doc}
+	var defaultsYAML []byte
+	if defaults := r.defaults(root, map[string]bool{}); len(defaults) > 0 {
+		defaultsYAML, err = yaml.Marshal(defaults)
+		if err != nil {
+			return rndrapi.API{}, err
+		}
+	}
+
+	level.Debug(logger).Log("msg", "loaded JSON Schema API", "file", api.File, "pointer", api.Pointer)
+	return rndrapi.API{
+		Schema:   r.structural(root, map[string]bool{}),
+		Defaults: defaultsYAML,
+		Validate: func(valuesYAML, withDefaultsYAML []byte) error {
+			return validate(compiled, valuesYAML, withDefaultsYAML)
+		},
+	}, nil
+}
+
+// loadURL allows local schemas (including referenced ones) to be written in YAML.
+func loadURL(s string) (io.ReadCloser, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "file" {
+		return js.LoadURL(s)
+	}
+	b, err := readJSON(filepath.FromSlash(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func readJSON(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b, err = k8syaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %v", file)
+	}
+	return b, nil
+}
+
+func validate(s *js.Schema, valuesYAML, withDefaultsYAML []byte) error {
+	b, err := k8syaml.YAMLToJSON(withDefaultsYAML)
+	if err != nil {
+		return errors.Wrap(err, "parse values")
+	}
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return errors.Wrap(err, "parse values")
+	}
+	if v == nil {
+		// No values is the same as empty object.
+		v = map[string]interface{}{}
+	}
+
+	err = s.Validate(v)
+	ve, ok := err.(*js.ValidationError)
+	if !ok {
+		return err
+	}
+
+	errs := merrors.New()
+	for _, l := range leaves(ve) {
+		line, column := rndrapi.Position(valuesYAML, splitPointer(l.InstanceLocation))
+		errs.Add(rndrapi.ValidationError{Path: l.InstanceLocation, Line: line, Column: column, Msg: l.Message})
+	}
+	return errs.Err()
+}
+
+// leaves returns root causes of validation error. Failed anyOf and oneOf are reported as a whole, since it's not known
+// which subschema was meant to match.
+func leaves(ve *js.ValidationError) []*js.ValidationError {
+	if len(ve.Causes) == 0 || strings.HasSuffix(ve.KeywordLocation, "/anyOf") || strings.HasSuffix(ve.KeywordLocation, "/oneOf") {
+		return []*js.ValidationError{ve}
+	}
+	var ret []*js.ValidationError
+	for _, c := range ve.Causes {
+		ret = append(ret, leaves(c)...)
+	}
+	return ret
+}
+
+func splitPointer(ptr string) []string {
+	if ptr == "" {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(ptr, "/"), "/")
+	for i := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(parts[i], "~1", "/"), "~0", "~")
+	}
+	return parts
+}
+
+func resolvePointer(doc interface{}, ptr string) (interface{}, bool) {
+	cur := doc
+	for _, p := range splitPointer(ptr) {
+		switch o := cur.(type) {
+		case map[string]interface{}:
+			next, ok := o[p]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(o) {
+				return nil, false
+			}
+			cur = o[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
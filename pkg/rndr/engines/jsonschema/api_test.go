@@ -0,0 +1,91 @@
+package jsonschema
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("not existing file", func(t *testing.T) {
+		_, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{File: "testdata/nope.json"})
+		testutil.NotOk(t, err)
+	})
+	t.Run("schema and defaults", func(t *testing.T) {
+		a, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{File: "testdata/values.schema.json"})
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, &rndrapi.Schema{
+			Type: "object",
+			Properties: map[string]*rndrapi.Schema{
+				"name":     {Type: "string", Description: "Name of the service."},
+				"replicas": {Type: "integer", Default: float64(1)},
+				"image": {
+					Type: "object",
+					Properties: map[string]*rndrapi.Schema{
+						"repository": {Type: "string", Default: "example/hello"},
+						"tag":        {Type: "string", Default: "1.8"},
+					},
+				},
+				"ports":   {Type: "array", Items: &rndrapi.Schema{XPreserveUnknownFields: true}},
+				"storage": {XPreserveUnknownFields: true},
+			},
+			Required: []string{"name"},
+		}, a.Schema)
+		testutil.Equals(t, "image:\n    repository: example/hello\n    tag: \"1.8\"\nreplicas: 1\n", string(a.Defaults))
+	})
+	t.Run("validate", func(t *testing.T) {
+		a, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{File: "testdata/values.schema.json"})
+		testutil.Ok(t, err)
+
+		values := []byte(`name: hello
+ports:
+- name: http
+  port: 8080
+storage:
+  disk: /data
+`)
+		withDefaults, err := rndrapi.MergeValues(a.Defaults, values)
+		testutil.Ok(t, err)
+		testutil.Ok(t, a.Validate(values, withDefaults))
+
+		values = []byte(`replicas: -1
+ports:
+- port: 80000
+storage:
+  disk: /data
+  memory: {}
+image:
+  repo: hello
+`)
+		withDefaults, err = rndrapi.MergeValues(a.Defaults, values)
+		testutil.Ok(t, err)
+		err = a.Validate(values, withDefaults)
+		testutil.NotOk(t, err)
+		for _, exp := range []string{
+			"line 1, column 1: <root>: missing properties: 'name'",
+			"line 1, column 11: /replicas: must be >= 0 but found -1",
+			"line 3, column 9: /ports/0/port: must be <= 65535 but found 80000",
+			"line 5, column 3: /storage: valid against schemas at indexes 0 and 1",
+			"line 8, column 3: /image: additionalProperties 'repo' not allowed",
+		} {
+			testutil.Assert(t, strings.Contains(err.Error(), exp), "expected %q in %v", exp, err)
+		}
+	})
+	t.Run("CRD", func(t *testing.T) {
+		a, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{
+			File:    "testdata/crd.yaml",
+			Pointer: "/spec/versions/0/schema/openAPIV3Schema",
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, "replicas: 2\n", string(a.Defaults))
+		testutil.Equals(t, true, a.Schema.Properties["port"].XIntOrString)
+
+		values := []byte("replicas: two\n")
+		testutil.NotOk(t, a.Validate(values, values))
+	})
+}
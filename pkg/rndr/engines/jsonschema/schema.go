@@ -0,0 +1,168 @@
+package jsonschema
+
+import (
+	"strings"
+
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+// resolver walks JSON Schema document resolving local references.
+type resolver struct {
+	doc interface{}
+}
+
+func (r resolver) ref(m map[string]interface{}) (map[string]interface{}, string, bool) {
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m, "", true
+	}
+	if !strings.HasPrefix(ref, "#") {
+		// Remote references and anchors are only supported by validation.
+		return nil, ref, false
+	}
+	target, ok := resolvePointer(r.doc, strings.TrimPrefix(ref, "#"))
+	if !ok {
+		return nil, ref, false
+	}
+	t, ok := target.(map[string]interface{})
+	return t, ref, ok
+}
+
+func preserveUnknown() *rndrapi.Schema {
+	return &rndrapi.Schema{XPreserveUnknownFields: true}
+}
+
+// structural returns best effort structural subset of JSON Schema. Parts that can't be expressed structurally
+// (e.g oneOf or remote references) are described as any value. Validation always uses the full JSON Schema.
+func (r resolver) structural(node interface{}, seen map[string]bool) *rndrapi.Schema {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		// Boolean schema.
+		return preserveUnknown()
+	}
+	m, ref, ok := r.ref(m)
+	if !ok || seen[ref] {
+		return preserveUnknown()
+	}
+	if ref != "" {
+		seen[ref] = true
+		defer delete(seen, ref)
+	}
+	for _, k := range []string{"oneOf", "anyOf", "allOf", "not", "if", "$dynamicRef"} {
+		if _, ok := m[k]; ok {
+			return preserveUnknown()
+		}
+	}
+
+	s := &rndrapi.Schema{Default: m["default"]}
+	s.Description, _ = m["description"].(string)
+	s.Format, _ = m["format"].(string)
+	s.Enum, _ = m["enum"].([]interface{})
+	s.Nullable, _ = m["nullable"].(bool)
+	if intOrString, _ := m["x-kubernetes-int-or-string"].(bool); intOrString {
+		s.AnyOf = []*rndrapi.Schema{{Type: "integer"}, {Type: "string"}}
+		s.XIntOrString = true
+		return s
+	}
+
+	switch t := m["type"].(type) {
+	case string:
+		s.Type = t
+	case []interface{}:
+		var types []string
+		for _, e := range t {
+			if e == "null" {
+				s.Nullable = true
+				continue
+			}
+			types = append(types, e.(string))
+		}
+		if len(types) != 1 {
+			return preserveUnknown()
+		}
+		s.Type = types[0]
+	default:
+		s.XPreserveUnknownFields = true
+		return s
+	}
+
+	switch s.Type {
+	case "object":
+		if props, ok := m["properties"].(map[string]interface{}); ok {
+			s.Properties = map[string]*rndrapi.Schema{}
+			for k, p := range props {
+				s.Properties[k] = r.structural(p, seen)
+			}
+		}
+		for _, req := range toSlice(m["required"]) {
+			if req, ok := req.(string); ok {
+				s.Required = append(s.Required, req)
+			}
+		}
+		_, patterns := m["patternProperties"]
+		switch ap := m["additionalProperties"].(type) {
+		case map[string]interface{}:
+			s.AdditionalProperties = r.structural(ap, seen)
+		case bool:
+			s.XPreserveUnknownFields = ap || patterns
+		default:
+			// JSON Schema allows any additional properties by default.
+			s.XPreserveUnknownFields = true
+		}
+	case "array":
+		if items, ok := m["items"].(map[string]interface{}); ok {
+			s.Items = r.structural(items, seen)
+		}
+	}
+	return s
+}
+
+// defaults returns default values of object properties. If object itself has default, it's used as a whole.
+// Defaults of allOf subschemas are merged, since they all apply to the same value.
+func (r resolver) defaults(node interface{}, seen map[string]bool) map[string]interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	m, ref, ok := r.ref(m)
+	if !ok || seen[ref] {
+		return nil
+	}
+	if ref != "" {
+		seen[ref] = true
+		defer delete(seen, ref)
+	}
+	if d, ok := m["default"].(map[string]interface{}); ok {
+		return d
+	}
+
+	ret := map[string]interface{}{}
+	for _, sub := range toSlice(m["allOf"]) {
+		for k, v := range r.defaults(sub, seen) {
+			ret[k] = v
+		}
+	}
+	props, _ := m["properties"].(map[string]interface{})
+	for k, p := range props {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if pm, _, ok = r.ref(pm); !ok {
+			continue
+		}
+		if d, ok := pm["default"]; ok {
+			ret[k] = d
+			continue
+		}
+		if d := r.defaults(p, seen); len(d) > 0 {
+			ret[k] = d
+		}
+	}
+	return ret
+}
+
+func toSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
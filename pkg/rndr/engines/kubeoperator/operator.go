@@ -0,0 +1,364 @@
+// Package kubeoperator generates Kubernetes operator based on locutus (https://github.com/brancz/locutus) that reconciles
+// custom resources with template values into objects rendered by the template.
+package kubeoperator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/crd"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// DefaultImage is locutus container image used if none is specified.
+const DefaultImage = "quay.io/brancz/locutus:latest"
+
+const (
+	templateDir = "/etc/rndr/template"
+	entryFile   = "main.jsonnet"
+	triggerFile = "trigger.yaml"
+	// maxConfigMapSize is a limit of ConfigMap size imposed by Kubernetes.
+	maxConfigMapSize = 1024 * 1024
+)
+
+// Options configures operator.
+type Options struct {
+	// Image is locutus container image the operator runs. Defaults to DefaultImage.
+	Image string
+	// CRD configures custom resource the operator reconciles.
+	CRD crd.Options `yaml:",inline"`
+}
+
+// PolicyRule is RBAC policy rule.
+type PolicyRule struct {
+	APIGroups []string `json:"apiGroups"`
+	Resources []string `json:"resources"`
+	Verbs     []string `json:"verbs"`
+}
+
+// Operator is a set of definitions that run locutus as an operator for the template.
+type Operator struct {
+	// Name is a name of operator Deployment, ServiceAccount, RBAC objects and prefix of the ConfigMap name.
+	Name string
+	// CRD is a definition of custom resource the operator reconciles.
+	CRD *crd.CustomResourceDefinition
+	// Example is a custom resource with API defaults as spec.
+	Example map[string]interface{}
+	// ConfigMap holds template code and locutus trigger configuration.
+	ConfigMap map[string]interface{}
+	// Rules are RBAC policy rules the operator needs cluster wide.
+	Rules []PolicyRule
+	// Deployment is the spec of the operator Deployment.
+	Deployment map[string]interface{}
+}
+
+// New returns operator for the jsonnet template. Custom resource `spec` is the template values. Template is rendered with
+// API defaults to find out what kinds of objects operator manages, so templates that render different kinds depending on
+// values might need additional permissions.
+func New(ctx context.Context, logger log.Logger, name string, api rndrapi.API, renderer *jsonnet.TemplateRenderer, render rndrapi.RenderFunc, opts Options) (*Operator, error) {
+	if renderer == nil {
+		return nil, errors.New("only jsonnet template renderer can be packaged as an operator")
+	}
+	if opts.Image == "" {
+		opts.Image = DefaultImage
+	}
+	opts.CRD = opts.CRD.WithDefaults(name)
+
+	c, err := crd.Generate(name, api, opts.CRD)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate CRD")
+	}
+
+	defaults := map[string]interface{}{}
+	if err := yaml.Unmarshal(api.Defaults, &defaults); err != nil {
+		return nil, errors.Wrap(err, "parse API defaults")
+	}
+	defaultsJSON, err := k8syaml.YAMLToJSON(api.Defaults)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert API defaults to JSON")
+	}
+
+	o := &Operator{
+		Name: name + "-operator",
+		CRD:  c,
+		Example: map[string]interface{}{
+			"apiVersion": opts.CRD.APIVersion(),
+			"kind":       opts.CRD.Kind,
+			"metadata":   map[string]interface{}{"name": name},
+			"spec":       defaults,
+		},
+	}
+
+	var items []map[string]interface{}
+	o.ConfigMap, items, err = configMap(name, o.Name, defaultsJSON, *renderer, opts.CRD)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := render(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "render template with API defaults")
+	}
+	o.Rules, err = rules(groups, opts.CRD)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Deployment = deployment(o.Name, opts.Image, items)
+	return o, nil
+}
+
+var invalidKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// configMap returns ConfigMap with locutus entry file, trigger configuration and all template jsonnet files.
+// ConfigMap keys can't contain directories, so returned volume items recreate directory structure of jsonnet files.
+func configMap(templName, name string, defaultsJSON []byte, r jsonnet.TemplateRenderer, opts crd.Options) (_ map[string]interface{}, items []map[string]interface{}, _ error) {
+	deps, err := jsonnet.Dependencies(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make([]string, 0, len(r.Functions)+len(deps))
+	for _, f := range r.Functions {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, abs)
+	}
+	files = append(files, deps...)
+
+	vendor, err := r.VendorDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	rel, err := jsonnet.RelativePaths(vendor, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	for f, r := range rel {
+		if r == entryFile || r == triggerFile {
+			return nil, nil, errors.Errorf("jsonnet file %v clashes with operator %v file; rename it", f, r)
+		}
+	}
+	functions := make([]string, 0, len(r.Functions))
+	for _, f := range files[:len(r.Functions)] {
+		functions = append(functions, rel[f])
+	}
+	entry, err := jsonnet.OperatorEntry(templName, defaultsJSON, functions)
+	if err != nil {
+		return nil, nil, err
+	}
+	trigger, err := k8syaml.Marshal(map[string]interface{}{
+		"mainResource": opts.Plural,
+		"resources": []map[string]interface{}{
+			{"name": opts.Plural, "kind": opts.Kind, "apiVersion": opts.APIVersion()},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := map[string]string{entryFile: string(entry), triggerFile: string(trigger)}
+	items = []map[string]interface{}{{"key": entryFile, "path": entryFile}, {"key": triggerFile, "path": triggerFile}}
+	size := len(entry) + len(trigger)
+	seen := map[string]bool{}
+	for _, f := range files {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := invalidKeyChars.ReplaceAllString(strings.ReplaceAll(rel[f], "/", "."), "_")
+		if _, ok := data[key]; ok {
+			return nil, nil, errors.Errorf("jsonnet files %v and other one have the same ConfigMap key %v; rename one of them", f, key)
+		}
+		data[key] = string(b)
+		items = append(items, map[string]interface{}{"key": key, "path": rel[f]})
+		size += len(b)
+	}
+	if size > maxConfigMapSize {
+		return nil, nil, errors.Errorf("template jsonnet files have %d bytes in total, which is more than %d bytes ConfigMap can hold", size, maxConfigMapSize)
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": configMapName(name), "labels": labels(name)},
+		"data":       data,
+	}, items, nil
+}
+
+// rules returns RBAC rules the operator needs to reconcile custom resources into rendered objects. Resource names are
+// resolved by REST mapper that knows the custom resource and CustomResourceDefinitions among rendered objects. Other
+// kinds are mapped the same way Kubernetes maps built-in kinds e.g `Endpoints` to `endpoints`.
+func rules(groups rndrapi.Groups, opts crd.Options) ([]PolicyRule, error) {
+	type object struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Spec       struct {
+			Group   string
+			Version string
+			Names   struct {
+				Kind     string
+				Plural   string
+				Singular string
+			}
+			Versions []struct {
+				Name string
+			}
+		}
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	addCRD := func(group, kind, plural, singular string, versions []string) {
+		if singular == "" {
+			singular = strings.ToLower(kind)
+		}
+		for _, v := range versions {
+			mapper.AddSpecific(
+				schema.GroupVersionKind{Group: group, Version: v, Kind: kind},
+				schema.GroupVersionResource{Group: group, Version: v, Resource: plural},
+				schema.GroupVersionResource{Group: group, Version: v, Resource: singular},
+				meta.RESTScopeNamespace,
+			)
+		}
+	}
+	addCRD(opts.Group, opts.Kind, opts.Plural, "", opts.Versions)
+
+	var objects []object
+	for g, rs := range groups {
+		for _, r := range rs {
+			o := object{}
+			if err := yaml.Unmarshal(r.Object, &o); err != nil {
+				return nil, errors.Wrapf(err, "parse %v from %v group", r.Item, g)
+			}
+			if o.Kind == "" {
+				return nil, errors.Errorf("%v from %v group has no kind", r.Item, g)
+			}
+			objects = append(objects, o)
+
+			if o.Kind != "CustomResourceDefinition" || !strings.HasPrefix(o.APIVersion, "apiextensions.k8s.io/") {
+				continue
+			}
+			var versions []string
+			if o.Spec.Version != "" {
+				versions = append(versions, o.Spec.Version)
+			}
+			for _, v := range o.Spec.Versions {
+				versions = append(versions, v.Name)
+			}
+			addCRD(o.Spec.Group, o.Spec.Names.Kind, o.Spec.Names.Plural, o.Spec.Names.Singular, versions)
+		}
+	}
+
+	resources := map[string]map[string]bool{}
+	for _, o := range objects {
+		gvk := schema.FromAPIVersionAndKind(o.APIVersion, o.Kind)
+		if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); meta.IsNoMatchError(err) {
+			mapper.Add(gvk, meta.RESTScopeNamespace)
+		}
+		m, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "map %v to resource", gvk)
+		}
+		if resources[m.Resource.Group] == nil {
+			resources[m.Resource.Group] = map[string]bool{}
+		}
+		resources[m.Resource.Group][m.Resource.Resource] = true
+	}
+
+	ret := []PolicyRule{
+		{APIGroups: []string{opts.Group}, Resources: []string{opts.Plural}, Verbs: []string{"get", "list", "watch"}},
+		{APIGroups: []string{opts.Group}, Resources: []string{opts.Plural + "/status"}, Verbs: []string{"get", "update", "patch"}},
+	}
+	apiGroups := make([]string, 0, len(resources))
+	for g := range resources {
+		apiGroups = append(apiGroups, g)
+	}
+	sort.Strings(apiGroups)
+	for _, g := range apiGroups {
+		rs := make([]string, 0, len(resources[g]))
+		for r := range resources[g] {
+			rs = append(rs, r)
+		}
+		sort.Strings(rs)
+		ret = append(ret, PolicyRule{APIGroups: []string{g}, Resources: rs, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete"}})
+	}
+	return ret, nil
+}
+
+func labels(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"app.kubernetes.io/name":       name,
+		"app.kubernetes.io/component":  "operator",
+		"app.kubernetes.io/managed-by": "rndr",
+	}
+}
+
+func configMapName(name string) string {
+	return name + "-template"
+}
+
+func deployment(name, image string, items []map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"replicas": 1,
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app.kubernetes.io/name": name}},
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": labels(name)},
+			"spec": map[string]interface{}{
+				"serviceAccountName": name,
+				"containers": []map[string]interface{}{{
+					"name":  "locutus",
+					"image": image,
+					"args": []string{
+						"--renderer=jsonnet",
+						fmt.Sprintf("--renderer.jsonnet.entrypoint=%s/%s", templateDir, entryFile),
+						"--trigger=resource",
+						fmt.Sprintf("--trigger.resource.config=%s/%s", templateDir, triggerFile),
+					},
+					// Locutus looks jsonnet imports up in `vendor` directory relative to the working directory.
+					"workingDir": templateDir,
+					"ports":      []map[string]interface{}{{"name": "http", "containerPort": 8080}},
+					"volumeMounts": []map[string]interface{}{
+						{"name": "template", "mountPath": templateDir, "readOnly": true},
+					},
+				}},
+				"volumes": []map[string]interface{}{{
+					"name": "template",
+					"configMap": map[string]interface{}{
+						"name":  configMapName(name),
+						"items": items,
+					},
+				}},
+			},
+		},
+	}
+}
+
+// WriteYAML writes object as YAML file, creating directories if needed.
+func WriteYAML(file string, o interface{}) error {
+	b, err := k8syaml.Marshal(o)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, os.ModePerm)
+}
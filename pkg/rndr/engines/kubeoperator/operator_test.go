@@ -0,0 +1,43 @@
+package kubeoperator
+
+import (
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/observatorium/rndr/pkg/rndr/crd"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestRules(t *testing.T) {
+	groups := rndrapi.Groups{
+		"hello": {
+			{Item: "deployment", Object: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: hello}\n")},
+			{Item: "endpoints", Object: []byte("apiVersion: v1\nkind: Endpoints\nmetadata: {name: hello}\n")},
+			{Item: "policy", Object: []byte("apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata: {name: hello}\n")},
+		},
+		"mice": {
+			{Item: "crd", Object: []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata: {name: mice.example.com}
+spec:
+  group: example.com
+  names: {kind: Mouse, plural: mice, singular: mouse}
+  versions: [{name: v1alpha1}, {name: v1}]
+`)},
+			{Item: "mouse", Object: []byte("apiVersion: example.com/v1\nkind: Mouse\nmetadata: {name: jerry}\n")},
+		},
+	}
+	rs, err := rules(groups, crd.Options{Group: "rndr.observatorium.io", Kind: "Hello", Plural: "hellos", Versions: []string{"v1"}})
+	testutil.Ok(t, err)
+
+	manage := []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	testutil.Equals(t, []PolicyRule{
+		{APIGroups: []string{"rndr.observatorium.io"}, Resources: []string{"hellos"}, Verbs: []string{"get", "list", "watch"}},
+		{APIGroups: []string{"rndr.observatorium.io"}, Resources: []string{"hellos/status"}, Verbs: []string{"get", "update", "patch"}},
+		{APIGroups: []string{""}, Resources: []string{"endpoints"}, Verbs: manage},
+		{APIGroups: []string{"apiextensions.k8s.io"}, Resources: []string{"customresourcedefinitions"}, Verbs: manage},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: manage},
+		{APIGroups: []string{"example.com"}, Resources: []string{"mice"}, Verbs: manage},
+		{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"networkpolicies"}, Verbs: manage},
+	}, rs)
+}
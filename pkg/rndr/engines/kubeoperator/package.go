@@ -0,0 +1,88 @@
+package kubeoperator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+)
+
+// DefaultNamespace is namespace operator is deployed in if none is specified.
+const DefaultNamespace = "default"
+
+type PackageOptions struct {
+	// Namespace is a namespace operator is deployed in. Defaults to DefaultNamespace. Operator reconciles custom
+	// resources in all namespaces.
+	Namespace string
+
+	// Options configures generated operator and its custom resource.
+	Options `yaml:",inline"`
+}
+
+// Package generates manifests of the operator in given directory, numbered in the order they have to be applied:
+// CustomResourceDefinition, ServiceAccount, ClusterRole, ClusterRoleBinding, ConfigMap with the template code and operator
+// Deployment. Example custom resource with API defaults is generated in `example` directory.
+func Package(ctx context.Context, logger log.Logger, name string, api rndrapi.API, renderer *jsonnet.TemplateRenderer, render rndrapi.RenderFunc, opts PackageOptions, outDir string) error {
+	op, err := New(ctx, logger, name, api, renderer, render, opts.Options)
+	if err != nil {
+		return errors.Wrap(err, "generate operator")
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+
+	metadata := func() map[string]interface{} {
+		return map[string]interface{}{"name": op.Name, "namespace": opts.Namespace, "labels": labels(op.Name)}
+	}
+	clusterMetadata := func() map[string]interface{} {
+		return map[string]interface{}{"name": op.Name, "labels": labels(op.Name)}
+	}
+	op.ConfigMap["metadata"].(map[string]interface{})["namespace"] = opts.Namespace
+
+	objects := []struct {
+		item   string
+		object interface{}
+	}{
+		{item: "crd", object: op.CRD},
+		{item: "serviceaccount", object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ServiceAccount",
+			"metadata":   metadata(),
+		}},
+		{item: "clusterrole", object: map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata":   clusterMetadata(),
+			"rules":      op.Rules,
+		}},
+		{item: "clusterrolebinding", object: map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRoleBinding",
+			"metadata":   clusterMetadata(),
+			"roleRef":    map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": op.Name},
+			"subjects":   []map[string]interface{}{{"kind": "ServiceAccount", "name": op.Name, "namespace": opts.Namespace}},
+		}},
+		{item: "configmap", object: op.ConfigMap},
+		{item: "deployment", object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   metadata(),
+			"spec":       op.Deployment,
+		}},
+	}
+	for i, o := range objects {
+		if err := WriteYAML(filepath.Join(outDir, fmt.Sprintf("%d-%v.yaml", i, o.item)), o.object); err != nil {
+			return err
+		}
+	}
+	if err := WriteYAML(filepath.Join(outDir, "example", op.CRD.Spec.Names.Singular+".yaml"), op.Example); err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "generated Kubernetes operator", "dir", outDir, "crd", op.CRD.Metadata.Name)
+	return nil
+}
@@ -0,0 +1,168 @@
+package kubeoperator
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	locutusjsonnet "github.com/brancz/locutus/render/jsonnet"
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+// TestPackage_ReconcilesLikeRender checks that locutus rendering the packaged template for a custom resource produces
+// the same objects as rendering the template with the resource spec as values.
+func TestPackage_ReconcilesLikeRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-kubeoperator-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "tmpl", "lib"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "tmpl", "lib", "labels.libsonnet"), []byte("function(name) { app: name }\n"), os.ModePerm))
+	fn := filepath.Join(dir, "tmpl", "hello.libsonnet")
+	testutil.Ok(t, ioutil.WriteFile(fn, []byte(`local labels = import 'lib/labels.libsonnet';
+function(values) {
+  deployment: {
+    apiVersion: 'apps/v1',
+    kind: 'Deployment',
+    metadata: { name: values.name, namespace: values.namespace, labels: labels(values.name) },
+    spec: { replicas: values.replicas },
+  },
+  service: {
+    apiVersion: 'v1',
+    kind: 'Service',
+    metadata: { name: values.name, namespace: values.namespace, labels: labels(values.name) },
+    spec: { ports: [{ name: 'http', port: values.ports.http }] },
+  },
+}
+`), os.ModePerm))
+
+	renderer := jsonnet.TemplateRenderer{Functions: []string{fn}}
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type:     "object",
+			Required: []string{"name", "namespace", "replicas", "ports"},
+			Properties: map[string]*rndrapi.Schema{
+				"name":      {Type: "string"},
+				"namespace": {Type: "string"},
+				"replicas":  {Type: "integer"},
+				"ports": {
+					Type:       "object",
+					Required:   []string{"http"},
+					Properties: map[string]*rndrapi.Schema{"http": {Type: "integer"}},
+				},
+			},
+		},
+		Defaults: []byte("name: example\nnamespace: default\nreplicas: 1\nports:\n  http: 80\n"),
+	}
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		v, err := rndrapi.MergeValues(api.Defaults, valuesYAML)
+		if err != nil {
+			return nil, err
+		}
+		return jsonnet.Render(log.NewNopLogger(), "hello", renderer, v)
+	}
+
+	out := filepath.Join(dir, "operator")
+	testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hello", api, &renderer, render, PackageOptions{Namespace: "operators"}, out))
+
+	files, err := filepath.Glob(filepath.Join(out, "*.yaml"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{
+		filepath.Join(out, "0-crd.yaml"),
+		filepath.Join(out, "1-serviceaccount.yaml"),
+		filepath.Join(out, "2-clusterrole.yaml"),
+		filepath.Join(out, "3-clusterrolebinding.yaml"),
+		filepath.Join(out, "4-configmap.yaml"),
+		filepath.Join(out, "5-deployment.yaml"),
+	}, files)
+
+	// Lay out ConfigMap the same way the operator Deployment mounts it.
+	cm := struct {
+		Metadata struct{ Namespace string }
+		Data     map[string]string
+	}{}
+	b, err := ioutil.ReadFile(filepath.Join(out, "4-configmap.yaml"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, yaml.Unmarshal(b, &cm))
+	testutil.Equals(t, "operators", cm.Metadata.Namespace)
+
+	d := struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Volumes []struct {
+						ConfigMap struct {
+							Items []struct{ Key, Path string }
+						} `yaml:"configMap"`
+					}
+				}
+			}
+		}
+	}{}
+	b, err = ioutil.ReadFile(filepath.Join(out, "5-deployment.yaml"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, yaml.Unmarshal(b, &d))
+	testutil.Equals(t, 1, len(d.Spec.Template.Spec.Volumes))
+
+	mount := filepath.Join(dir, "mount")
+	for _, i := range d.Spec.Template.Spec.Volumes[0].ConfigMap.Items {
+		content, ok := cm.Data[i.Key]
+		testutil.Assert(t, ok, "no %v key in ConfigMap", i.Key)
+		testutil.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(mount, i.Path)), os.ModePerm))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(mount, i.Path), []byte(content), os.ModePerm))
+	}
+
+	// Locutus resolves imports of the entry relative to working directory, which operator Deployment sets to the mount.
+	wd, err := os.Getwd()
+	testutil.Ok(t, err)
+	testutil.Ok(t, os.Chdir(mount))
+	t.Cleanup(func() { testutil.Ok(t, os.Chdir(wd)) })
+
+	for _, tcase := range []struct {
+		name string
+		spec string
+	}{
+		{name: "defaults", spec: ""},
+		{name: "custom", spec: "name: custom\nreplicas: 3\nports:\n  http: 8080\n"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			spec := map[string]interface{}{}
+			testutil.Ok(t, yaml.Unmarshal([]byte(tcase.spec), &spec))
+			cr, err := json.Marshal(map[string]interface{}{
+				"apiVersion": "rndr.observatorium.io/v1alpha1",
+				"kind":       "Hello",
+				"metadata":   map[string]interface{}{"name": "test"},
+				"spec":       spec,
+			})
+			testutil.Ok(t, err)
+
+			res, err := locutusjsonnet.NewRenderer(log.NewNopLogger(), entryFile, nil).Render(cr)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(res.Rollout.Spec.Groups))
+
+			expected, err := render(context.Background(), []byte(tcase.spec))
+			testutil.Ok(t, err)
+			testutil.Equals(t, 2, len(expected["hello"]))
+			testutil.Equals(t, len(expected["hello"]), len(res.Rollout.Spec.Groups[0].Steps))
+			for i, r := range expected["hello"] {
+				step := res.Rollout.Spec.Groups[0].Steps[i]
+				testutil.Equals(t, "hello#"+r.Item, step.Object)
+
+				exp := map[string]interface{}{}
+				testutil.Ok(t, yaml.Unmarshal(r.Object, &exp))
+				got := map[string]interface{}{}
+				b, err := json.Marshal(res.Objects[step.Object].Object)
+				testutil.Ok(t, err)
+				testutil.Ok(t, yaml.Unmarshal(b, &got))
+				testutil.Equals(t, exp, got)
+			}
+		})
+	}
+}
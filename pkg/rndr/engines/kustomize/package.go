@@ -0,0 +1,346 @@
+// Package kustomize generates kustomize (https://kustomize.io) base with resources rendered by the template and overlays
+// with patches for other values.
+package kustomize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type PackageOptions struct {
+	// Values is a path to values YAML file the base is rendered with. API defaults are used for values not specified there.
+	Values string
+	// Overlays are paths to values YAML files. Each one has overlay named after the file (e.g `prod` for
+	// `prod.values.yaml`) with patches that change the base into resources rendered with those values.
+	Overlays []string
+}
+
+const (
+	kustomizationFile = "kustomization.yaml"
+	baseDir           = "base"
+	overlaysDir       = "overlays"
+	patchesDir        = "patches"
+	// labelsValue is a values field with labels added to all resources, if API has it.
+	labelsValue = "commonLabels"
+)
+
+// Kustomization is `kustomize.config.k8s.io/v1beta1` Kustomization.
+type Kustomization struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Resources  []string `yaml:"resources,omitempty"`
+	Labels     []Labels `yaml:"labels,omitempty"`
+	Patches    []Patch  `yaml:"patches,omitempty"`
+}
+
+// Labels are labels kustomize adds to all resources. Base uses them instead of `commonLabels` field, because
+// `commonLabels` are also added to selectors, which are immutable for some resources (e.g Deployment). Common labels
+// often include version, so changing it in an overlay would make the resources impossible to update.
+type Labels struct {
+	Pairs            map[string]string `yaml:"pairs"`
+	IncludeSelectors bool              `yaml:"includeSelectors"`
+}
+
+// Patch is strategic merge or JSON6902 patch of the base resources.
+type Patch struct {
+	Path   string  `yaml:"path"`
+	Target *Target `yaml:"target,omitempty"`
+}
+
+// Target selects resource JSON6902 patch applies to.
+type Target struct {
+	Group     string `yaml:"group,omitempty"`
+	Version   string `yaml:"version"`
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// Operation is JSON6902 patch operation.
+type Operation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+// MarshalYAML implements yaml.Marshaler. Value can't be omitted when empty, since it might be e.g replaced with `0`.
+func (o Operation) MarshalYAML() (interface{}, error) {
+	ret := map[string]interface{}{"op": o.Op, "path": o.Path}
+	if o.Op != "remove" {
+		ret["value"] = o.Value
+	}
+	return ret, nil
+}
+
+type resource struct {
+	file   string
+	object map[string]interface{}
+}
+
+// Package generates kustomize base in `base` directory and overlay for each values file in `overlays` directory.
+// Resources are matched between base and overlays by their template group and item name, so overlays can rename them.
+func Package(ctx context.Context, logger log.Logger, name string, api rndrapi.API, render rndrapi.RenderFunc, opts PackageOptions, outDir string) error {
+	baseValues, err := readValues(opts.Values)
+	if err != nil {
+		return err
+	}
+	base, err := renderResources(ctx, render, baseValues)
+	if err != nil {
+		return errors.Wrap(err, "render base")
+	}
+
+	k := newKustomization()
+	for _, key := range sortedKeys(base) {
+		k.Resources = append(k.Resources, base[key].file)
+	}
+	labels, err := commonLabels(api.Defaults, baseValues)
+	if err != nil {
+		return err
+	}
+	if len(labels) > 0 {
+		// Not commonLabels, so labels are not added to selectors; see Labels.
+		k.Labels = []Labels{{Pairs: labels, IncludeSelectors: false}}
+	}
+
+	dir := filepath.Join(outDir, baseDir)
+	for _, r := range base {
+		if err := writeYAML(filepath.Join(dir, r.file), r.object); err != nil {
+			return err
+		}
+	}
+	if err := writeYAML(filepath.Join(dir, kustomizationFile), k); err != nil {
+		return err
+	}
+
+	names := map[string]string{}
+	for _, o := range opts.Overlays {
+		n := overlayName(o)
+		if other, ok := names[n]; ok {
+			return errors.Errorf("values files %v and %v have the same overlay name %v", other, o, n)
+		}
+		names[n] = o
+
+		values, err := readValues(o)
+		if err != nil {
+			return err
+		}
+		resources, err := renderResources(ctx, render, values)
+		if err != nil {
+			return errors.Wrapf(err, "render overlay %v", n)
+		}
+		if err := writeOverlay(filepath.Join(outDir, overlaysDir, n), base, resources); err != nil {
+			return errors.Wrapf(err, "overlay %v", n)
+		}
+	}
+	level.Info(logger).Log("msg", "generated kustomize base and overlays", "dir", outDir, "overlays", len(opts.Overlays))
+	return nil
+}
+
+func newKustomization() Kustomization {
+	return Kustomization{APIVersion: "kustomize.config.k8s.io/v1beta1", Kind: "Kustomization"}
+}
+
+// writeOverlay writes overlay with JSON6902 patches for changed resources, strategic merge delete patches for resources
+// that are not rendered anymore and new resources.
+func writeOverlay(dir string, base, resources map[string]resource) error {
+	k := newKustomization()
+	k.Resources = []string{"../../" + baseDir}
+
+	for _, key := range sortedKeys(base) {
+		b := base[key]
+		patch := filepath.Join(patchesDir, b.file)
+		r, ok := resources[key]
+		if !ok {
+			del := map[string]interface{}{
+				"apiVersion": b.object["apiVersion"],
+				"kind":       b.object["kind"],
+				"metadata":   identity(b.object),
+				"$patch":     "delete",
+			}
+			if err := writeYAML(filepath.Join(dir, patch), del); err != nil {
+				return err
+			}
+			k.Patches = append(k.Patches, Patch{Path: filepath.ToSlash(patch)})
+			continue
+		}
+
+		ops := diff("", b.object, r.object)
+		if len(ops) == 0 {
+			continue
+		}
+		if err := writeYAML(filepath.Join(dir, patch), ops); err != nil {
+			return err
+		}
+		k.Patches = append(k.Patches, Patch{Path: filepath.ToSlash(patch), Target: target(b.object)})
+	}
+	for _, key := range sortedKeys(resources) {
+		if _, ok := base[key]; ok {
+			continue
+		}
+		r := resources[key]
+		if err := writeYAML(filepath.Join(dir, r.file), r.object); err != nil {
+			return err
+		}
+		k.Resources = append(k.Resources, r.file)
+	}
+	return writeYAML(filepath.Join(dir, kustomizationFile), k)
+}
+
+func readValues(file string) ([]byte, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "read values")
+	}
+	return b, nil
+}
+
+// renderResources renders template and returns resources by their group and item name.
+func renderResources(ctx context.Context, render rndrapi.RenderFunc, values []byte) (map[string]resource, error) {
+	groups, err := render(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]resource{}
+	for g, rs := range groups {
+		for _, r := range rs {
+			o := map[string]interface{}{}
+			if err := yaml.Unmarshal(r.Object, &o); err != nil {
+				return nil, errors.Wrapf(err, "parse %v from %v group", r.Item, g)
+			}
+			ret[g+"/"+r.Item] = resource{file: fmt.Sprintf("%s-%s.yaml", g, r.Item), object: o}
+		}
+	}
+	return ret, nil
+}
+
+// commonLabels returns labels from the commonLabels value, if there is one.
+func commonLabels(defaults, values []byte) (map[string]string, error) {
+	merged, err := rndrapi.MergeValues(defaults, values)
+	if err != nil {
+		return nil, err
+	}
+	v := map[string]interface{}{}
+	if err := yaml.Unmarshal(merged, &v); err != nil {
+		return nil, errors.Wrap(err, "parse values")
+	}
+	m, ok := v[labelsValue].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	ret := make(map[string]string, len(m))
+	for k, l := range m {
+		s, ok := l.(string)
+		if !ok {
+			return nil, errors.Errorf("%v.%v: label value has to be a string, got %v", labelsValue, k, l)
+		}
+		ret[k] = s
+	}
+	return ret, nil
+}
+
+func identity(o map[string]interface{}) map[string]interface{} {
+	m, _ := o["metadata"].(map[string]interface{})
+	ret := map[string]interface{}{"name": m["name"]}
+	if ns, ok := m["namespace"]; ok {
+		ret["namespace"] = ns
+	}
+	return ret
+}
+
+func target(o map[string]interface{}) *Target {
+	t := &Target{}
+	t.Kind, _ = o["kind"].(string)
+	apiVersion, _ := o["apiVersion"].(string)
+	t.Version = apiVersion
+	if i := strings.LastIndex(apiVersion, "/"); i > 0 {
+		t.Group, t.Version = apiVersion[:i], apiVersion[i+1:]
+	}
+	id := identity(o)
+	t.Name, _ = id["name"].(string)
+	t.Namespace, _ = id["namespace"].(string)
+	return t
+}
+
+// diff returns JSON6902 operations that change a into b. Arrays are replaced as a whole, since they are often
+// reordered by templates.
+func diff(path string, a, b interface{}) []Operation {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return []Operation{{Op: "replace", Path: path, Value: b}}
+	}
+
+	var ops []Operation
+	for _, k := range sortedKeys(am) {
+		p := path + "/" + escape(k)
+		bv, ok := bm[k]
+		if !ok {
+			ops = append(ops, Operation{Op: "remove", Path: p})
+			continue
+		}
+		ops = append(ops, diff(p, am[k], bv)...)
+	}
+	for _, k := range sortedKeys(bm) {
+		if _, ok := am[k]; !ok {
+			ops = append(ops, Operation{Op: "add", Path: path + "/" + escape(k), Value: bm[k]})
+		}
+	}
+	return ops
+}
+
+// escape escapes JSON pointer reference token.
+func escape(k string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1")
+}
+
+// overlayName returns overlay name for values file e.g `prod` for `prod.values.yaml`.
+func overlayName(file string) string {
+	n := filepath.Base(file)
+	n = strings.TrimSuffix(n, filepath.Ext(n))
+	return strings.TrimSuffix(n, ".values")
+}
+
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	ret := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		ret = append(ret, k.String())
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func writeYAML(file string, o interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	b := bytes.Buffer{}
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(o); err != nil {
+		return err
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b.Bytes(), os.ModePerm)
+}
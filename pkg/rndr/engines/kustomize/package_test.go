@@ -0,0 +1,150 @@
+package kustomize
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-kustomize-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	api := rndrapi.API{
+		Defaults: []byte("name: example\nreplicas: 1\nmonitoring: true\ncommonLabels:\n  app.kubernetes.io/name: hello\n"),
+	}
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		b, err := rndrapi.MergeValues(api.Defaults, valuesYAML)
+		if err != nil {
+			return nil, err
+		}
+		v := struct {
+			Name       string
+			Replicas   int
+			Monitoring bool
+			Config     bool
+		}{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+
+		g := rndrapi.Groups{"hello": []rndrapi.Resource{
+			{Item: "deployment", Object: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: " + v.Name + "\n  namespace: default\n  annotations:\n    a/b: c\nspec:\n  replicas: " + strconv.Itoa(v.Replicas) + "\n")},
+		}}
+		if v.Monitoring {
+			g["hello"] = append(g["hello"], rndrapi.Resource{Item: "service-monitor", Object: []byte("apiVersion: monitoring.coreos.com/v1\nkind: ServiceMonitor\nmetadata:\n  name: " + v.Name + "\n  namespace: default\n")})
+		}
+		if v.Config {
+			g["hello"] = append(g["hello"], rndrapi.Resource{Item: "config-map", Object: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + v.Name + "-config\n  namespace: default\n")})
+		}
+		return g, nil
+	}
+
+	overlay := filepath.Join(dir, "prod.values.yaml")
+	testutil.Ok(t, ioutil.WriteFile(overlay, []byte("name: hello-prod\nreplicas: 3\nmonitoring: false\nconfig: true\n"), os.ModePerm))
+
+	out := filepath.Join(dir, "out")
+	testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hello", api, render, PackageOptions{Overlays: []string{overlay}}, out))
+
+	read := func(t *testing.T, file string, o interface{}) {
+		t.Helper()
+
+		b, err := ioutil.ReadFile(filepath.Join(out, file))
+		testutil.Ok(t, err)
+		testutil.Ok(t, yaml.Unmarshal(b, o))
+	}
+
+	t.Run("base", func(t *testing.T) {
+		k := Kustomization{}
+		read(t, filepath.Join(baseDir, kustomizationFile), &k)
+		testutil.Equals(t, Kustomization{
+			APIVersion: "kustomize.config.k8s.io/v1beta1",
+			Kind:       "Kustomization",
+			Resources:  []string{"hello-deployment.yaml", "hello-service-monitor.yaml"},
+			Labels:     []Labels{{Pairs: map[string]string{"app.kubernetes.io/name": "hello"}}},
+		}, k)
+
+		m := map[string]interface{}{}
+		read(t, filepath.Join(baseDir, "hello-deployment.yaml"), &m)
+		testutil.Equals(t, "example", m["metadata"].(map[string]interface{})["name"])
+	})
+	t.Run("overlay", func(t *testing.T) {
+		k := Kustomization{}
+		read(t, filepath.Join(overlaysDir, "prod", kustomizationFile), &k)
+		testutil.Equals(t, Kustomization{
+			APIVersion: "kustomize.config.k8s.io/v1beta1",
+			Kind:       "Kustomization",
+			Resources:  []string{"../../base", "hello-config-map.yaml"},
+			Patches: []Patch{
+				{
+					Path:   "patches/hello-deployment.yaml",
+					Target: &Target{Group: "apps", Version: "v1", Kind: "Deployment", Name: "example", Namespace: "default"},
+				},
+				{Path: "patches/hello-service-monitor.yaml"},
+			},
+		}, k)
+
+		del := map[string]interface{}{}
+		read(t, filepath.Join(overlaysDir, "prod", "patches", "hello-service-monitor.yaml"), &del)
+		testutil.Equals(t, map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "ServiceMonitor",
+			"metadata":   map[string]interface{}{"name": "example", "namespace": "default"},
+			"$patch":     "delete",
+		}, del)
+
+		// Patching base deployment has to give the one rendered with overlay values.
+		var ops []interface{}
+		read(t, filepath.Join(overlaysDir, "prod", "patches", "hello-deployment.yaml"), &ops)
+		base := map[string]interface{}{}
+		read(t, filepath.Join(baseDir, "hello-deployment.yaml"), &base)
+
+		opsJSON, err := json.Marshal(ops)
+		testutil.Ok(t, err)
+		patch, err := jsonpatch.DecodePatch(opsJSON)
+		testutil.Ok(t, err)
+		baseJSON, err := json.Marshal(base)
+		testutil.Ok(t, err)
+		got, err := patch.Apply(baseJSON)
+		testutil.Ok(t, err)
+		testutil.Equals(t, `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{"a/b":"c"},"name":"hello-prod","namespace":"default"},"spec":{"replicas":3}}`, string(got))
+	})
+	t.Run("same overlay names", func(t *testing.T) {
+		testutil.NotOk(t, Package(context.Background(), log.NewNopLogger(), "hello", api, render, PackageOptions{Overlays: []string{overlay, filepath.Join(dir, "other", "prod.yaml")}}, out))
+	})
+	t.Run("non-string label", func(t *testing.T) {
+		values := filepath.Join(dir, "labels.yaml")
+		testutil.Ok(t, ioutil.WriteFile(values, []byte("commonLabels:\n  version: 1.8\n"), os.ModePerm))
+		err := Package(context.Background(), log.NewNopLogger(), "hello", api, render, PackageOptions{Values: values}, out)
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "commonLabels.version: label value has to be a string, got 1.8", err.Error())
+	})
+}
+
+func TestDiff(t *testing.T) {
+	a := map[string]interface{}{"a": 1, "b": map[string]interface{}{"c/d": "x", "e": []interface{}{1, 2}}, "f": 0}
+	b := map[string]interface{}{"a": 1, "b": map[string]interface{}{"c/d": "y", "e": []interface{}{2}}, "g": 0}
+
+	ops := diff("", a, b)
+	testutil.Equals(t, []Operation{
+		{Op: "replace", Path: "/b/c~1d", Value: "y"},
+		{Op: "replace", Path: "/b/e", Value: []interface{}{2}},
+		{Op: "remove", Path: "/f"},
+		{Op: "add", Path: "/g", Value: 0},
+	}, ops)
+
+	o, err := yaml.Marshal(ops)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "- op: replace\n  path: /b/c~1d\n  value: \"y\"\n- op: replace\n  path: /b/e\n  value:\n    - 2\n- op: remove\n  path: /f\n- op: add\n  path: /g\n  value: 0\n", string(o))
+}
@@ -0,0 +1,235 @@
+// Package olm generates Operator Lifecycle Manager (https://olm.operatorframework.io) bundles with the operator generated
+// for the template.
+package olm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/engines/kubeoperator"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+)
+
+// InstallModes supported by OLM.
+var InstallModes = []string{"OwnNamespace", "SingleNamespace", "MultiNamespace", "AllNamespaces"}
+
+type PackageOptions struct {
+	// Version is a semantic version of the operator bundle. Defaults to 0.1.0.
+	Version string
+	// Channels are channels bundle is published in. Defaults to `alpha`.
+	Channels []string
+	// DefaultChannel is a channel subscriptions use by default. Defaults to the first channel.
+	DefaultChannel string `yaml:"defaultChannel"`
+	// InstallModes are install modes (see InstallModes) operator supports. Defaults to `AllNamespaces`, since the
+	// operator watches custom resources in all namespaces.
+	InstallModes []string `yaml:"installModes"`
+	// Icon is a path to SVG or PNG icon of the operator.
+	Icon string
+	// MinKubeVersion is a minimum Kubernetes version operator supports e.g `1.16.0`.
+	MinKubeVersion string `yaml:"minKubeVersion"`
+	// Dockerfile controls if `bundle.Dockerfile` that builds bundle image is generated.
+	Dockerfile bool
+
+	// Operator configures generated operator and its custom resource.
+	Operator kubeoperator.Options `yaml:",inline"`
+}
+
+const (
+	manifestsDir = "manifests"
+	metadataDir  = "metadata"
+)
+
+// Package generates OLM bundle in given directory: `manifests` with ClusterServiceVersion, CRD generated from the template
+// API and ConfigMap with the template code, and `metadata/annotations.yaml`. Install strategy deploys locutus based
+// operator that reconciles custom resources into objects rendered by the template.
+func Package(ctx context.Context, logger log.Logger, name, author string, api rndrapi.API, renderer *jsonnet.TemplateRenderer, render rndrapi.RenderFunc, opts PackageOptions, outDir string) error {
+	op, err := kubeoperator.New(ctx, logger, name, api, renderer, render, opts.Operator)
+	if err != nil {
+		return errors.Wrap(err, "generate operator")
+	}
+
+	if opts.Version == "" {
+		opts.Version = "0.1.0"
+	}
+	if len(opts.Channels) == 0 {
+		opts.Channels = []string{"alpha"}
+	}
+	if opts.DefaultChannel == "" {
+		opts.DefaultChannel = opts.Channels[0]
+	}
+	if len(opts.InstallModes) == 0 {
+		opts.InstallModes = []string{"AllNamespaces"}
+	}
+
+	csv, err := clusterServiceVersion(name, author, op, opts)
+	if err != nil {
+		return errors.Wrap(err, "generate ClusterServiceVersion")
+	}
+
+	manifests := filepath.Join(outDir, manifestsDir)
+	if err := kubeoperator.WriteYAML(filepath.Join(manifests, name+".clusterserviceversion.yaml"), csv); err != nil {
+		return err
+	}
+	if err := kubeoperator.WriteYAML(filepath.Join(manifests, op.CRD.Spec.Group+"_"+op.CRD.Spec.Names.Plural+".yaml"), op.CRD); err != nil {
+		return err
+	}
+	if err := kubeoperator.WriteYAML(filepath.Join(manifests, op.Name+"-template_v1_configmap.yaml"), op.ConfigMap); err != nil {
+		return err
+	}
+
+	annotations := bundleAnnotations(name, opts)
+	if err := kubeoperator.WriteYAML(filepath.Join(outDir, metadataDir, "annotations.yaml"), map[string]interface{}{"annotations": annotations}); err != nil {
+		return err
+	}
+	if opts.Dockerfile {
+		if err := ioutil.WriteFile(filepath.Join(outDir, "bundle.Dockerfile"), dockerfile(annotations), os.ModePerm); err != nil {
+			return err
+		}
+	}
+	level.Info(logger).Log("msg", "generated OLM bundle", "dir", outDir, "version", opts.Version, "channels", strings.Join(opts.Channels, ","))
+	return nil
+}
+
+func clusterServiceVersion(name, author string, op *kubeoperator.Operator, opts PackageOptions) (map[string]interface{}, error) {
+	installModes := make([]map[string]interface{}, 0, len(InstallModes))
+	for _, m := range InstallModes {
+		installModes = append(installModes, map[string]interface{}{"type": m, "supported": contains(opts.InstallModes, m)})
+	}
+	for _, m := range opts.InstallModes {
+		if !contains(InstallModes, m) {
+			return nil, errors.Errorf("unknown install mode %v; supported: %v", m, strings.Join(InstallModes, ", "))
+		}
+	}
+
+	example, err := json.Marshal([]interface{}{op.Example})
+	if err != nil {
+		return nil, err
+	}
+
+	crdNames := op.CRD.Spec.Names
+	versions := op.CRD.Spec.Versions
+	spec := map[string]interface{}{
+		"displayName":  name,
+		"description":  fmt.Sprintf("Operator for %s generated by rndr. It deploys %s configured by %s custom resources.", name, name, crdNames.Kind),
+		"version":      opts.Version,
+		"maintainers":  maintainers(author),
+		"provider":     map[string]interface{}{"name": author},
+		"keywords":     []string{name},
+		"installModes": installModes,
+		"customresourcedefinitions": map[string]interface{}{
+			"owned": []map[string]interface{}{{
+				"name":        op.CRD.Metadata.Name,
+				"version":     versions[len(versions)-1].Name,
+				"kind":        crdNames.Kind,
+				"displayName": crdNames.Kind,
+				"description": versions[len(versions)-1].Schema.OpenAPIV3Schema.Description,
+			}},
+		},
+		"install": map[string]interface{}{
+			"strategy": "deployment",
+			"spec": map[string]interface{}{
+				"clusterPermissions": []map[string]interface{}{{"serviceAccountName": op.Name, "rules": op.Rules}},
+				"deployments":        []map[string]interface{}{{"name": op.Name, "spec": op.Deployment}},
+			},
+		},
+	}
+	if opts.MinKubeVersion != "" {
+		spec["minKubeVersion"] = opts.MinKubeVersion
+	}
+	if opts.Icon != "" {
+		b, err := ioutil.ReadFile(opts.Icon)
+		if err != nil {
+			return nil, errors.Wrap(err, "read icon")
+		}
+		mediaType := http.DetectContentType(b)
+		if strings.HasSuffix(opts.Icon, ".svg") {
+			// SVG is detected as XML or text.
+			mediaType = "image/svg+xml"
+		}
+		if mediaType != "image/svg+xml" && mediaType != "image/png" {
+			return nil, errors.Errorf("icon has to be SVG or PNG, got %v", mediaType)
+		}
+		spec["icon"] = []map[string]interface{}{{"base64data": base64.StdEncoding.EncodeToString(b), "mediatype": mediaType}}
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "operators.coreos.com/v1alpha1",
+		"kind":       "ClusterServiceVersion",
+		"metadata": map[string]interface{}{
+			"name": name + ".v" + opts.Version,
+			"annotations": map[string]interface{}{
+				"alm-examples": string(example),
+				"capabilities": "Basic Install",
+			},
+		},
+		"spec": spec,
+	}, nil
+}
+
+func bundleAnnotations(name string, opts PackageOptions) map[string]string {
+	return map[string]string{
+		"operators.operatorframework.io.bundle.mediatype.v1":       "registry+v1",
+		"operators.operatorframework.io.bundle.manifests.v1":       manifestsDir + "/",
+		"operators.operatorframework.io.bundle.metadata.v1":        metadataDir + "/",
+		"operators.operatorframework.io.bundle.package.v1":         name,
+		"operators.operatorframework.io.bundle.channels.v1":        strings.Join(opts.Channels, ","),
+		"operators.operatorframework.io.bundle.channel.default.v1": opts.DefaultChannel,
+	}
+}
+
+// dockerfile returns bundle image Dockerfile. Image labels have to be the same as bundle annotations.
+func dockerfile(annotations map[string]string) []byte {
+	b := strings.Builder{}
+	b.WriteString("FROM scratch\n\n")
+	for _, k := range []string{
+		"operators.operatorframework.io.bundle.mediatype.v1",
+		"operators.operatorframework.io.bundle.manifests.v1",
+		"operators.operatorframework.io.bundle.metadata.v1",
+		"operators.operatorframework.io.bundle.package.v1",
+		"operators.operatorframework.io.bundle.channels.v1",
+		"operators.operatorframework.io.bundle.channel.default.v1",
+	} {
+		fmt.Fprintf(&b, "LABEL %s=%s\n", k, annotations[k])
+	}
+	fmt.Fprintf(&b, "\nCOPY %s /%s/\nCOPY %s /%s/\n", manifestsDir, manifestsDir, metadataDir, metadataDir)
+	return []byte(b.String())
+}
+
+// maintainers parses author(s) in form of RFC 5322 address list e.g `Team <team@example.com>, other@example.com`.
+// If that fails, author is used as maintainer name.
+func maintainers(author string) []map[string]string {
+	addrs, err := mail.ParseAddressList(author)
+	if err != nil {
+		return []map[string]string{{"name": author}}
+	}
+	ret := make([]map[string]string, 0, len(addrs))
+	for _, a := range addrs {
+		m := map[string]string{"name": a.Name, "email": a.Address}
+		if m["name"] == "" {
+			m["name"] = a.Address
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package olm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-olm-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "tmpl", "lib"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "tmpl", "lib", "labels.libsonnet"), []byte("{ app: 'hello' }\n"), os.ModePerm))
+	fn := filepath.Join(dir, "tmpl", "hello.libsonnet")
+	testutil.Ok(t, ioutil.WriteFile(fn, []byte(`local labels = import 'lib/labels.libsonnet';
+function(values) {
+  deployment: { apiVersion: 'apps/v1', kind: 'Deployment', metadata: { name: values.name, labels: labels } },
+  service: { apiVersion: 'v1', kind: 'Service', metadata: { name: values.name, labels: labels } },
+}
+`), os.ModePerm))
+
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type:       "object",
+			Required:   []string{"name"},
+			Properties: map[string]*rndrapi.Schema{"name": {Type: "string"}},
+		},
+		Defaults: []byte("name: example\n"),
+	}
+	render := func(context.Context, []byte) (rndrapi.Groups, error) {
+		return rndrapi.Groups{"hello": {
+			{Item: "deployment", Object: []byte("apiVersion: apps/v1\nkind: Deployment\n")},
+			{Item: "service", Object: []byte("apiVersion: v1\nkind: Service\n")},
+		}}, nil
+	}
+
+	t.Run("no jsonnet renderer", func(t *testing.T) {
+		testutil.NotOk(t, Package(context.Background(), log.NewNopLogger(), "hello", "team@example.com", api, nil, render, PackageOptions{}, dir))
+	})
+	t.Run("unknown install mode", func(t *testing.T) {
+		testutil.NotOk(t, Package(context.Background(), log.NewNopLogger(), "hello", "team@example.com", api, &jsonnet.TemplateRenderer{Functions: []string{fn}}, render, PackageOptions{InstallModes: []string{"Everywhere"}}, dir))
+	})
+
+	out := filepath.Join(dir, "bundle")
+	testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hello", "Team <team@example.com>", api, &jsonnet.TemplateRenderer{Functions: []string{fn}}, render, PackageOptions{
+		Channels:   []string{"stable", "alpha"},
+		Dockerfile: true,
+	}, out))
+
+	for _, f := range []string{
+		"manifests/hello.clusterserviceversion.yaml",
+		"manifests/rndr.observatorium.io_hellos.yaml",
+		"manifests/hello-operator-template_v1_configmap.yaml",
+		"metadata/annotations.yaml",
+		"bundle.Dockerfile",
+	} {
+		_, err := os.Stat(filepath.Join(out, f))
+		testutil.Ok(t, err)
+	}
+
+	csv := struct {
+		Metadata struct {
+			Name        string
+			Annotations map[string]string
+		}
+		Spec struct {
+			Version     string
+			Maintainers []map[string]string
+			Install     struct {
+				Spec struct {
+					ClusterPermissions []struct {
+						ServiceAccountName string `yaml:"serviceAccountName"`
+						Rules              []struct {
+							APIGroups []string `yaml:"apiGroups"`
+							Resources []string
+						}
+					} `yaml:"clusterPermissions"`
+				}
+			}
+		}
+	}{}
+	b, err := ioutil.ReadFile(filepath.Join(out, "manifests/hello.clusterserviceversion.yaml"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, yaml.Unmarshal(b, &csv))
+	testutil.Equals(t, "hello.v0.1.0", csv.Metadata.Name)
+	testutil.Equals(t, `[{"apiVersion":"rndr.observatorium.io/v1alpha1","kind":"Hello","metadata":{"name":"hello"},"spec":{"name":"example"}}]`, csv.Metadata.Annotations["alm-examples"])
+	testutil.Equals(t, []map[string]string{{"name": "Team", "email": "team@example.com"}}, csv.Spec.Maintainers)
+
+	perms := csv.Spec.Install.Spec.ClusterPermissions
+	testutil.Equals(t, 1, len(perms))
+	testutil.Equals(t, "hello-operator", perms[0].ServiceAccountName)
+	testutil.Equals(t, 4, len(perms[0].Rules))
+	testutil.Equals(t, []string{"hellos"}, perms[0].Rules[0].Resources)
+	testutil.Equals(t, []string{""}, perms[0].Rules[2].APIGroups)
+	testutil.Equals(t, []string{"services"}, perms[0].Rules[2].Resources)
+	testutil.Equals(t, []string{"apps"}, perms[0].Rules[3].APIGroups)
+	testutil.Equals(t, []string{"deployments"}, perms[0].Rules[3].Resources)
+
+	cm := struct{ Data map[string]string }{}
+	b, err = ioutil.ReadFile(filepath.Join(out, "manifests/hello-operator-template_v1_configmap.yaml"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, yaml.Unmarshal(b, &cm))
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	testutil.Equals(t, 4, len(keys))
+	testutil.Equals(t, "{ app: 'hello' }\n", cm.Data["lib.labels.libsonnet"])
+	testutil.Assert(t, strings.Contains(cm.Data["main.jsonnet"], "hello.libsonnet"), cm.Data["main.jsonnet"])
+	testutil.Assert(t, strings.Contains(cm.Data["trigger.yaml"], "mainResource: hellos"), cm.Data["trigger.yaml"])
+
+	b, err = ioutil.ReadFile(filepath.Join(out, "bundle.Dockerfile"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, strings.Contains(string(b), "LABEL operators.operatorframework.io.bundle.channels.v1=stable,alpha\nLABEL operators.operatorframework.io.bundle.channel.default.v1=stable\n"), string(b))
+}
@@ -0,0 +1,204 @@
+// Package openshift generates OpenShift Templates (https://docs.openshift.com/container-platform/4.7/openshift_images/using-templates.html)
+// from rndr templates.
+package openshift
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/parametrize"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type PackageOptions struct {
+	// Values is a path to values YAML file the template is rendered with. API defaults are used for values not
+	// specified there.
+	Values string
+	// Parameters is a list of dot separated values paths (e.g `replicas` or `ports.http`) that become OpenShift
+	// Template parameters. Parameter names are upper case paths e.g `PORTS_HTTP`. Their default is the value rendered
+	// with, so from Values or API defaults.
+	// Only string and number values that template puts verbatim in resources can be parameters.
+	Parameters []string
+}
+
+// Parameter is OpenShift Template parameter.
+type Parameter struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Value       string `yaml:"value,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
+}
+
+const fileName = "template.yaml"
+
+// Package generates `template.openshift.io/v1` Template in template.yaml file in given directory. Template objects are
+// resources rendered with given values, where parameter values are replaced with parameter references.
+func Package(ctx context.Context, logger log.Logger, name, author string, api rndrapi.API, render rndrapi.RenderFunc, opts PackageOptions, outDir string) error {
+	var valuesYAML []byte
+	if opts.Values != "" {
+		b, err := ioutil.ReadFile(opts.Values)
+		if err != nil {
+			return errors.Wrap(err, "read values")
+		}
+		valuesYAML = b
+	}
+	merged, err := rndrapi.MergeValues(api.Defaults, valuesYAML)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(merged, &values); err != nil {
+		return errors.Wrap(err, "parse values")
+	}
+
+	params, err := parametrize.New(api.Schema, values, opts.Parameters)
+	if err != nil {
+		return err
+	}
+	names := map[string]string{}
+	parameters := make([]Parameter, 0, len(params))
+	for _, p := range params {
+		n := parameterName(p.Path)
+		if other, ok := names[n]; ok {
+			return errors.Errorf("values %v and %v have the same parameter name %v", other, p.Path, n)
+		}
+		names[n] = p.Path
+		parameters = append(parameters, Parameter{Name: n, Description: p.Schema.Description, Value: parameterValue(p.Default), Required: p.Required})
+	}
+
+	groups, err := params.Render(ctx, logger, render, values)
+	if err != nil {
+		return err
+	}
+
+	groupNames := make([]string, 0, len(groups))
+	for g := range groups {
+		groupNames = append(groupNames, g)
+	}
+	sort.Strings(groupNames)
+
+	objects := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, g := range groupNames {
+		for _, r := range groups[g] {
+			// OpenShift has no escape for parameter references, so rendered text referencing parameter would be substituted.
+			if ref := parameterReference(r.Object, names); ref != "" {
+				return errors.Errorf("%v from %v group contains %v, which OpenShift would substitute with parameter value", r.Item, g, ref)
+			}
+			o, err := params.Replace(r.Object, nil, parameterRef)
+			if err != nil {
+				return errors.Wrapf(err, "parametrize %v from %v group", r.Item, g)
+			}
+			var n yaml.Node
+			if err := yaml.Unmarshal(o, &n); err != nil {
+				return errors.Wrapf(err, "parse parametrized %v from %v group", r.Item, g)
+			}
+			objects.Content = append(objects.Content, n.Content...)
+		}
+	}
+
+	annotations := map[string]string{"description": fmt.Sprintf("OpenShift Template for %s generated by rndr.", name)}
+	if author != "" {
+		annotations["openshift.io/provider-display-name"] = author
+	}
+	tmpl := struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Metadata   struct {
+			Name        string            `yaml:"name"`
+			Annotations map[string]string `yaml:"annotations"`
+		} `yaml:"metadata"`
+		Objects    *yaml.Node  `yaml:"objects"`
+		Parameters []Parameter `yaml:"parameters,omitempty"`
+	}{APIVersion: "template.openshift.io/v1", Kind: "Template", Objects: objects, Parameters: parameters}
+	tmpl.Metadata.Name = name
+	tmpl.Metadata.Annotations = annotations
+
+	b := bytes.Buffer{}
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(tmpl); err != nil {
+		return err
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(outDir, fileName), b.Bytes(), os.ModePerm); err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "generated OpenShift Template", "file", filepath.Join(outDir, fileName), "parameters", strings.Join(opts.Parameters, ","))
+	return nil
+}
+
+// parameterName returns upper snake case name for dot separated values path e.g `POD_LABELS_APP` for `podLabels.app`.
+func parameterName(path string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range path {
+		switch {
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteRune('_')
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// parameterValue returns parameter default. OpenShift parameters are always strings.
+func parameterValue(v interface{}) string {
+	switch o := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return o
+	case int:
+		return strconv.Itoa(o)
+	case float64:
+		return strconv.FormatFloat(o, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", o)
+	}
+}
+
+var parameterReferenceRe = regexp.MustCompile(`\$\{\{?([a-zA-Z0-9_]+?)\}?\}`)
+
+// parameterReference returns the first reference to one of given parameters (e.g `${NAME}` or `${{NAME}}`) in b, or empty
+// string if there is none. References to other names are not substituted by OpenShift, so they are fine.
+func parameterReference(b []byte, names map[string]string) string {
+	for _, m := range parameterReferenceRe.FindAllSubmatch(b, -1) {
+		if _, ok := names[string(m[1])]; ok {
+			return string(m[0])
+		}
+	}
+	return ""
+}
+
+// parameterRef returns reference to the parameter. Whole non-string values use `${{NAME}}`, so OpenShift puts them as
+// non-string JSON values.
+func parameterRef(p parametrize.Parameter, whole bool) string {
+	if whole && p.Schema.Type != "string" {
+		return fmt.Sprintf("${{%s}}", parameterName(p.Path))
+	}
+	return fmt.Sprintf("${%s}", parameterName(p.Path))
+}
@@ -0,0 +1,125 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-openshift-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type:     "object",
+			Required: []string{"name"},
+			Properties: map[string]*rndrapi.Schema{
+				"name":     {Type: "string", Description: "Name of the deployment."},
+				"version":  {Type: "string"},
+				"replicas": {Type: "integer"},
+				"message":  {Type: "string"},
+			},
+		},
+		Defaults: []byte("name: example\nversion: \"1.8\"\nreplicas: 1\nmessage: '${NOT_A_PARAM}'\n"),
+	}
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		v := struct {
+			Name, Version, Message string
+			Replicas               int
+		}{}
+		if err := yaml.Unmarshal(valuesYAML, &v); err != nil {
+			return nil, err
+		}
+		return rndrapi.Groups{"hello": {{Item: "deployment", Object: []byte(fmt.Sprintf(`kind: Deployment
+metadata:
+  name: %s
+  annotations:
+    message: '%s'
+spec:
+  replicas: %d
+  image: hello:%s
+`, v.Name, v.Message, v.Replicas, v.Version))}}}, nil
+	}
+
+	values := filepath.Join(dir, "values.yaml")
+	testutil.Ok(t, ioutil.WriteFile(values, []byte("replicas: 3\n"), os.ModePerm))
+	testutil.Ok(t, Package(context.Background(), log.NewNopLogger(), "hellosvc", "Team <team@example.com>", api, render, PackageOptions{
+		Values:     values,
+		Parameters: []string{"name", "version", "replicas"},
+	}, dir))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "template.yaml"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, `apiVersion: template.openshift.io/v1
+kind: Template
+metadata:
+  name: hellosvc
+  annotations:
+    description: OpenShift Template for hellosvc generated by rndr.
+    openshift.io/provider-display-name: Team <team@example.com>
+objects:
+- kind: Deployment
+  metadata:
+    name: ${NAME}
+    annotations:
+      message: '${NOT_A_PARAM}'
+  spec:
+    replicas: ${{REPLICAS}}
+    image: "hello:${VERSION}"
+parameters:
+- name: NAME
+  description: Name of the deployment.
+  value: example
+  required: true
+- name: VERSION
+  value: "1.8"
+- name: REPLICAS
+  value: "3"
+`, string(b))
+}
+
+func TestPackage_ParameterReferenceInValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-openshift-package")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	api := rndrapi.API{
+		Schema: &rndrapi.Schema{
+			Type:       "object",
+			Properties: map[string]*rndrapi.Schema{"name": {Type: "string"}, "script": {Type: "string"}},
+		},
+		Defaults: []byte("name: example\nscript: echo ${NAME}\n"),
+	}
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		v := struct{ Name, Script string }{}
+		if err := yaml.Unmarshal(valuesYAML, &v); err != nil {
+			return nil, err
+		}
+		return rndrapi.Groups{"hello": {{Item: "config", Object: []byte(fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  script: %s\n", v.Name, v.Script))}}}, nil
+	}
+	err = Package(context.Background(), log.NewNopLogger(), "hellosvc", "", api, render, PackageOptions{Parameters: []string{"name"}}, dir)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "config from hello group contains ${NAME}, which OpenShift would substitute with parameter value", err.Error())
+}
+
+func TestParameterName(t *testing.T) {
+	for path, exp := range map[string]string{
+		"replicas":         "REPLICAS",
+		"ports.http":       "PORTS_HTTP",
+		"podLabelSelector": "POD_LABEL_SELECTOR",
+		"labels.app-name":  "LABELS_APP_NAME",
+		"v2Name":           "V2_NAME",
+	} {
+		testutil.Equals(t, exp, parameterName(path))
+	}
+}
@@ -0,0 +1,154 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/efficientgo/tools/core/pkg/errcapture"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type TemplateRenderer struct {
+	// Command is a local or absolute path to the executable that renders resources.
+	Command string
+	// Arguments are passed to the command as is, except `${<InputEnvVar>}` which is expanded to input YAML content.
+	// Arguments are not expanded if InputEnvVar is empty, since input is passed via stdin then.
+	Arguments []string
+	// InputEnvVar controls the name of variable with input YAML content e.g `INPUT`.
+	// If empty template input YAML is passed via stdin.
+	InputEnvVar string `yaml:"inputEnvVar"`
+	// Inputs are local or absolute paths of files the command reads e.g its scripts or data. They are watched like other
+	// template sources and are part of the render cache key.
+	Inputs []string
+}
+
+// Render executes configured process and parses multi-document YAML printed on its stdout into resources.
+// All resources land in single group named after the template.
+func Render(ctx context.Context, logger log.Logger, name string, c TemplateRenderer, valuesYAML []byte) (_ rndrapi.Groups, err error) {
+	args := make([]string, 0, len(c.Arguments))
+	for _, a := range c.Arguments {
+		if c.InputEnvVar != "" {
+			a = strings.ReplaceAll(a, fmt.Sprintf("${%s}", c.InputEnvVar), string(valuesYAML))
+		}
+		args = append(args, a)
+	}
+
+	cmd := exec.CommandContext(ctx, c.Command, args...)
+	cmd.Env = os.Environ()
+	if c.InputEnvVar != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", c.InputEnvVar, valuesYAML))
+	} else {
+		cmd.Stdin = bytes.NewReader(valuesYAML)
+	}
+
+	stdout := bytes.Buffer{}
+	cmd.Stdout = &stdout
+
+	stderr := &logWriter{logger: log.With(logger, "template", name, "cmd", filepath.Base(c.Command))}
+	defer errcapture.Do(&err, stderr.Close, "flush stderr")
+	cmd.Stderr = stderr
+
+	level.Debug(logger).Log("msg", "executing process renderer", "cmd", c.Command, "args", strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "execute %v", c.Command)
+	}
+
+	resources, err := parseResources(stdout.Bytes())
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse stdout of %v", c.Command)
+	}
+	if len(resources) == 0 {
+		return nil, errors.Errorf("no resources rendered by %v", c.Command)
+	}
+	return rndrapi.Groups{name: resources}, nil
+}
+
+// parseResources splits multi-document YAML into resources. Empty documents are skipped.
+func parseResources(b []byte) ([]rndrapi.Resource, error) {
+	var ret []rndrapi.Resource
+
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	for i := 0; ; i++ {
+		var n yaml.Node
+		if err := d.Decode(&n); err != nil {
+			if err == io.EOF {
+				return ret, nil
+			}
+			return nil, errors.Wrapf(err, "decode document %d", i)
+		}
+		if len(n.Content) == 0 || n.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		var meta struct {
+			Kind     string
+			Metadata struct {
+				Name string
+			}
+		}
+		if err := n.Decode(&meta); err != nil {
+			return nil, errors.Wrapf(err, "decode kind and name of document %d", i)
+		}
+
+		// TODO(bwplotka): Most likely we have to stick to JSON output.
+		o := bytes.Buffer{}
+		e := yaml.NewEncoder(&o)
+		e.SetIndent(2)
+		if err := e.Encode(&n); err != nil {
+			return nil, err
+		}
+		ret = append(ret, rndrapi.Resource{Item: itemName(meta.Kind, meta.Metadata.Name, len(ret)), Object: o.Bytes()})
+	}
+}
+
+func itemName(kind, name string, i int) string {
+	switch {
+	case kind != "" && name != "":
+		return fmt.Sprintf("%s-%s", strings.ToLower(kind), name)
+	case kind != "":
+		return strings.ToLower(kind)
+	default:
+		return fmt.Sprintf("object%d", i)
+	}
+}
+
+// logWriter forwards every written line to the logger.
+type logWriter struct {
+	logger log.Logger
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *logWriter) log(line []byte) {
+	if l := strings.TrimSpace(string(line)); l != "" {
+		level.Info(w.logger).Log("stderr", l)
+	}
+}
+
+// Close flushes remaining, not terminated line.
+func (w *logWriter) Close() error {
+	w.log(w.buf)
+	w.buf = nil
+	return nil
+}
@@ -0,0 +1,58 @@
+package process
+
+import (
+	"context"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestRender(t *testing.T) {
+	values := []byte("name: hello\n")
+
+	t.Run("stdin", func(t *testing.T) {
+		groups, err := Render(context.Background(), log.NewNopLogger(), "test", TemplateRenderer{
+			Command: "/bin/sh",
+			Arguments: []string{"-c", `echo "log line" >&2
+echo "---"
+echo "kind: ConfigMap"
+echo "metadata:"
+sed 's/^/  /'
+echo "---"
+echo "kind: Secret"
+echo "---"`},
+		}, values)
+		testutil.Ok(t, err)
+		testutil.Equals(t, rndrapi.Groups{"test": {
+			{Item: "configmap-hello", Object: []byte("kind: ConfigMap\nmetadata:\n  name: hello\n")},
+			{Item: "secret", Object: []byte("kind: Secret\n")},
+		}}, groups)
+	})
+	t.Run("env var", func(t *testing.T) {
+		groups, err := Render(context.Background(), log.NewNopLogger(), "test", TemplateRenderer{
+			Command:     "/bin/sh",
+			Arguments:   []string{"-c", `printf "kind: ConfigMap\nmetadata:\n  %sdata:\n  $INPUT" "${INPUT}"`},
+			InputEnvVar: "INPUT",
+		}, values)
+		testutil.Ok(t, err)
+		testutil.Equals(t, rndrapi.Groups{"test": {
+			{Item: "configmap-hello", Object: []byte("kind: ConfigMap\nmetadata:\n  name: hello\ndata:\n  name: hello\n")},
+		}}, groups)
+	})
+	t.Run("failing command", func(t *testing.T) {
+		_, err := Render(context.Background(), log.NewNopLogger(), "test", TemplateRenderer{
+			Command:   "/bin/sh",
+			Arguments: []string{"-c", "exit 1"},
+		}, values)
+		testutil.NotOk(t, err)
+	})
+	t.Run("no resources", func(t *testing.T) {
+		_, err := Render(context.Background(), log.NewNopLogger(), "test", TemplateRenderer{
+			Command:   "/bin/sh",
+			Arguments: []string{"-c", "true"},
+		}, values)
+		testutil.NotOk(t, err)
+	})
+}
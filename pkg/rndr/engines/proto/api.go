@@ -0,0 +1,180 @@
+package proto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	protoconfig "github.com/openproto/protoconfig/go"
+	"github.com/pkg/errors"
+	gproto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateAPI references proto message that defines template values.
+// Values are decoded using protobuf JSON mapping (https://developers.google.com/protocol-buffers/docs/proto3#json), so
+// fields are expected under their JSON names e.g `pod_label_selector` is expected as `podLabelSelector`.
+// ProtoConfig extensions (https://github.com/openproto/protoconfig) `default`, `required` and `experimental` are supported.
+type TemplateAPI struct {
+	// Message is a name of root proto Message to be assumed as entry point for API in .proto file.
+	// It can be either fully qualified (e.g `hellosvc.v1.HelloService`) or relative to the file package.
+	Message string
+	// File is destination to .proto file on local filesystem.
+	File string
+	// ImportPaths are directories to look up imports in. The directory of the File is always used first.
+	// Well-known types (`google/protobuf/*.proto`) and ProtoConfig extensions (`protoconfig/v1/extensions.proto`)
+	// can be imported without adding anything.
+	ImportPaths []string `yaml:"importPaths"`
+}
+
+// Load parses the .proto file with its imports and resolves the root message into values schema and default values.
+// Resolved API validates values by decoding them into the message.
+func Load(_ context.Context, logger log.Logger, api TemplateAPI) (rndrapi.API, error) {
+	md, err := loadMessage(api)
+	if err != nil {
+		return rndrapi.API{}, err
+	}
+
+	defaults, err := defaultsOf(md, map[string]bool{})
+	if err != nil {
+		return rndrapi.API{}, errors.Wrapf(err, "protoconfig defaults of %v", md.GetFullyQualifiedName())
+	}
+	var defaultsYAML []byte
+	if len(defaults) > 0 {
+		defaultsYAML, err = yaml.Marshal(defaults)
+		if err != nil {
+			return rndrapi.API{}, err
+		}
+	}
+
+	level.Debug(logger).Log("msg", "loaded proto API", "message", md.GetFullyQualifiedName(), "file", api.File)
+	return rndrapi.API{
+		Schema:   describe(md, map[string]bool{}),
+		Defaults: defaultsYAML,
+		Validate: func(valuesYAML, withDefaultsYAML []byte) error { return validate(md, valuesYAML, withDefaultsYAML) },
+	}, nil
+}
+
+func loadMessage(api TemplateAPI) (*desc.MessageDescriptor, error) {
+	p := protoparse.Parser{
+		ImportPaths:           append([]string{filepath.Dir(api.File)}, api.ImportPaths...),
+		IncludeSourceCodeInfo: true,
+		// Allows importing protoconfig extensions linked into this binary.
+		LookupImport: desc.LoadFileDescriptor,
+	}
+	fds, err := p.ParseFiles(filepath.Base(api.File))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %v", api.File)
+	}
+
+	fd := fds[0]
+	md := fd.FindMessage(api.Message)
+	if md == nil && fd.GetPackage() != "" {
+		md = fd.FindMessage(fd.GetPackage() + "." + api.Message)
+	}
+	if md == nil {
+		return nil, errors.Errorf("message %v not found in %v", api.Message, api.File)
+	}
+	return md, nil
+}
+
+// Sources returns .proto file with the API message and local files it transitively imports.
+func Sources(api TemplateAPI) ([]string, error) {
+	md, err := loadMessage(api)
+	if err != nil {
+		return nil, err
+	}
+	importPaths := append([]string{filepath.Dir(api.File)}, api.ImportPaths...)
+
+	ret := []string{api.File}
+	seen := map[string]struct{}{md.GetFile().GetName(): {}}
+	queue := md.GetFile().GetDependencies()
+	for len(queue) > 0 {
+		fd := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[fd.GetName()]; ok {
+			continue
+		}
+		seen[fd.GetName()] = struct{}{}
+		queue = append(queue, fd.GetDependencies()...)
+
+		// Imports linked into this binary (e.g well known types) are not on local filesystem.
+		for _, p := range importPaths {
+			f := filepath.Join(p, filepath.FromSlash(fd.GetName()))
+			if _, err := os.Stat(f); err == nil {
+				ret = append(ret, f)
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+// isWellKnown returns true if message has special JSON mapping (e.g google.protobuf.Duration is a string).
+func isWellKnown(md *desc.MessageDescriptor) bool {
+	return strings.HasPrefix(md.GetFullyQualifiedName(), "google.protobuf.")
+}
+
+// isNested returns true if field holds values of messages that are decoded field by field.
+func isNested(fd *desc.FieldDescriptor) bool {
+	if fd.IsMap() {
+		fd = fd.GetMapValueType()
+	}
+	return fd.GetMessageType() != nil && !isWellKnown(fd.GetMessageType())
+}
+
+func fieldOptions(fd *desc.FieldDescriptor) (def string, required bool, experimental bool) {
+	opts := fd.GetFieldOptions()
+	if opts == nil {
+		return "", false, false
+	}
+	def, _ = gproto.GetExtension(opts, protoconfig.E_Default).(string)
+	required, _ = gproto.GetExtension(opts, protoconfig.E_Required).(bool)
+	experimental, _ = gproto.GetExtension(opts, protoconfig.E_Experimental).(bool)
+	return def, required, experimental
+}
+
+// defaultsOf returns default values from ProtoConfig `default` options. Default of string field is taken verbatim, others
+// are parsed as YAML (e.g `5`, `true`, `[a, b]`).
+func defaultsOf(md *desc.MessageDescriptor, seen map[string]bool) (map[string]interface{}, error) {
+	if seen[md.GetFullyQualifiedName()] {
+		return nil, nil
+	}
+	seen[md.GetFullyQualifiedName()] = true
+	defer delete(seen, md.GetFullyQualifiedName())
+
+	ret := map[string]interface{}{}
+	for _, fd := range md.GetFields() {
+		def, _, _ := fieldOptions(fd)
+		if def != "" {
+			if fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING && !fd.IsRepeated() {
+				ret[fd.GetJSONName()] = def
+				continue
+			}
+			var v interface{}
+			if err := yaml.Unmarshal([]byte(def), &v); err != nil {
+				return nil, errors.Wrapf(err, "parse default of %v", fd.GetFullyQualifiedName())
+			}
+			ret[fd.GetJSONName()] = v
+			continue
+		}
+		if fd.IsRepeated() || !isNested(fd) {
+			continue
+		}
+		d, err := defaultsOf(fd.GetMessageType(), seen)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) > 0 {
+			ret[fd.GetJSONName()] = d
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,99 @@
+package proto
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestLoad(t *testing.T) {
+	api := TemplateAPI{Message: "HelloService", File: "testdata/hellosvc.proto", ImportPaths: []string{"testdata/include"}}
+
+	t.Run("not existing message", func(t *testing.T) {
+		_, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{Message: "Nope", File: api.File, ImportPaths: api.ImportPaths})
+		testutil.NotOk(t, err)
+	})
+	t.Run("missing import path", func(t *testing.T) {
+		_, err := Load(context.Background(), log.NewNopLogger(), TemplateAPI{Message: api.Message, File: api.File})
+		testutil.NotOk(t, err)
+	})
+	t.Run("schema and defaults", func(t *testing.T) {
+		a, err := Load(context.Background(), log.NewNopLogger(), api)
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, "HelloService configures hello service deployment.", a.Schema.Description)
+		testutil.Equals(t, []string{"name"}, a.Schema.Required)
+		testutil.Equals(t, &rndrapi.Schema{Type: "string", Description: "Name of the service."}, a.Schema.Properties["name"])
+		testutil.Equals(t, &rndrapi.Schema{Type: "string"}, a.Schema.Properties["timeout"])
+		testutil.Equals(t, &rndrapi.Schema{Type: "boolean", Nullable: true, Description: "Experimental."}, a.Schema.Properties["debug"])
+		testutil.Equals(t, &rndrapi.Schema{Type: "string", Enum: []interface{}{"INFO", "DEBUG"}}, a.Schema.Properties["logLevel"])
+		testutil.Equals(t, &rndrapi.Schema{Type: "object", AdditionalProperties: &rndrapi.Schema{Type: "string"}}, a.Schema.Properties["podLabelSelector"])
+		testutil.Equals(t, &rndrapi.Schema{Type: "array", Items: &rndrapi.Schema{
+			Type: "object",
+			Properties: map[string]*rndrapi.Schema{
+				"name": {Type: "string"},
+				"port": {Type: "integer", Format: "int32"},
+			},
+		}}, a.Schema.Properties["ports"])
+
+		testutil.Equals(t, "namespace: default\nreplicas: 1\nresources:\n    cpu: 100m\n", string(a.Defaults))
+	})
+	t.Run("validate", func(t *testing.T) {
+		a, err := Load(context.Background(), log.NewNopLogger(), api)
+		testutil.Ok(t, err)
+
+		values := []byte(`name: hello
+timeout: 5m
+debug: true
+logLevel: DEBUG
+podLabelSelector:
+  app: hello
+ports:
+- name: http
+  port: 8080
+disk:
+  path: /data
+`)
+		testutil.Ok(t, a.Validate(values, values))
+
+		// Original proto field names are accepted too, as by protobuf JSON mapping.
+		values = []byte("name: hello\nlog_level: DEBUG\npod_label_selector:\n  app: hello\n")
+		testutil.Ok(t, a.Validate(values, values))
+		values = []byte("name: hello\nlogLevel: INFO\nlog_level: DEBUG\n")
+		err = a.Validate(values, values)
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "line 3, column 1: log_level: field hellosvc.v1.HelloService.log_level is set twice, as logLevel and log_level", err.Error())
+
+		values = []byte(`timeout: 5 minutes
+logLevel: TRACE
+ports:
+- port: -1
+memory: {}
+disk: {}
+`)
+		err = a.Validate(values, values)
+		testutil.NotOk(t, err)
+		for _, exp := range []string{
+			"line 1, column 10: timeout: invalid hellosvc.v1.HelloService.timeout value",
+			"line 2, column 11: logLevel: invalid hellosvc.v1.HelloService.log_level value",
+			"line 4, column 9: ports[0].port: invalid common.Port.port value",
+			"line 6, column 1: disk: only one field of oneof storage can be set, got memory and disk",
+			"line 6, column 7: disk.path: required field hellosvc.v1.Disk.path not set",
+			"line 1, column 1: name: required field hellosvc.v1.HelloService.name not set",
+		} {
+			testutil.Assert(t, strings.Contains(err.Error(), exp), "expected %q in %v", exp, err)
+		}
+
+		// Required fields can be set by defaults. Defaults are not part of values, so errors point to the closest parent.
+		values = []byte("ports:\n- name: http\n")
+		withDefaults, err := rndrapi.MergeValues([]byte("name: hello\ndisk: {}\n"), values)
+		testutil.Ok(t, err)
+		err = a.Validate(values, withDefaults)
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "line 1, column 1: disk.path: required field hellosvc.v1.Disk.path not set", err.Error())
+	})
+}
@@ -0,0 +1,121 @@
+package proto
+
+import (
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// describe returns schema of the message JSON mapping.
+func describe(md *desc.MessageDescriptor, seen map[string]bool) *rndrapi.Schema {
+	if s, ok := describeWellKnown(md); ok {
+		return s
+	}
+	if seen[md.GetFullyQualifiedName()] {
+		// Recursive message, we can't describe it further.
+		return &rndrapi.Schema{Type: "object", XPreserveUnknownFields: true}
+	}
+	seen[md.GetFullyQualifiedName()] = true
+	defer delete(seen, md.GetFullyQualifiedName())
+
+	s := &rndrapi.Schema{
+		Type:        "object",
+		Description: comment(md.GetSourceInfo()),
+		Properties:  map[string]*rndrapi.Schema{},
+	}
+	for _, fd := range md.GetFields() {
+		fs := describeField(fd, seen)
+		_, required, experimental := fieldOptions(fd)
+		fs.Description = comment(fd.GetSourceInfo())
+		if experimental {
+			fs.Description = strings.TrimSpace("Experimental. " + fs.Description)
+		}
+		s.Properties[fd.GetJSONName()] = fs
+		if required {
+			s.Required = append(s.Required, fd.GetJSONName())
+		}
+	}
+	return s
+}
+
+func describeField(fd *desc.FieldDescriptor, seen map[string]bool) *rndrapi.Schema {
+	switch {
+	case fd.IsMap():
+		return &rndrapi.Schema{Type: "object", AdditionalProperties: describeValue(fd.GetMapValueType(), seen)}
+	case fd.IsRepeated():
+		return &rndrapi.Schema{Type: "array", Items: describeValue(fd, seen)}
+	default:
+		return describeValue(fd, seen)
+	}
+}
+
+func describeValue(fd *desc.FieldDescriptor, seen map[string]bool) *rndrapi.Schema {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		s := describe(fd.GetMessageType(), seen)
+		// Description belongs to the field, not to the message type.
+		c := *s
+		c.Description = ""
+		return &c
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		s := &rndrapi.Schema{Type: "string"}
+		for _, v := range fd.GetEnumType().GetValues() {
+			s.Enum = append(s.Enum, v.GetName())
+		}
+		return s
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return &rndrapi.Schema{Type: "boolean"}
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return &rndrapi.Schema{Type: "string"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return &rndrapi.Schema{Type: "string", Format: "byte"}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return &rndrapi.Schema{Type: "number", Format: "float"}
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return &rndrapi.Schema{Type: "number", Format: "double"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return &rndrapi.Schema{Type: "integer", Format: "int32"}
+	default:
+		return &rndrapi.Schema{Type: "integer", Format: "int64"}
+	}
+}
+
+// describeWellKnown returns schema of well-known types that have special JSON mapping.
+func describeWellKnown(md *desc.MessageDescriptor) (*rndrapi.Schema, bool) {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Timestamp":
+		return &rndrapi.Schema{Type: "string", Format: "date-time"}, true
+	case "google.protobuf.Duration", "google.protobuf.FieldMask":
+		return &rndrapi.Schema{Type: "string"}, true
+	case "google.protobuf.Struct", "google.protobuf.Any":
+		return &rndrapi.Schema{Type: "object", XPreserveUnknownFields: true}, true
+	case "google.protobuf.Value":
+		return &rndrapi.Schema{XPreserveUnknownFields: true}, true
+	case "google.protobuf.ListValue":
+		return &rndrapi.Schema{Type: "array", Items: &rndrapi.Schema{XPreserveUnknownFields: true}}, true
+	case "google.protobuf.Empty":
+		return &rndrapi.Schema{Type: "object", Properties: map[string]*rndrapi.Schema{}}, true
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue", "google.protobuf.Int64Value",
+		"google.protobuf.UInt64Value", "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		// Wrappers are represented as wrapped value.
+		s := describeValue(md.FindFieldByName("value"), nil)
+		s.Nullable = true
+		return s, true
+	}
+	return nil, false
+}
+
+// comment returns leading comment of the proto element without comment markers.
+func comment(loc *descriptorpb.SourceCodeInfo_Location) string {
+	lines := strings.Split(strings.TrimSpace(loc.GetLeadingComments()), "\n")
+	for i := range lines {
+		// ProtoConfig definitions often use `///` for documentation comments.
+		lines[i] = strings.TrimSpace(strings.TrimLeft(lines[i], "/"))
+	}
+	return strings.TrimSpace(strings.Join(lines, " "))
+}
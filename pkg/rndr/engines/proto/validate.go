@@ -0,0 +1,223 @@
+package proto
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/efficientgo/tools/core/pkg/merrors"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// validate decodes values into the message using protobuf JSON mapping. On top of that, it checks that at most one
+// field of each oneof is set and that fields marked with ProtoConfig `required` option are set. Required fields are
+// checked in values merged with defaults, since default value satisfies the requirement.
+// Errors name the field path and YAML position.
+func validate(md *desc.MessageDescriptor, valuesYAML, withDefaultsYAML []byte) error {
+	var n yaml.Node
+	if err := yaml.Unmarshal(valuesYAML, &n); err != nil {
+		return errors.Wrap(err, "parse values")
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Line: 1, Column: 1}
+	if len(n.Content) > 0 {
+		root = n.Content[0]
+	}
+
+	errs := merrors.New()
+	validateMessage(md, root, "", errs)
+
+	var d yaml.Node
+	if err := yaml.Unmarshal(withDefaultsYAML, &d); err != nil {
+		return errors.Wrap(err, "parse values with defaults")
+	}
+	root = &yaml.Node{Kind: yaml.MappingNode}
+	if len(d.Content) > 0 {
+		root = d.Content[0]
+	}
+	validateRequired(md, root, "", nil, valuesYAML, errs)
+	return errs.Err()
+}
+
+func fail(errs *merrors.NilOrMultiError, n *yaml.Node, path string, format string, args ...interface{}) {
+	errs.Add(rndrapi.ValidationError{Path: path, Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+func childPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func validateMessage(md *desc.MessageDescriptor, n *yaml.Node, path string, errs *merrors.NilOrMultiError) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if isNull(n) {
+		return
+	}
+	if n.Kind != yaml.MappingNode {
+		fail(errs, n, path, "expected %v object", md.GetFullyQualifiedName())
+		return
+	}
+
+	// Like protobuf JSON mapping, both JSON and original proto field names are accepted.
+	fields := map[string]*desc.FieldDescriptor{}
+	for _, fd := range md.GetFields() {
+		fields[fd.GetJSONName()] = fd
+		fields[fd.GetName()] = fd
+	}
+
+	set := map[*desc.FieldDescriptor]string{}
+	oneofs := map[*desc.OneOfDescriptor]string{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		p := childPath(path, k.Value)
+
+		fd, ok := fields[k.Value]
+		if !ok {
+			fail(errs, k, p, "unknown field of %v; expected one of: %s", md.GetFullyQualifiedName(), strings.Join(jsonNames(md), ", "))
+			continue
+		}
+		if other, ok := set[fd]; ok {
+			fail(errs, k, p, "field %v is set twice, as %v and %v", fd.GetFullyQualifiedName(), other, k.Value)
+			continue
+		}
+		set[fd] = k.Value
+		if isNull(v) {
+			continue
+		}
+
+		if oo := fd.GetOneOf(); oo != nil && !oo.IsSynthetic() {
+			if other, ok := oneofs[oo]; ok {
+				fail(errs, k, p, "only one field of oneof %v can be set, got %v and %v", oo.GetName(), other, k.Value)
+			}
+			oneofs[oo] = k.Value
+		}
+		validateField(fd, v, p, errs)
+	}
+}
+
+func validateField(fd *desc.FieldDescriptor, n *yaml.Node, path string, errs *merrors.NilOrMultiError) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if !isNested(fd) {
+		// Scalars, enums and well-known types are checked by decoding them with protobuf JSON mapping.
+		decodeField(fd, n, path, errs)
+		return
+	}
+
+	switch {
+	case fd.IsMap():
+		if n.Kind != yaml.MappingNode {
+			fail(errs, n, path, "expected object")
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			validateMessage(fd.GetMapValueType().GetMessageType(), n.Content[i+1], childPath(path, n.Content[i].Value), errs)
+		}
+	case fd.IsRepeated():
+		if n.Kind != yaml.SequenceNode {
+			fail(errs, n, path, "expected array")
+			return
+		}
+		for i, e := range n.Content {
+			validateMessage(fd.GetMessageType(), e, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	default:
+		validateMessage(fd.GetMessageType(), n, path, errs)
+	}
+}
+
+// validateRequired reports required fields missing in n, which are values merged with defaults. Values merged with
+// defaults have no position in values YAML, so errors point to the closest parent in valuesYAML, found by keys.
+func validateRequired(md *desc.MessageDescriptor, n *yaml.Node, path string, keys []string, valuesYAML []byte, errs *merrors.NilOrMultiError) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.MappingNode {
+		// Null or type mismatch, which is reported by validateMessage.
+		return
+	}
+	childKeys := func(k ...string) []string {
+		return append(append(make([]string, 0, len(keys)+len(k)), keys...), k...)
+	}
+
+	values := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isNull(n.Content[i+1]) {
+			values[n.Content[i].Value] = n.Content[i+1]
+		}
+	}
+	for _, fd := range md.GetFields() {
+		p := childPath(path, fd.GetJSONName())
+		name := fd.GetJSONName()
+		v, ok := values[name]
+		if !ok {
+			name = fd.GetName()
+			v, ok = values[name]
+		}
+		if !ok {
+			if _, required, _ := fieldOptions(fd); required {
+				line, column := rndrapi.Position(valuesYAML, keys)
+				errs.Add(rndrapi.ValidationError{Path: p, Line: line, Column: column, Msg: fmt.Sprintf("required field %v not set", fd.GetFullyQualifiedName())})
+			}
+			continue
+		}
+		if !isNested(fd) {
+			continue
+		}
+		if v.Kind == yaml.AliasNode {
+			v = v.Alias
+		}
+		switch {
+		case fd.IsMap():
+			for i := 0; v.Kind == yaml.MappingNode && i+1 < len(v.Content); i += 2 {
+				k := v.Content[i].Value
+				validateRequired(fd.GetMapValueType().GetMessageType(), v.Content[i+1], childPath(p, k), childKeys(name, k), valuesYAML, errs)
+			}
+		case fd.IsRepeated():
+			for i := 0; v.Kind == yaml.SequenceNode && i < len(v.Content); i++ {
+				validateRequired(fd.GetMessageType(), v.Content[i], fmt.Sprintf("%s[%d]", p, i), childKeys(name, strconv.Itoa(i)), valuesYAML, errs)
+			}
+		default:
+			validateRequired(fd.GetMessageType(), v, p, childKeys(name), valuesYAML, errs)
+		}
+	}
+}
+
+func decodeField(fd *desc.FieldDescriptor, n *yaml.Node, path string, errs *merrors.NilOrMultiError) {
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		fail(errs, n, path, "%v", err)
+		return
+	}
+	b, err := json.Marshal(map[string]interface{}{fd.GetJSONName(): v})
+	if err != nil {
+		fail(errs, n, path, "%v", err)
+		return
+	}
+	if err := dynamic.NewMessage(fd.GetOwner()).UnmarshalJSON(b); err != nil {
+		fail(errs, n, path, "invalid %v value: %v", fd.GetFullyQualifiedName(), err)
+	}
+}
+
+func jsonNames(md *desc.MessageDescriptor) []string {
+	names := make([]string, 0, len(md.GetFields()))
+	for _, fd := range md.GetFields() {
+		names = append(names, fd.GetJSONName())
+	}
+	sort.Strings(names)
+	return names
+}
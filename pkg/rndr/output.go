@@ -0,0 +1,318 @@
+package rndr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Layout specifies how rendered resources are laid out in output files.
+type Layout string
+
+const (
+	// GroupLayout writes each resource into `<group>/<index>-<item>.yaml` file.
+	GroupLayout Layout = "group"
+	// KindLayout writes each resource into `<kind>-<name>.yaml` file e.g `deployment-hellosvc.yaml`, prefixed with
+	// `<namespace>-` for namespaced resources, so resources with the same name in different namespaces don't share file.
+	KindLayout Layout = "kind"
+	// StreamLayout writes all resources into single multi-document `resources.yaml` file.
+	StreamLayout Layout = "stream"
+	// PatternLayout writes each resource into file with path rendered from OutputOptions.Pattern.
+	PatternLayout Layout = "pattern"
+)
+
+// Layouts returns all supported layouts.
+func Layouts() []Layout {
+	return []Layout{GroupLayout, KindLayout, StreamLayout, PatternLayout}
+}
+
+// OutputOptions specifies how rendered resources are written into the output directory.
+type OutputOptions struct {
+	// Layout is GroupLayout if empty.
+	Layout Layout
+	// Pattern is Go text/template of the file path relative to the output directory, used by PatternLayout
+	// e.g `{{ .Namespace }}/{{ .Kind | lower }}-{{ .Name }}.yaml`. It gets OutputResource and has `lower` function. Resources with the same path are written
+	// into the same file as multiple YAML documents.
+	Pattern string
+	// FileMode is a mode of written files. 0644 is used if zero.
+	FileMode os.FileMode
+	// Clean removes files written by the previous WriteOutput into the output directory that were not written this
+	// time, e.g files of renamed resources. Other files in the output directory are kept.
+	Clean bool
+}
+
+// ManifestFile is a file in the output directory listing files written there by the last WriteOutput. It has no YAML
+// extension, so it's not mistaken for a resource.
+const ManifestFile = ".rndr-manifest"
+
+// OutputResource is a rendered resource passed to the OutputOptions.Pattern.
+type OutputResource struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	// Group is a template group resource was rendered in, Item is its name there and Index its position.
+	Group string
+	Item  string
+	Index int
+}
+
+// Files returns content of output files by their slash separated paths relative to the output directory. Resources are
+// ordered by group name and their position in group, so the output is deterministic.
+func (o OutputOptions) Files(groups rndrapi.Groups) (map[string][]byte, error) {
+	var pattern *template.Template
+	switch o.Layout {
+	case "", GroupLayout, KindLayout, StreamLayout:
+	case PatternLayout:
+		if o.Pattern == "" {
+			return nil, errors.New("pattern layout requires pattern")
+		}
+		var err error
+		if pattern, err = template.New("path").Funcs(template.FuncMap{"lower": strings.ToLower}).Option("missingkey=error").Parse(o.Pattern); err != nil {
+			return nil, errors.Wrap(err, "parse path pattern")
+		}
+	default:
+		return nil, errors.Errorf("unknown output layout %q; supported: %v", o.Layout, Layouts())
+	}
+
+	files := map[string][]byte{}
+	for _, g := range sortedGroups(groups) {
+		for i, r := range groups[g] {
+			res, err := outputResource(g, i, r)
+			if err != nil {
+				return nil, err
+			}
+
+			var p string
+			switch o.Layout {
+			case "", GroupLayout:
+				p = fmt.Sprintf("%s/%d-%v.yaml", g, i, r.Item)
+			case KindLayout:
+				p = fmt.Sprintf("%s-%s.yaml", strings.ToLower(res.Kind), res.Name)
+				if res.Namespace != "" {
+					p = res.Namespace + "-" + p
+				}
+			case StreamLayout:
+				p = "resources.yaml"
+			case PatternLayout:
+				b := bytes.Buffer{}
+				if err := pattern.Execute(&b, res); err != nil {
+					return nil, errors.Wrapf(err, "render path pattern for %v from %v group", r.Item, g)
+				}
+				p = b.String()
+			}
+			p = filepath.ToSlash(filepath.Clean(p))
+			if p == "." || filepath.IsAbs(p) || strings.HasPrefix(p, "../") || p == ".." {
+				return nil, errors.Errorf("path %q of %v from %v group is not within the output directory", p, r.Item, g)
+			}
+
+			// Documents are separated with `---` line, so each has to end with new line.
+			b := r.Object
+			if len(b) > 0 && b[len(b)-1] != '\n' {
+				b = append(b[:len(b):len(b)], '\n')
+			}
+			if prev, ok := files[p]; ok {
+				files[p] = bytes.Join([][]byte{prev, b}, []byte("---\n"))
+				continue
+			}
+			files[p] = b
+		}
+	}
+	return files, nil
+}
+
+func sortedGroups(groups rndrapi.Groups) []string {
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func outputResource(group string, index int, r rndrapi.Resource) (OutputResource, error) {
+	o := struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string
+		Metadata   struct {
+			Name      string
+			Namespace string
+		}
+	}{}
+	if err := yaml.Unmarshal(r.Object, &o); err != nil {
+		return OutputResource{}, errors.Wrapf(err, "parse %v from %v group", r.Item, group)
+	}
+	return OutputResource{
+		APIVersion: o.APIVersion,
+		Kind:       o.Kind,
+		Namespace:  o.Metadata.Namespace,
+		Name:       o.Metadata.Name,
+		Group:      group,
+		Item:       r.Item,
+		Index:      index,
+	}, nil
+}
+
+// StreamFormat is a format of rendered resources written into single stream e.g stdout.
+type StreamFormat string
+
+const (
+	// YAMLStream is a multi-document YAML stream.
+	YAMLStream StreamFormat = "yaml"
+	// JSONList is a JSON `v1` `List` with resources as items.
+	JSONList StreamFormat = "json"
+)
+
+// WriteStream writes rendered resources into w ordered by group name and their position in group.
+func WriteStream(w io.Writer, groups rndrapi.Groups, f StreamFormat) error {
+	switch f {
+	case YAMLStream:
+		files, err := OutputOptions{Layout: StreamLayout}.Files(groups)
+		if err != nil {
+			return err
+		}
+		for _, b := range files {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSONList:
+		items := []interface{}{}
+		for _, g := range sortedGroups(groups) {
+			for _, r := range groups[g] {
+				var o interface{}
+				if err := yaml.Unmarshal(r.Object, &o); err != nil {
+					return errors.Wrapf(err, "parse %v from %v group", r.Item, g)
+				}
+				items = append(items, o)
+			}
+		}
+		b, err := json.MarshalIndent(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items}, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "marshal list")
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	default:
+		return errors.Errorf("unknown stream format %q", f)
+	}
+}
+
+// WriteOutput writes rendered resources into the output directory and records written files in ManifestFile.
+func WriteOutput(groups rndrapi.Groups, outDir string, o OutputOptions) error {
+	files, err := o.Files(groups)
+	if err != nil {
+		return err
+	}
+	mode := o.FileMode
+	if mode == 0 {
+		mode = 0644
+	}
+
+	// Output directory is created even if nothing is rendered, so the manifest can be written.
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+	for p, b := range files {
+		f := filepath.Join(outDir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(f), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(f, b, mode); err != nil {
+			return err
+		}
+		// WriteFile does not change mode of existing files.
+		if err := os.Chmod(f, mode); err != nil {
+			return err
+		}
+	}
+	if o.Clean {
+		if err := clean(outDir, files); err != nil {
+			return errors.Wrap(err, "clean stale files")
+		}
+	}
+	return writeManifest(outDir, files)
+}
+
+func writeManifest(dir string, files map[string][]byte) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	b := bytes.Buffer{}
+	b.WriteString("# Files written by rndr output. Only these are removed by --clean.\n")
+	for _, p := range paths {
+		b.WriteString(p + "\n")
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ManifestFile), b.Bytes(), 0644)
+}
+
+func readManifest(dir string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			paths = append(paths, l)
+		}
+	}
+	return paths, nil
+}
+
+// clean removes files listed in the manifest of the previous run that were not written and directories left empty.
+func clean(dir string, written map[string][]byte) error {
+	paths, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if _, ok := written[p]; ok {
+			continue
+		}
+		p = filepath.Clean(filepath.FromSlash(p))
+		if filepath.IsAbs(p) || outsideDir(p) {
+			return errors.Errorf("manifest path %q is not within the output directory", p)
+		}
+		f := filepath.Join(dir, p)
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		for d := filepath.Dir(p); d != "."; d = filepath.Dir(d) {
+			infos, err := ioutil.ReadDir(filepath.Join(dir, d))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			if len(infos) > 0 {
+				break
+			}
+			if err := os.Remove(filepath.Join(dir, d)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package rndr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestOutputOptions_Files(t *testing.T) {
+	deployment := []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: hello\n  namespace: prod\n")
+	service := []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: hello\n  namespace: prod\n")
+	crd := []byte("apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: hellos.example.com\n")
+	groups := rndrapi.Groups{
+		"hello": {{Item: "deployment", Object: deployment}, {Item: "service", Object: service}},
+		"crds":  {{Item: "hello", Object: crd}},
+	}
+
+	for _, tcase := range []struct {
+		opts     OutputOptions
+		expected map[string][]byte
+	}{
+		{
+			opts: OutputOptions{},
+			expected: map[string][]byte{
+				"hello/0-deployment.yaml": deployment,
+				"hello/1-service.yaml":    service,
+				"crds/0-hello.yaml":       crd,
+			},
+		},
+		{
+			opts: OutputOptions{Layout: KindLayout},
+			expected: map[string][]byte{
+				"prod-deployment-hello.yaml":                       deployment,
+				"prod-service-hello.yaml":                          service,
+				"customresourcedefinition-hellos.example.com.yaml": crd,
+			},
+		},
+		{
+			opts: OutputOptions{Layout: StreamLayout},
+			// Groups are sorted, so the output is deterministic.
+			expected: map[string][]byte{"resources.yaml": bytes.Join([][]byte{crd, deployment, service}, []byte("---\n"))},
+		},
+		{
+			opts: OutputOptions{Layout: PatternLayout, Pattern: "{{ if .Namespace }}{{ .Namespace }}{{ else }}cluster{{ end }}/{{ .Kind | lower }}.yaml"},
+			expected: map[string][]byte{
+				"prod/deployment.yaml":                  deployment,
+				"prod/service.yaml":                     service,
+				"cluster/customresourcedefinition.yaml": crd,
+			},
+		},
+	} {
+		t.Run(string(tcase.opts.Layout), func(t *testing.T) {
+			files, err := tcase.opts.Files(groups)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, files)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, o := range []OutputOptions{
+			{Layout: "flat"},
+			{Layout: PatternLayout},
+			{Layout: PatternLayout, Pattern: "../{{ .Name }}.yaml"},
+			{Layout: PatternLayout, Pattern: "{{ .Unknown }}.yaml"},
+		} {
+			_, err := o.Files(groups)
+			testutil.NotOk(t, err)
+		}
+	})
+}
+
+func TestWriteStream(t *testing.T) {
+	groups := rndrapi.Groups{
+		"b": {{Item: "service", Object: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: hello\n")}},
+		// Document without trailing new line has to be still separated.
+		"a": {{Item: "config", Object: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: hello\ndata:\n  port: \"80\"")}},
+	}
+
+	b := bytes.Buffer{}
+	testutil.Ok(t, WriteStream(&b, groups, YAMLStream))
+	testutil.Equals(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: hello\ndata:\n  port: \"80\"\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: hello\n", b.String())
+
+	b.Reset()
+	testutil.Ok(t, WriteStream(&b, groups, JSONList))
+	testutil.Equals(t, `{
+  "apiVersion": "v1",
+  "items": [
+    {
+      "apiVersion": "v1",
+      "data": {
+        "port": "80"
+      },
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "hello"
+      }
+    },
+    {
+      "apiVersion": "v1",
+      "kind": "Service",
+      "metadata": {
+        "name": "hello"
+      }
+    }
+  ],
+  "kind": "List"
+}
+`, b.String())
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-output")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	groups := func(name string) rndrapi.Groups {
+		return rndrapi.Groups{"hello": {{Item: name, Object: []byte("kind: ConfigMap\nmetadata:\n  name: " + name + "\n")}}}
+	}
+	opts := OutputOptions{Layout: PatternLayout, Pattern: "{{ .Group }}/{{ .Name }}/cm.yaml", FileMode: 0640, Clean: true}
+	testutil.Ok(t, WriteOutput(groups("old"), dir, opts))
+	// Files not written by rndr are kept, even YAML ones like values.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not rendered"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "values.yaml"), []byte("name: new\n"), os.ModePerm))
+
+	// Renamed resource replaces old file, other files are kept.
+	testutil.Ok(t, WriteOutput(groups("new"), dir, opts))
+
+	var files []string
+	testutil.Ok(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		testutil.Ok(t, err)
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+			testutil.Ok(t, err)
+			files = append(files, rel)
+		}
+		return nil
+	}))
+	testutil.Equals(t, []string{ManifestFile, "README.md", filepath.Join("hello", "new", "cm.yaml"), "values.yaml"}, files)
+	_, err = os.Stat(filepath.Join(dir, "hello", "old"))
+	testutil.Assert(t, os.IsNotExist(err), "old directory has to be removed, got %v", err)
+
+	info, err := os.Stat(filepath.Join(dir, "hello", "new", "cm.yaml"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, os.FileMode(0640), info.Mode().Perm())
+
+	// Nothing rendered removes all previously written files.
+	testutil.Ok(t, WriteOutput(rndrapi.Groups{}, dir, opts))
+	_, err = os.Stat(filepath.Join(dir, "hello"))
+	testutil.Assert(t, os.IsNotExist(err), "hello directory has to be removed, got %v", err)
+
+	// Output directory is created even if nothing is rendered and files are not executable by default.
+	testutil.Ok(t, WriteOutput(rndrapi.Groups{}, filepath.Join(dir, "empty"), OutputOptions{Clean: true}))
+	testutil.Ok(t, WriteOutput(groups("new"), filepath.Join(dir, "default"), OutputOptions{}))
+	info, err = os.Stat(filepath.Join(dir, "default", "hello", "0-new.yaml"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, os.FileMode(0644), info.Mode().Perm())
+}
@@ -5,48 +5,62 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/observatorium/rndr/pkg/rndr/engines/helm"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/engines/kubeoperator"
+	"github.com/observatorium/rndr/pkg/rndr/engines/kustomize"
+	"github.com/observatorium/rndr/pkg/rndr/engines/olm"
+	"github.com/observatorium/rndr/pkg/rndr/engines/openshift"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
 	"github.com/pkg/errors"
 )
 
 type Package struct {
 	OutputDir  string  `yaml:"outputDir"`
+	// DependsOn are names of packages that have to be rendered before this one, e.g when it uses their output.
+	DependsOn []string `yaml:"dependsOn"`
 
 	// One of.
-	OLM               *OLMPackage
-	KubeOperator      *KubeOperatorPackage  `yaml:"kubeOperator"`
+	OLM               *olm.PackageOptions
+	KubeOperator      *kubeoperator.PackageOptions `yaml:"kubeOperator"`
 	Helm              *helm.PackageOptions
-	OpenshiftTemplate *OpenshiftTemplatesPackage `yaml:"openshiftTemplate"`
-}
-
-type OLMPackage struct {
-
-}
-
-type KubeOperatorPackage struct {
-
-}
-
-type OpenshiftTemplatesPackage struct {
-	Values string
+	OpenshiftTemplate *openshift.PackageOptions `yaml:"openshiftTemplate"`
+	Jsonnet           *jsonnet.PackageOptions
+	Kustomize         *kustomize.PackageOptions
 }
 
 
 // RenderPackage renders package.
-func RenderPackage(ctx context.Context, logger log.Logger, name, author string, s Package , overrOutDir *string) (err error) {
+func RenderPackage(ctx context.Context, logger log.Logger, name, author string, t Template, s Package, overrOutDir *string) (err error) {
 	outDir := s.OutputDir
-	if overrOutDir != nil {
+	if overrOutDir != nil && *overrOutDir != "" {
 		outDir = *overrOutDir
 	}
 
+	api, err := LoadAPI(ctx, logger, t.API)
+	if err != nil {
+		return errors.Wrap(err, "load template API")
+	}
+	return renderPackage(ctx, logger, name, author, t, api, s, outDir)
+}
+
+func renderPackage(ctx context.Context, logger log.Logger, name, author string, t Template, api rndrapi.API, s Package, outDir string) (err error) {
+	renderFn := func(ctx context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		return render(ctx, logger, name, t, api, valuesYAML)
+	}
+
 	switch {
 	case s.OLM != nil:
-		return errors.Errorf("Operator Lifecycle Manager packaging is not implemented")
+		err = olm.Package(ctx, logger, name, author, api, t.Renderer.Jsonnet, renderFn, *s.OLM, outDir)
 	case s.KubeOperator != nil:
-		return errors.Errorf("kubernestes operator packaging is not implemented")
+		err = kubeoperator.Package(ctx, logger, name, api, t.Renderer.Jsonnet, renderFn, *s.KubeOperator, outDir)
 	case s.OpenshiftTemplate != nil:
-		return errors.Errorf("openshift templates packaging is not implemented")
+		err = openshift.Package(ctx, logger, name, author, api, renderFn, *s.OpenshiftTemplate, outDir)
+	case s.Jsonnet != nil:
+		err = jsonnet.Package(ctx, logger, name, api, t.Renderer.Jsonnet, renderFn, *s.Jsonnet, outDir)
+	case s.Kustomize != nil:
+		err = kustomize.Package(ctx, logger, name, api, renderFn, *s.Kustomize, outDir)
 	case s.Helm != nil:
-		err = helm.Package(ctx,  logger, name, author, *s.Helm, outDir)
+		err = helm.Package(ctx, logger, name, author, api, renderFn, *s.Helm, outDir)
 	default:
 		return errors.New("packaging has to be specified, got none")
 	}
@@ -0,0 +1,263 @@
+// Package parametrize allows packaging engines to keep chosen template values configurable in the package, even if
+// the package format does not support template's renderer (e.g Helm chart generated from jsonnet template).
+//
+// It renders template with unique placeholders in place of chosen values and finds those placeholders in rendered
+// resources, so they can be replaced with package specific parameter syntax (e.g `{{ .Values.replicas }}`).
+// It works only for scalar values that are copied verbatim by the template to the output.
+package parametrize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Parameter is a single template value that stays configurable.
+type Parameter struct {
+	// Path is a dot separated path to the value e.g `ports.http`.
+	Path string
+	// Schema describes the value.
+	Schema *rndrapi.Schema
+	// Default is a default value. Nil if there is none.
+	Default interface{}
+	// Required is true if every object on the path is required.
+	Required bool
+
+	// value is put in place of the parameter when rendering, placeholder is how it's printed in the output.
+	value       interface{}
+	placeholder string
+	token       string
+}
+
+// Parameters is a set of template values that stay configurable.
+type Parameters []Parameter
+
+// New resolves parameters for given values paths. Only string, integer and number values are allowed.
+func New(schema *rndrapi.Schema, defaults map[string]interface{}, paths []string) (Parameters, error) {
+	ret := make(Parameters, 0, len(paths))
+	for i, p := range paths {
+		s, required, err := lookupSchema(schema, p)
+		if err != nil {
+			return nil, err
+		}
+
+		param := Parameter{Path: p, Schema: s, Required: required, token: fmt.Sprintf("__RNDR_PARAM_%d__", i)}
+		switch s.Type {
+		case "string":
+			param.placeholder = fmt.Sprintf("rndrparam%dx", i)
+			param.value = param.placeholder
+		case "integer", "number":
+			param.value = 987650000 + i
+			param.placeholder = strconv.Itoa(987650000 + i)
+		default:
+			return nil, errors.Errorf("value %v has type %q; only string, integer and number values can be parametrized", p, s.Type)
+		}
+		param.Default, _ = Lookup(defaults, p)
+		ret = append(ret, param)
+	}
+	return ret, nil
+}
+
+func lookupSchema(s *rndrapi.Schema, path string) (_ *rndrapi.Schema, required bool, _ error) {
+	if s == nil {
+		return nil, false, errors.Errorf("value %v cannot be parametrized, API has no schema", path)
+	}
+
+	required = true
+	for _, p := range strings.Split(path, ".") {
+		child, ok := s.Properties[p]
+		switch {
+		case ok:
+		case s.AdditionalProperties != nil:
+			child = s.AdditionalProperties
+		default:
+			return nil, false, errors.Errorf("value %v not found in API", path)
+		}
+		required = required && contains(s.Required, p)
+		s = child
+	}
+	return s, required, nil
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns value under dot separated path.
+func Lookup(values map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = values
+	for _, p := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[p]
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Set sets value under dot separated path, creating intermediate objects if needed.
+func Set(values map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	m := values
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := m[p].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[p] = child
+		}
+		m = child
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+// Render renders template using given values with parameters replaced by placeholders. Placeholders don't have to match
+// API constraints (e.g enum), so values are not validated.
+func (ps Parameters) Render(ctx context.Context, logger log.Logger, render rndrapi.RenderFunc, values map[string]interface{}) (rndrapi.Groups, error) {
+	v := deepCopy(values).(map[string]interface{})
+	for _, p := range ps {
+		Set(v, p.Path, p.value)
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := render(rndrapi.WithoutValidation(ctx), b)
+	if err != nil {
+		return nil, errors.Wrap(err, "render with parameter placeholders")
+	}
+
+	found := map[string]bool{}
+	for _, rs := range groups {
+		for _, r := range rs {
+			var n yaml.Node
+			if err := yaml.Unmarshal(r.Object, &n); err != nil {
+				return nil, errors.Wrapf(err, "parse %v", r.Item)
+			}
+			walkScalars(&n, func(s *yaml.Node) {
+				for _, p := range ps {
+					if whole, part := p.match(s); whole || part {
+						found[p.Path] = true
+					}
+				}
+			})
+		}
+	}
+	for _, p := range ps {
+		if !found[p.Path] {
+			level.Warn(logger).Log("msg", "parametrized value was not found in rendered output; it won't have any effect. Template has to use it verbatim", "value", p.Path)
+		}
+	}
+	return groups, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(o))
+		for k, e := range o {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(o))
+		for i, e := range o {
+			c[i] = deepCopy(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// ReplaceFunc returns package specific reference to the parameter. Whole is true if the parameter is the whole YAML
+// scalar, false if it's part of the string.
+type ReplaceFunc func(p Parameter, whole bool) string
+
+// Replace returns YAML object rendered by Render with placeholders replaced by the result of given function.
+// Use escape to make sure any text that might have special meaning in package format is escaped.
+func (ps Parameters) Replace(object []byte, escape func(string) string, fn ReplaceFunc) ([]byte, error) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(object, &n); err != nil {
+		return nil, err
+	}
+
+	type replacement struct {
+		p     Parameter
+		whole bool
+	}
+	tokens := map[string]replacement{}
+	walkScalars(&n, func(s *yaml.Node) {
+		for _, p := range ps {
+			whole, part := p.match(s)
+			switch {
+			case whole:
+				s.Value = p.token + "W"
+				s.Style = 0
+				s.Tag = "!!str"
+				tokens[p.token+"W"] = replacement{p: p, whole: true}
+				return
+			case part:
+				s.Value = strings.ReplaceAll(s.Value, p.placeholder, p.token+"P")
+				s.Style = yaml.DoubleQuotedStyle
+				tokens[p.token+"P"] = replacement{p: p}
+			}
+		}
+	})
+
+	b := bytes.Buffer{}
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(&n); err != nil {
+		return nil, err
+	}
+
+	out := b.String()
+	if escape != nil {
+		out = escape(out)
+	}
+	for t, r := range tokens {
+		out = strings.ReplaceAll(out, t, fn(r.p, r.whole))
+	}
+	return []byte(out), nil
+}
+
+// match returns if given scalar node is the parameter placeholder or contains it.
+func (p Parameter) match(s *yaml.Node) (whole bool, part bool) {
+	if p.Schema.Type == "string" {
+		return s.Value == p.placeholder, s.Value != p.placeholder && strings.Contains(s.Value, p.placeholder)
+	}
+	if s.Tag != "!!int" && s.Tag != "!!float" {
+		return false, false
+	}
+	// Numbers might be printed in different notation e.g 9.8765e+08 when template uses floats.
+	f, err := strconv.ParseFloat(s.Value, 64)
+	return err == nil && f == float64(p.value.(int)), false
+}
+
+func walkScalars(n *yaml.Node, fn func(*yaml.Node)) {
+	if n.Kind == yaml.ScalarNode {
+		fn(n)
+		return
+	}
+	for _, c := range n.Content {
+		walkScalars(c, fn)
+	}
+}
@@ -0,0 +1,163 @@
+package parametrize
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParameters_Replace(t *testing.T) {
+	schema := &rndrapi.Schema{
+		Type:     "object",
+		Required: []string{"name"},
+		Properties: map[string]*rndrapi.Schema{
+			"name":     {Type: "string"},
+			"replicas": {Type: "integer"},
+			"ports": {
+				Type:                 "object",
+				AdditionalProperties: &rndrapi.Schema{Type: "integer"},
+			},
+		},
+	}
+	ps, err := New(schema, map[string]interface{}{"name": "hello"}, []string{"name", "replicas", "ports.http"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, true, ps[0].Required)
+	testutil.Equals(t, "hello", ps[0].Default)
+	testutil.Equals(t, false, ps[1].Required)
+	testutil.Equals(t, nil, ps[1].Default)
+
+	ref := func(p Parameter, whole bool) string {
+		if whole {
+			return "{{ .Values." + p.Path + " }}"
+		}
+		return "{{ .Values." + p.Path + " | quote }}"
+	}
+	escape := func(s string) string { return strings.ReplaceAll(s, "{{", "{{`{{`}}") }
+
+	for _, tcase := range []struct {
+		name   string
+		object string
+		escape func(string) string
+
+		expected string
+	}{
+		{
+			name:     "no parameters",
+			object:   "kind: ConfigMap\ndata:\n  a: b\n",
+			expected: "kind: ConfigMap\ndata:\n  a: b\n",
+		},
+		{
+			name:     "whole string scalar",
+			object:   "metadata:\n  name: rndrparam0x\n",
+			expected: "metadata:\n  name: {{ .Values.name }}\n",
+		},
+		{
+			name:     "part of string scalar",
+			object:   "metadata:\n  name: rndrparam0x-config\n",
+			expected: "metadata:\n  name: \"{{ .Values.name | quote }}-config\"\n",
+		},
+		{
+			name:     "integers in any notation",
+			object:   "spec:\n  replicas: 987650001\n  port: 9.87650002e+08\n  name: \"987650001\"\n",
+			expected: "spec:\n  replicas: {{ .Values.replicas }}\n  port: {{ .Values.ports.http }}\n  name: \"987650001\"\n",
+		},
+		{
+			name:     "without escape",
+			object:   "data:\n  tmpl: '{{ .Foo }}'\n  name: rndrparam0x\n",
+			expected: "data:\n  tmpl: '{{ .Foo }}'\n  name: {{ .Values.name }}\n",
+		},
+		{
+			name:     "escape applies to the object, not to the references",
+			object:   "data:\n  tmpl: '{{ .Foo }}'\n  name: rndrparam0x\n",
+			escape:   escape,
+			expected: "data:\n  tmpl: '{{`{{`}} .Foo }}'\n  name: {{ .Values.name }}\n",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			out, err := ps.Replace([]byte(tcase.object), tcase.escape, ref)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, string(out))
+		})
+	}
+}
+
+func TestParameters_Render(t *testing.T) {
+	schema := &rndrapi.Schema{
+		Type: "object",
+		Properties: map[string]*rndrapi.Schema{
+			"tier": {Type: "string", Enum: []interface{}{"frontend", "backend"}},
+		},
+	}
+	render := func(ctx context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		if !rndrapi.SkipValidation(ctx) {
+			if err := schema.Validate(valuesYAML, valuesYAML); err != nil {
+				return nil, err
+			}
+		}
+		v := map[string]interface{}{}
+		if err := yaml.Unmarshal(valuesYAML, &v); err != nil {
+			return nil, err
+		}
+		return rndrapi.Groups{"hello": {{Item: "config", Object: []byte("kind: ConfigMap\ndata:\n  tier: " + v["tier"].(string) + "\n")}}}, nil
+	}
+
+	// Placeholder is not one of enum values, so it's rendered without validation.
+	ps, err := New(schema, nil, []string{"tier"})
+	testutil.Ok(t, err)
+	groups, err := ps.Render(context.Background(), log.NewNopLogger(), render, map[string]interface{}{"tier": "frontend"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "kind: ConfigMap\ndata:\n  tier: rndrparam0x\n", string(groups["hello"][0].Object))
+
+	_, err = render(context.Background(), []byte("tier: rndrparam0x\n"))
+	testutil.NotOk(t, err)
+}
+
+func TestNew_Errors(t *testing.T) {
+	schema := &rndrapi.Schema{
+		Type: "object",
+		Properties: map[string]*rndrapi.Schema{
+			"labels": {Type: "object"},
+		},
+	}
+	for _, tcase := range []struct {
+		schema *rndrapi.Schema
+		path   string
+
+		expectedErr string
+	}{
+		{schema: nil, path: "name", expectedErr: "value name cannot be parametrized, API has no schema"},
+		{schema: schema, path: "name", expectedErr: "value name not found in API"},
+		{schema: schema, path: "labels", expectedErr: `value labels has type "object"; only string, integer and number values can be parametrized`},
+	} {
+		t.Run(tcase.path, func(t *testing.T) {
+			_, err := New(tcase.schema, nil, []string{tcase.path})
+			testutil.NotOk(t, err)
+			testutil.Equals(t, tcase.expectedErr, err.Error())
+		})
+	}
+}
+
+func TestLookupSet(t *testing.T) {
+	values := map[string]interface{}{"a": map[string]interface{}{"b": 1}, "c": "d"}
+	Set(values, "a.e", 2)
+	Set(values, "c.f", 3)
+	Set(values, "g.h", 4)
+	testutil.Equals(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": 1, "e": 2},
+		"c": map[string]interface{}{"f": 3},
+		"g": map[string]interface{}{"h": 4},
+	}, values)
+
+	v, ok := Lookup(values, "a.b")
+	testutil.Equals(t, true, ok)
+	testutil.Equals(t, 1, v)
+	_, ok = Lookup(values, "a.b.c")
+	testutil.Equals(t, false, ok)
+	_, ok = Lookup(values, "x")
+	testutil.Equals(t, false, ok)
+}
@@ -2,15 +2,18 @@ package rndr
 
 import (
 	"context"
-	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/observatorium/rndr/pkg/rndr/engines/golang"
 	"github.com/observatorium/rndr/pkg/rndr/engines/helm"
 	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonschema"
+	"github.com/observatorium/rndr/pkg/rndr/engines/process"
+	"github.com/observatorium/rndr/pkg/rndr/engines/proto"
 	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
 	"github.com/pkg/errors"
 )
@@ -22,19 +25,17 @@ type Template struct {
 
 	// Renderer is a mandatory expanding engine that converts input to desired output (e.g as Kubernetes YAMLs)
 	Renderer TemplateRenderer
+
+	// Dir is a directory relative paths are resolved against. ParseSpec sets it to the spec directory.
+	Dir string `yaml:"-"`
 }
 
 type API struct {
 	// One of.
 	Go    *golang.TemplateAPI
-	Proto *ProtoTemplateAPI
-}
-
-type ProtoTemplateAPI struct {
-	// Message is a name of root proto Message to be assumed as entry point for API in .proto file.
-	Message string
-	// File is destination to .proto file on local filesystem.
-	File string
+	Proto *proto.TemplateAPI
+	// JSONSchema allows to define values with JSON Schema e.g existing Helm chart `values.schema.json`.
+	JSONSchema *jsonschema.TemplateAPI `yaml:"jsonSchema"`
 }
 
 type TemplateRenderer struct {
@@ -43,53 +44,205 @@ type TemplateRenderer struct {
 	// `rndr` expects output resources to be rendered in stdout.
 	Jsonnet *jsonnet.TemplateRenderer
 	// Helm allows to configure a renderer that is able to take helm chart and input in YAMl and render output files.
+	// Input YAML is used as chart values.
 	Helm *helm.TemplateRenderer
 	// Process allows to configure a renderer that is able to execute process with YAMl passed by stdin or envvar and render output files.
 	// `rndr` expects output resources to be rendered in stdout.
 	Process *ProcessTemplateRenderer
 }
 
-type ProcessTemplateRenderer struct {
-	Command   string
-	Arguments []string
-	// InputEnvVar controls the name of variable with input YAML content e.g `INPUT`.
-	// If empty template input YAML is passed via stdin.
-	InputEnvVar string
+// ProcessTemplateRenderer is kept for compatibility, use process.TemplateRenderer.
+type ProcessTemplateRenderer = process.TemplateRenderer
+
+// RenderTemplate renders files based on template and values. It returns rendered resources.
+func RenderTemplate(ctx context.Context, logger log.Logger, name string, t Template, valuesYAML []byte, outDir string, o OutputOptions) (rndrapi.Groups, error) {
+	objectGroups, err := Render(ctx, logger, name, t, valuesYAML)
+	if err != nil {
+		return nil, err
+	}
+	return objectGroups, WriteOutput(objectGroups, outDir, o)
 }
 
-// RenderTemplate renders files based on template and values.
-func RenderTemplate(_ context.Context, logger log.Logger, name string, t Template , valuesYAML []byte, outDir string) (err error) {
-	// TODO(bwplotka): Parse values & validate through API (!).
-	// TODO(bwplotka): Allow passing more parameters (e.g kubernetes options).
-	var objectGroups rndrapi.Groups
+// EnvironmentsOptions configures RenderEnvironments.
+type EnvironmentsOptions struct {
+	// Render renders template with given values e.g function returned by NewRenderFunc or NewCachedRenderFunc.
+	Render rndrapi.RenderFunc
+	// Environments to render by name.
+	Environments map[string]Environment
+	// OutputDir is a directory environment output directories are relative to.
+	OutputDir string
+	// Output configures how resources are written into environment output directories.
+	Output OutputOptions
+}
+
+// RenderEnvironments renders template for each of given environments into its output directory. It returns rendered
+// resources by environment name.
+func RenderEnvironments(ctx context.Context, logger log.Logger, o EnvironmentsOptions) (map[string]rndrapi.Groups, error) {
+	envs := make(map[string]Environment, len(o.Environments))
+	names := make([]string, 0, len(o.Environments))
+	for n, e := range o.Environments {
+		if e.OutputDir == "" {
+			e.OutputDir = n
+		}
+		envs[n] = e
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if o.Output.Clean {
+		// Environments sharing output directory would overwrite each other's manifest, so cleaning would remove files
+		// of the other environment.
+		for i, n := range names {
+			for _, other := range names[i+1:] {
+				if filepath.Clean(envs[n].OutputDir) == filepath.Clean(envs[other].OutputDir) {
+					return nil, errors.Errorf("environments %v and %v share output directory, so they can't be cleaned", n, other)
+				}
+			}
+		}
+	}
+	rendered := make(map[string]rndrapi.Groups, len(names))
+	for _, n := range names {
+		e := envs[n]
+		valuesYAML, err := ReadValues(e.Values...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "environment %v", n)
+		}
+		objectGroups, err := o.Render(ctx, valuesYAML)
+		if err != nil {
+			return nil, errors.Wrapf(err, "render environment %v", n)
+		}
+		if err := WriteOutput(objectGroups, filepath.Join(o.OutputDir, e.OutputDir), o.Output); err != nil {
+			return nil, errors.Wrapf(err, "write environment %v", n)
+		}
+		rendered[n] = objectGroups
+		level.Info(logger).Log("msg", "rendered environment", "environment", n, "dir", filepath.Join(o.OutputDir, e.OutputDir))
+	}
+	return rendered, nil
+}
+
+// ReadValues reads values YAML files and deep-merges them in order, so later files override earlier ones.
+func ReadValues(files ...string) ([]byte, error) {
+	layers := make([][]byte, 0, len(files))
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "read values")
+		}
+		layers = append(layers, b)
+	}
+	return MergeValueLayers(layers...)
+}
 
+// MergeValueLayers deep-merges values YAML documents in order, as described in rndrapi.MergeValues. Single document is
+// returned as it is, so validation errors point to its original lines.
+func MergeValueLayers(layers ...[]byte) ([]byte, error) {
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	merged, err := rndrapi.MergeValues(layers...)
+	if err != nil {
+		return nil, errors.Wrap(err, "merge values")
+	}
+	return merged, nil
+}
+
+// NewRenderFunc loads template API and returns function that validates values against it and renders template with
+// those into resources. It's useful when rendering the template multiple times, since API is loaded only once.
+func NewRenderFunc(ctx context.Context, logger log.Logger, name string, t Template) (rndrapi.RenderFunc, error) {
+	api, err := LoadAPI(ctx, logger, t.API)
+	if err != nil {
+		return nil, errors.Wrap(err, "load template API")
+	}
+	return func(ctx context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		return render(ctx, logger, name, t, api, valuesYAML)
+	}, nil
+}
+
+// Render validates values against template API and renders template with those into resources.
+func Render(ctx context.Context, logger log.Logger, name string, t Template, valuesYAML []byte) (rndrapi.Groups, error) {
+	api, err := LoadAPI(ctx, logger, t.API)
+	if err != nil {
+		return nil, errors.Wrap(err, "load template API")
+	}
+	return render(ctx, logger, name, t, api, valuesYAML)
+}
+
+func render(ctx context.Context, logger log.Logger, name string, t Template, api rndrapi.API, valuesYAML []byte) (rndrapi.Groups, error) {
+	// Template gets values with API defaults, so it does not need to duplicate them.
+	withDefaultsYAML, err := rndrapi.MergeValues(api.Defaults, valuesYAML)
+	if err != nil {
+		return nil, errors.Wrap(err, "merge values with API defaults")
+	}
+	validate := api.Validate
+	if validate == nil {
+		validate = api.Schema.Validate
+	}
+	if rndrapi.SkipValidation(ctx) {
+		validate = func(_, _ []byte) error { return nil }
+	}
+	if err := validate(valuesYAML, withDefaultsYAML); err != nil {
+		return nil, errors.Wrap(err, "values do not match template API")
+	}
+
+	// TODO(bwplotka): Allow passing more parameters (e.g kubernetes options).
 	switch {
 	case t.Renderer.Jsonnet != nil:
-		objectGroups, err = jsonnet.Render(logger, name, *t.Renderer.Jsonnet, valuesYAML)
+		return jsonnet.Render(logger, name, *t.Renderer.Jsonnet, withDefaultsYAML)
 	case t.Renderer.Helm != nil:
-		objectGroups, err = helm.Render(logger, name, *t.Renderer.Helm, valuesYAML)
+		return helm.Render(logger, name, *t.Renderer.Helm, withDefaultsYAML)
 	case t.Renderer.Process != nil:
-		return errors.Errorf("process renderer is not implemented")
+		return process.Render(ctx, logger, name, *t.Renderer.Process, withDefaultsYAML)
 	default:
-		return errors.Errorf("no renderer was specified")
-	}
-	if err != nil {
-		return err
+		return nil, errors.Errorf("no renderer was specified")
 	}
+}
 
-	// TODO(bwplotka): Allow different dirs?
-	for name, resources := range objectGroups {
-		dir := filepath.Join(outDir, name)
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			return err
+// Sources returns local files template API and renderer are defined by e.g jsonnet function files with their transitive
+// imports, so changes to the template can be detected.
+func Sources(t Template) ([]string, error) {
+	var files []string
+	switch {
+	case t.API.Go != nil:
+		f, err := golang.Sources(*t.API.Go)
+		if err != nil {
+			return nil, errors.Wrap(err, "Go API sources")
 		}
-		for i, r := range resources {
-			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d-%v.yaml", i, r.Item)), r.Object, os.ModePerm); err != nil {
-				return err
-			}
+		files = append(files, f...)
+	case t.API.Proto != nil:
+		f, err := proto.Sources(*t.API.Proto)
+		if err != nil {
+			return nil, errors.Wrap(err, "proto API sources")
 		}
+		files = append(files, f...)
+	case t.API.JSONSchema != nil:
+		files = append(files, t.API.JSONSchema.File)
 	}
-	return nil
-}
 
+	switch {
+	case t.Renderer.Jsonnet != nil:
+		files = append(files, t.Renderer.Jsonnet.Functions...)
+		deps, err := jsonnet.Dependencies(*t.Renderer.Jsonnet)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, deps...)
+	case t.Renderer.Helm != nil:
+		f, err := helm.Sources(*t.Renderer.Helm)
+		if err != nil {
+			return nil, errors.Wrap(err, "helm chart sources")
+		}
+		files = append(files, f...)
+	case t.Renderer.Process != nil:
+		files = append(files, t.Renderer.Process.Command)
+		files = append(files, t.Renderer.Process.Inputs...)
+	}
 
+	for i := range files {
+		abs, err := filepath.Abs(files[i])
+		if err != nil {
+			return nil, err
+		}
+		files[i] = abs
+	}
+	sort.Strings(files)
+	return files, nil
+}
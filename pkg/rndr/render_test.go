@@ -0,0 +1,145 @@
+package rndr
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+)
+
+func TestMergeValueLayers(t *testing.T) {
+	t.Run("single layer is kept as it is", func(t *testing.T) {
+		b, err := MergeValueLayers([]byte("# Comment.\nname: a\nempty: null\n"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, "# Comment.\nname: a\nempty: null\n", string(b))
+	})
+	t.Run("later layers take precedence", func(t *testing.T) {
+		b, err := MergeValueLayers(
+			[]byte("name: base\nreplicas: 1\nports: [80, 443]\nresources:\n  cpu: 1\n  memory: 1Gi\n"),
+			[]byte("name: prod\nports: [8080]\nresources:\n  memory: 2Gi\n"),
+			[]byte("replicas: 3\nresources:\n  cpu: null\n  limits:\n    memory: 4Gi\n"),
+		)
+		testutil.Ok(t, err)
+		// Nested objects are merged key by key, lists are replaced and null removes the value.
+		testutil.Equals(t, `name: prod
+ports:
+- 8080
+replicas: 3
+resources:
+  limits:
+    memory: 4Gi
+  memory: 2Gi
+`, string(b))
+	})
+	t.Run("invalid layer", func(t *testing.T) {
+		_, err := MergeValueLayers([]byte("name: a\n"), []byte("- not an object\n"))
+		testutil.NotOk(t, err)
+	})
+}
+
+func TestReadValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-values")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	write := func(file, content string) string {
+		f := filepath.Join(dir, file)
+		testutil.Ok(t, ioutil.WriteFile(f, []byte(content), os.ModePerm))
+		return f
+	}
+	base := write("base.yaml", "name: base\nlabels:\n  team: a\n  tier: backend\n")
+	prod := write("prod.yaml", "labels:\n  tier: frontend\n")
+	cluster := write("cluster.yaml", "name: eu\nlabels:\n  region: eu\n")
+
+	b, err := ReadValues(base, prod, cluster)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "labels:\n  region: eu\n  team: a\n  tier: frontend\nname: eu\n", string(b))
+
+	b, err = ReadValues(cluster, prod, base)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "labels:\n  region: eu\n  team: a\n  tier: backend\nname: base\n", string(b))
+
+	_, err = ReadValues(base, filepath.Join(dir, "nope.yaml"))
+	testutil.NotOk(t, err)
+}
+
+func TestRenderEnvironments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-environments")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	write := func(file, content string) string {
+		f := filepath.Join(dir, file)
+		testutil.Ok(t, ioutil.WriteFile(f, []byte(content), os.ModePerm))
+		return f
+	}
+	base := write("base.yaml", "name: hello\nreplicas: 1\n")
+	prod := write("prod.yaml", "replicas: 3\n")
+
+	// Renders values as a single ConfigMap, so the test sees what values each environment was rendered with.
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		return rndrapi.Groups{"hello": {{Item: "config", Object: append([]byte("kind: ConfigMap\nvalues:\n"), indent(valuesYAML)...)}}}, nil
+	}
+	out := filepath.Join(dir, "out")
+	rendered, err := RenderEnvironments(context.Background(), log.NewNopLogger(), EnvironmentsOptions{
+		Render: render,
+		Environments: map[string]Environment{
+			"staging": {Values: []string{base}},
+			"prod":    {Values: []string{base, prod}, OutputDir: "production/eu"},
+		},
+		OutputDir: out,
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(rendered))
+
+	b, err := ioutil.ReadFile(filepath.Join(out, "staging", "hello", "0-config.yaml"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "kind: ConfigMap\nvalues:\n  name: hello\n  replicas: 1\n", string(b))
+	b, err = ioutil.ReadFile(filepath.Join(out, "production", "eu", "hello", "0-config.yaml"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "kind: ConfigMap\nvalues:\n  name: hello\n  replicas: 3\n", string(b))
+
+	t.Run("shared output directory can't be cleaned", func(t *testing.T) {
+		_, err := RenderEnvironments(context.Background(), log.NewNopLogger(), EnvironmentsOptions{
+			Render: render,
+			Environments: map[string]Environment{
+				"prod":    {Values: []string{base}, OutputDir: "prod"},
+				"prod-eu": {Values: []string{base}, OutputDir: "prod/eu/.."},
+			},
+			OutputDir: out,
+			Output:    OutputOptions{Clean: true},
+		})
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "environments prod and prod-eu share output directory, so they can't be cleaned", err.Error())
+
+		// Nested environment files are not in the manifest of the parent environment, so they are kept.
+		_, err = RenderEnvironments(context.Background(), log.NewNopLogger(), EnvironmentsOptions{
+			Render: render,
+			Environments: map[string]Environment{
+				"prod":    {Values: []string{base}, OutputDir: "prod"},
+				"prod-eu": {Values: []string{base}, OutputDir: "prod/eu"},
+			},
+			OutputDir: out,
+			Output:    OutputOptions{Clean: true},
+		})
+		testutil.Ok(t, err)
+		_, err = os.Stat(filepath.Join(out, "prod", "eu", "hello", "0-config.yaml"))
+		testutil.Ok(t, err)
+	})
+}
+
+func indent(b []byte) []byte {
+	var ret []byte
+	for _, l := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(l) > 0 {
+			ret = append(append(ret, "  "...), l...)
+		}
+	}
+	return ret
+}
@@ -1,8 +1,38 @@
 package rndrapi
 
+import "context"
+
 type Groups  map[string][]Resource
 
 type Resource struct {
 	Item   string
 	Object []byte
 }
+
+// RenderFunc renders template with given values YAML.
+type RenderFunc func(ctx context.Context, valuesYAML []byte) (Groups, error)
+
+type skipValidationKey struct{}
+
+// WithoutValidation returns context that makes RenderFunc skip values validation, e.g when values are placeholders
+// that would not match API constraints like enums.
+func WithoutValidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipValidationKey{}, true)
+}
+
+// SkipValidation returns true if values validation should be skipped. See WithoutValidation.
+func SkipValidation(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipValidationKey{}).(bool)
+	return skip
+}
+
+// API is a template values API resolved from its definition.
+type API struct {
+	// Schema describes values.
+	Schema *Schema
+	// Defaults is a YAML with default values. Empty if API does not define defaults.
+	Defaults []byte
+	// Validate, if specified, is used instead of Schema to check values. It gets both values and values merged with
+	// defaults, so it can check the final values (e.g required fields) while pointing errors to values YAML positions.
+	Validate func(valuesYAML, withDefaultsYAML []byte) error
+}
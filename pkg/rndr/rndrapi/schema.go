@@ -0,0 +1,22 @@
+package rndrapi
+
+// Schema describes template values. It is a subset of JSON Schema that is also a valid OpenAPI v3 structural schema,
+// so it can be used for both Helm values.schema.json and Kubernetes Custom Resource Definitions.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties describes values of maps. Objects with properties never allow additional ones.
+	AdditionalProperties *Schema       `json:"additionalProperties,omitempty"`
+	Items                *Schema       `json:"items,omitempty"`
+	Required             []string      `json:"required,omitempty"`
+	Enum                 []interface{} `json:"enum,omitempty"`
+	Default              interface{}   `json:"default,omitempty"`
+	Nullable             bool          `json:"nullable,omitempty"`
+
+	// AnyOf is used only for Kubernetes int-or-string types.
+	AnyOf                  []*Schema `json:"anyOf,omitempty"`
+	XIntOrString           bool      `json:"x-kubernetes-int-or-string,omitempty"`
+	XPreserveUnknownFields bool      `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+}
@@ -0,0 +1,269 @@
+package rndrapi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/efficientgo/tools/core/pkg/merrors"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError describes single place where values do not match schema.
+type ValidationError struct {
+	// Path is a path to the value e.g `ports.http` or `containers[0].name`. JSON Schema APIs use JSON pointers
+	// e.g `/containers/0/name`.
+	Path string
+	// Line and Column point to the value (or its closest parent) in values YAML. Zero if unknown.
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "<root>"
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", path, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, path, e.Msg)
+}
+
+// Validate strictly checks values YAML against the schema. All unknown fields, type mismatches and nulls for values
+// that are not nullable are reported with YAML line and column. Required fields are checked in values merged with
+// defaults, since default value satisfies the requirement; missing nullable field is treated as null.
+// Validate does nothing if schema is nil.
+func (s *Schema) Validate(valuesYAML, withDefaultsYAML []byte) error {
+	if s == nil {
+		return nil
+	}
+
+	var n yaml.Node
+	if err := yaml.Unmarshal(valuesYAML, &n); err != nil {
+		return errors.Wrap(err, "parse values")
+	}
+	errs := merrors.New()
+	if len(n.Content) > 0 {
+		s.validate(n.Content[0], "", errs)
+	}
+
+	var d yaml.Node
+	if err := yaml.Unmarshal(withDefaultsYAML, &d); err != nil {
+		return errors.Wrap(err, "parse values with defaults")
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(d.Content) > 0 {
+		root = d.Content[0]
+	}
+	s.validateRequired(root, "", nil, valuesYAML, errs)
+	return errs.Err()
+}
+
+func (s *Schema) validate(n *yaml.Node, path string, errs *merrors.NilOrMultiError) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	fail := func(format string, args ...interface{}) {
+		errs.Add(ValidationError{Path: path, Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if s.XPreserveUnknownFields && s.Type == "" {
+		return
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		if !s.Nullable {
+			fail("null is not allowed; remove the field to leave it unset")
+		}
+		return
+	}
+	if s.XIntOrString || len(s.AnyOf) > 0 {
+		if n.Kind != yaml.ScalarNode || (n.Tag != "!!int" && n.Tag != "!!str") {
+			fail("expected integer or string, got %v", describe(n))
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		if n.Kind != yaml.MappingNode {
+			fail("expected object, got %v", describe(n))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			childPath := k.Value
+			if path != "" {
+				childPath = path + "." + k.Value
+			}
+			if child, ok := s.Properties[k.Value]; ok {
+				child.validate(v, childPath, errs)
+				continue
+			}
+			if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(v, childPath, errs)
+				continue
+			}
+			if s.XPreserveUnknownFields {
+				continue
+			}
+			errs.Add(ValidationError{Path: childPath, Line: k.Line, Column: k.Column, Msg: fmt.Sprintf("unknown field; expected one of: %s", strings.Join(s.propertyNames(), ", "))})
+		}
+	case "array":
+		if n.Kind != yaml.SequenceNode {
+			fail("expected array, got %v", describe(n))
+			return
+		}
+		if s.Items == nil {
+			return
+		}
+		for i, v := range n.Content {
+			s.Items.validate(v, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case "string":
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!str" {
+			fail("expected string, got %v; quote the value if it's meant to be a string", describe(n))
+			return
+		}
+	case "integer":
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!int" {
+			fail("expected integer, got %v", describe(n))
+			return
+		}
+	case "number":
+		if n.Kind != yaml.ScalarNode || (n.Tag != "!!int" && n.Tag != "!!float") {
+			fail("expected number, got %v", describe(n))
+			return
+		}
+	case "boolean":
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" {
+			fail("expected boolean, got %v", describe(n))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && n.Kind == yaml.ScalarNode {
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			fail("%v", err)
+			return
+		}
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				return
+			}
+		}
+		fail("unexpected value %q; expected one of: %v", n.Value, s.Enum)
+	}
+}
+
+// validateRequired reports required fields missing in n, which are values merged with defaults. Errors point to
+// the closest parent in valuesYAML, found by path of object keys and array indexes.
+func (s *Schema) validateRequired(n *yaml.Node, path string, keys []string, valuesYAML []byte, errs *merrors.NilOrMultiError) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	childPath := func(k string) string {
+		if path == "" {
+			return k
+		}
+		return path + "." + k
+	}
+	childKeys := func(k string) []string {
+		return append(append(make([]string, 0, len(keys)+1), keys...), k)
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		for _, r := range s.Required {
+			if lookupChild(n, r) != nil {
+				continue
+			}
+			if child, ok := s.Properties[r]; ok && child.Nullable {
+				continue
+			}
+			line, column := Position(valuesYAML, keys)
+			errs.Add(ValidationError{Path: childPath(r), Line: line, Column: column, Msg: "required field is not set"})
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			child, ok := s.Properties[k.Value]
+			if !ok {
+				child = s.AdditionalProperties
+			}
+			if child != nil {
+				child.validateRequired(v, childPath(k.Value), childKeys(k.Value), valuesYAML, errs)
+			}
+		}
+	case yaml.SequenceNode:
+		if s.Items == nil {
+			return
+		}
+		for i, v := range n.Content {
+			s.Items.validateRequired(v, fmt.Sprintf("%s[%d]", path, i), childKeys(strconv.Itoa(i)), valuesYAML, errs)
+		}
+	}
+}
+
+// Position returns YAML position of the value under given path in values YAML. Path consists of object keys and array
+// indexes. If value is not there (e.g it comes from defaults), position of the closest parent is returned.
+// Zero position is returned if values YAML is empty.
+func Position(valuesYAML []byte, path []string) (line, column int) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(valuesYAML, &n); err != nil || len(n.Content) == 0 {
+		return 0, 0
+	}
+
+	cur := n.Content[0]
+	for _, p := range path {
+		if cur.Kind == yaml.AliasNode {
+			cur = cur.Alias
+		}
+		next := lookupChild(cur, p)
+		if next == nil {
+			break
+		}
+		cur = next
+	}
+	return cur.Line, cur.Column
+}
+
+func lookupChild(n *yaml.Node, p string) *yaml.Node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == p {
+				return n.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(p)
+		if err == nil && i >= 0 && i < len(n.Content) {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
+
+func (s *Schema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for p := range s.Properties {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describe(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	default:
+		return fmt.Sprintf("%s %q", strings.TrimPrefix(n.Tag, "!!"), n.Value)
+	}
+}
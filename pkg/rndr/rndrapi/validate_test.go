@@ -0,0 +1,146 @@
+package rndrapi
+
+import (
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/merrors"
+	"github.com/efficientgo/tools/core/pkg/testutil"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	s := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"name":      {Type: "string"},
+			"replicas":  {Type: "integer"},
+			"ratio":     {Type: "number"},
+			"enabled":   {Type: "boolean"},
+			"labels":    {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+			"ports":     {Type: "array", Items: &Schema{Type: "object", Properties: map[string]*Schema{"port": {Type: "integer"}}}},
+			"memory":    {AnyOf: []*Schema{{Type: "integer"}, {Type: "string"}}, XIntOrString: true},
+			"raw":       {XPreserveUnknownFields: true},
+			"mode":      {Type: "string", Enum: []interface{}{"a", "b"}},
+			"resources": {Type: "object", Properties: map[string]*Schema{}, Nullable: true},
+		},
+	}
+
+	t.Run("nil schema", func(t *testing.T) {
+		testutil.Ok(t, (*Schema)(nil).Validate([]byte("whatever: 1"), []byte("whatever: 1")))
+	})
+	t.Run("empty", func(t *testing.T) {
+		testutil.Ok(t, s.Validate(nil, nil))
+	})
+	t.Run("valid", func(t *testing.T) {
+		values := []byte(`name: hello
+replicas: 3
+ratio: 0.5
+enabled: true
+labels:
+  a: b
+ports:
+- port: 80
+memory: 200m
+raw: {anything: [1, 2]}
+mode: b
+resources: null
+`)
+		testutil.Ok(t, s.Validate(values, values))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		values := []byte(`name: 1.8
+replica: 3
+labels:
+  a: 1
+ports:
+- port: "80"
+mode: c
+`)
+		err := s.Validate(values, values)
+		testutil.NotOk(t, err)
+
+		merr, ok := err.(merrors.Error)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 5, len(merr.Errors()))
+		testutil.Equals(t, ValidationError{Path: "name", Line: 1, Column: 7, Msg: `expected string, got float "1.8"; quote the value if it's meant to be a string`}, merr.Errors()[0])
+		testutil.Equals(t, ValidationError{Path: "replica", Line: 2, Column: 1, Msg: "unknown field; expected one of: enabled, labels, memory, mode, name, ports, ratio, raw, replicas, resources"}, merr.Errors()[1])
+		testutil.Equals(t, "line 4, column 6: labels.a: expected string, got int \"1\"; quote the value if it's meant to be a string", merr.Errors()[2].Error())
+		testutil.Equals(t, "line 6, column 9: ports[0].port: expected integer, got str \"80\"", merr.Errors()[3].Error())
+		testutil.Equals(t, "line 7, column 7: mode: unexpected value \"c\"; expected one of: [a b]", merr.Errors()[4].Error())
+	})
+	t.Run("null", func(t *testing.T) {
+		values := []byte(`name: null
+labels:
+  a: ~
+ports:
+- null
+resources: null
+raw: null
+`)
+		err := s.Validate(values, values)
+		testutil.NotOk(t, err)
+
+		merr, ok := err.(merrors.Error)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 3, len(merr.Errors()))
+		testutil.Equals(t, "line 1, column 7: name: null is not allowed; remove the field to leave it unset", merr.Errors()[0].Error())
+		testutil.Equals(t, "line 3, column 6: labels.a: null is not allowed; remove the field to leave it unset", merr.Errors()[1].Error())
+		testutil.Equals(t, "line 5, column 3: ports[0]: null is not allowed; remove the field to leave it unset", merr.Errors()[2].Error())
+	})
+}
+
+func TestSchema_Validate_Required(t *testing.T) {
+	s := &Schema{
+		Type:     "object",
+		Required: []string{"name", "limits", "container"},
+		Properties: map[string]*Schema{
+			"name":   {Type: "string"},
+			"limits": {Type: "object", Properties: map[string]*Schema{"cpu": {Type: "number"}}, Required: []string{"cpu"}, Nullable: true},
+			"container": {
+				Type:     "object",
+				Required: []string{"image"},
+				Properties: map[string]*Schema{
+					"image": {Type: "string"},
+					"ports": {
+						Type:  "array",
+						Items: &Schema{Type: "object", Required: []string{"port"}, Properties: map[string]*Schema{"port": {Type: "integer"}, "name": {Type: "string"}}},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("set in values", func(t *testing.T) {
+		values := []byte("name: a\ncontainer:\n  image: b\n")
+		testutil.Ok(t, s.Validate(values, values))
+	})
+	t.Run("set in defaults", func(t *testing.T) {
+		testutil.Ok(t, s.Validate([]byte("name: a\n"), []byte("name: a\ncontainer:\n  image: b\n")))
+	})
+	t.Run("empty", func(t *testing.T) {
+		err := s.Validate(nil, nil)
+		testutil.NotOk(t, err)
+
+		merr, ok := err.(merrors.Error)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 2, len(merr.Errors()))
+		testutil.Equals(t, ValidationError{Path: "name", Msg: "required field is not set"}, merr.Errors()[0])
+		testutil.Equals(t, ValidationError{Path: "container", Msg: "required field is not set"}, merr.Errors()[1])
+	})
+	t.Run("missing", func(t *testing.T) {
+		values := []byte(`name: a
+limits: {}
+container:
+  ports:
+  - name: http
+`)
+		err := s.Validate(values, values)
+		testutil.NotOk(t, err)
+
+		merr, ok := err.(merrors.Error)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 3, len(merr.Errors()))
+		testutil.Equals(t, "line 2, column 9: limits.cpu: required field is not set", merr.Errors()[0].Error())
+		testutil.Equals(t, "line 4, column 3: container.image: required field is not set", merr.Errors()[1].Error())
+		testutil.Equals(t, "line 5, column 5: container.ports[0].port: required field is not set", merr.Errors()[2].Error())
+	})
+}
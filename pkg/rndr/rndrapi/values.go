@@ -0,0 +1,64 @@
+package rndrapi
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// MergeValues deep-merges values YAML documents in order, so every next document overrides previous ones:
+// * Objects are merged key by key, recursively.
+// * Lists and scalars replace previous value entirely. Lists are never concatenated.
+// * Explicit null removes the value, so the template sees it as not set (and can't fallback to previous layers).
+// * If types differ, next value replaces previous one.
+func MergeValues(valuesYAML ...[]byte) ([]byte, error) {
+	merged := map[string]interface{}{}
+	for i, b := range valuesYAML {
+		v := map[string]interface{}{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, errors.Wrapf(err, "parse values document %d", i)
+		}
+		merged = mergeObjects(merged, v)
+	}
+	if len(merged) == 0 {
+		return []byte{}, nil
+	}
+	b := bytes.Buffer{}
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(merged); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func mergeObjects(base, override map[string]interface{}) map[string]interface{} {
+	for k, o := range override {
+		if o == nil {
+			delete(base, k)
+			continue
+		}
+		baseObj, ok := base[k].(map[string]interface{})
+		if !ok {
+			base[k] = withoutNulls(o)
+			continue
+		}
+		overrideObj, ok := o.(map[string]interface{})
+		if !ok {
+			base[k] = withoutNulls(o)
+			continue
+		}
+		base[k] = mergeObjects(baseObj, overrideObj)
+	}
+	return base
+}
+
+// withoutNulls removes null object values, so null means not set regardless if there was previous value or not.
+func withoutNulls(v interface{}) interface{} {
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	return mergeObjects(map[string]interface{}{}, o)
+}
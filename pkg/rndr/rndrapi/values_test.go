@@ -0,0 +1,52 @@
+package rndrapi
+
+import (
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+)
+
+func TestMergeValues(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		values   []string
+		expected string
+	}{
+		{name: "no values", expected: ""},
+		{name: "defaults only", values: []string{"name: example\nreplicas: 1\n", ""}, expected: "name: example\nreplicas: 1\n"},
+		{
+			name:     "objects are merged, scalars and lists replaced",
+			values:   []string{"name: example\nports: {http: 80, grpc: 90}\nargs: [a, b]\n", "ports: {http: 8080}\nargs: [c]\n"},
+			expected: "args:\n- c\nname: example\nports:\n  grpc: 90\n  http: 8080\n",
+		},
+		{
+			name:     "null removes value",
+			values:   []string{"name: example\nlabels: {a: b, c: d}\n", "name: null\nlabels: {a: null}\nextra: {x: null, y: 1}\n"},
+			expected: "extra:\n  \"y\": 1\nlabels:\n  c: d\n",
+		},
+		{
+			name:     "type change",
+			values:   []string{"ports: {http: 80}\nname: {first: a}\n", "ports: 80\nname: {first: null}\n", "ports: {http: 81}\n"},
+			expected: "name: {}\nports:\n  http: 81\n",
+		},
+		{
+			name:     "three layers",
+			values:   []string{"a: 1\nb: 1\nc: 1\n", "b: 2\nc: 2\n", "c: 3\n"},
+			expected: "a: 1\nb: 2\nc: 3\n",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var in [][]byte
+			for _, v := range tcase.values {
+				in = append(in, []byte(v))
+			}
+			out, err := MergeValues(in...)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, string(out))
+		})
+	}
+	t.Run("not an object", func(t *testing.T) {
+		_, err := MergeValues([]byte("- a\n"))
+		testutil.NotOk(t, err)
+	})
+}
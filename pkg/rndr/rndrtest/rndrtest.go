@@ -0,0 +1,275 @@
+// Package rndrtest is a golden files test harness for rndr templates.
+//
+// Test cases are `<name>.values.yaml` files in the test directory (usually next to the spec). Each case is rendered and
+// compared object by object with resources in `<name>.golden` directory, which can be regenerated with update option.
+// Optional `<name>.assert.yaml` file (see Assertions) adds assertions to the case.
+package rndrtest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr"
+	"github.com/observatorium/rndr/pkg/rndr/diff"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	valuesSuffix = ".values.yaml"
+	goldenSuffix = ".golden"
+	assertSuffix = ".assert.yaml"
+)
+
+// Case is a single test case.
+type Case struct {
+	Name string
+	// ValuesFile is a path to values template is rendered with.
+	ValuesFile string
+	// GoldenDir is a path to directory with expected resources.
+	GoldenDir string
+	// AssertFile is a path to assertions. Empty if case has no assertions.
+	AssertFile string
+}
+
+// Assertions are additional checks of the test case, defined in `<name>.assert.yaml` file.
+type Assertions struct {
+	// Error, if specified, expects rendering to fail with error containing it. Golden directory is not used then.
+	Error string
+	// Objects expects given objects to be rendered.
+	Objects []ObjectAssertion
+}
+
+// ObjectAssertion expects rendered object e.g:
+//
+//	kind: Deployment
+//	name: hellosvc
+//	contains:
+//	  spec:
+//	    replicas: 3
+type ObjectAssertion struct {
+	// APIVersion and Namespace are matched only if specified. Assertion fails if more than one object matches, e.g
+	// objects with the same name in different namespaces, so Namespace has to be specified then.
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string
+	Namespace  string
+	Name       string
+	// Contains are fields object has to have. Objects are matched recursively, while other values (including lists) have
+	// to be equal.
+	Contains map[string]interface{}
+}
+
+// Discover returns test cases in given directory, sorted by name.
+func Discover(dir string) ([]Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+valuesSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	cases := make([]Case, 0, len(files))
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), valuesSuffix)
+		c := Case{Name: name, ValuesFile: f, GoldenDir: filepath.Join(dir, name+goldenSuffix)}
+		if _, err := os.Stat(filepath.Join(dir, name+assertSuffix)); err == nil {
+			c.AssertFile = filepath.Join(dir, name+assertSuffix)
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// Run renders test case and checks the result. If update is true, golden directory is regenerated instead of compared.
+// It returns error describing why the case failed.
+func (c Case) Run(ctx context.Context, render rndrapi.RenderFunc, update bool) error {
+	a := Assertions{}
+	if c.AssertFile != "" {
+		b, err := ioutil.ReadFile(c.AssertFile)
+		if err != nil {
+			return errors.Wrap(err, "read assertions")
+		}
+		d := yaml.NewDecoder(bytes.NewReader(b))
+		d.KnownFields(true)
+		if err := d.Decode(&a); err != nil && err != io.EOF {
+			return errors.Wrapf(err, "parse assertions %v", c.AssertFile)
+		}
+	}
+
+	values, err := ioutil.ReadFile(c.ValuesFile)
+	if err != nil {
+		return errors.Wrap(err, "read values")
+	}
+	groups, err := render(ctx, values)
+	if a.Error != "" {
+		if err == nil {
+			return errors.Errorf("expected rendering to fail with %q, but it succeeded", a.Error)
+		}
+		if !strings.Contains(err.Error(), a.Error) {
+			return errors.Errorf("expected rendering to fail with %q, got: %v", a.Error, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "render")
+	}
+
+	rendered, err := diff.FromGroups(groups)
+	if err != nil {
+		return err
+	}
+	for _, o := range a.Objects {
+		if err := o.check(rendered); err != nil {
+			return err
+		}
+	}
+
+	if update {
+		return rndr.WriteOutput(groups, c.GoldenDir, rndr.OutputOptions{Clean: true})
+	}
+	if _, err := os.Stat(c.GoldenDir); err != nil {
+		return errors.Wrapf(err, "golden directory %v not found; run with update to generate it", c.GoldenDir)
+	}
+	golden, err := diff.ReadDir(c.GoldenDir)
+	if err != nil {
+		return err
+	}
+	report, err := diff.Compare(rendered, golden)
+	if err != nil {
+		return err
+	}
+	if report.Drift() {
+		b := bytes.Buffer{}
+		if err := report.Write(&b, diff.Unified); err != nil {
+			return err
+		}
+		return errors.Errorf("rendered resources differ from golden %v; run with update if it's expected:\n%s", c.GoldenDir, b.String())
+	}
+	return nil
+}
+
+func (o ObjectAssertion) check(objs diff.Objects) error {
+	expected, err := diff.Normalize(o.Contains)
+	if err != nil {
+		return errors.Wrapf(err, "%v %v expected fields", o.Kind, o.Name)
+	}
+	var matched []diff.ID
+	for id := range objs {
+		if id.Kind != o.Kind || id.Name != o.Name ||
+			(o.APIVersion != "" && id.APIVersion != o.APIVersion) ||
+			(o.Namespace != "" && id.Namespace != o.Namespace) {
+			continue
+		}
+		matched = append(matched, id)
+	}
+	switch len(matched) {
+	case 0:
+		return errors.Errorf("expected %v %v to be rendered", o.Kind, o.Name)
+	case 1:
+	default:
+		sort.Slice(matched, func(i, j int) bool { return matched[i].String() < matched[j].String() })
+		return errors.Errorf("%v %v matches %d objects: %v; specify apiVersion or namespace", o.Kind, o.Name, len(matched), matched)
+	}
+	if path, ok := contains(objs[matched[0]].Value, expected, ""); !ok {
+		return errors.Errorf("%v %v does not match expected %v", o.Kind, o.Name, path)
+	}
+	return nil
+}
+
+// contains returns true if v has all fields of expected. Otherwise it returns path of the first mismatch.
+func contains(v interface{}, expected interface{}, path string) (string, bool) {
+	e, ok := expected.(map[string]interface{})
+	if !ok {
+		return path, reflect.DeepEqual(v, expected)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return path, false
+	}
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if p, ok := contains(m[k], e[k], path+"."+k); !ok {
+			return p, false
+		}
+	}
+	return path, true
+}
+
+// Result is a result of the test case.
+type Result struct {
+	Case Case
+	// Err is nil if case passed.
+	Err error
+}
+
+// Run runs all test cases.
+func Run(ctx context.Context, render rndrapi.RenderFunc, cases []Case, update bool) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		results = append(results, Result{Case: c, Err: c.Run(ctx, render, update)})
+	}
+	return results
+}
+
+// Test runs test cases found next to the spec as Go subtests e.g:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	func TestTemplate(t *testing.T) {
+//		rndrtest.Test(t, "hellosvc.rndr.yaml", *update)
+//	}
+//
+// Specs with templateRef are not supported, use `rndr test` command for those.
+func Test(t *testing.T, specFile string, update bool) {
+	t.Helper()
+
+	specFile, err := filepath.Abs(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := rndr.ParseSpec(b, filepath.Dir(specFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Template == nil {
+		t.Fatalf("spec %v has no template", specFile)
+	}
+
+	ctx := context.Background()
+	render, err := rndr.NewRenderFunc(ctx, log.NewNopLogger(), s.Name, *s.Template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases, err := Discover(filepath.Dir(specFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no test cases (*%s files) found next to %v", valuesSuffix, specFile)
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if err := c.Run(ctx, render, update); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
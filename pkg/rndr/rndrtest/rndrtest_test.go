@@ -0,0 +1,97 @@
+package rndrtest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/observatorium/rndr/pkg/rndr/rndrapi"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndrtest")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	render := func(_ context.Context, valuesYAML []byte) (rndrapi.Groups, error) {
+		v := struct{ Replicas int }{}
+		if err := yaml.Unmarshal(valuesYAML, &v); err != nil {
+			return nil, err
+		}
+		if v.Replicas < 0 {
+			return nil, errors.New("replicas can't be negative")
+		}
+		return rndrapi.Groups{"hello": {{
+			Item:   "deployment",
+			Object: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: hello\nspec:\n  replicas: " + strings.Repeat("1", v.Replicas) + "\n"),
+		}}}, nil
+	}
+	write := func(file, content string) {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), os.ModePerm))
+	}
+	write("three.values.yaml", "replicas: 3\n")
+	write("three.assert.yaml", "objects:\n- kind: Deployment\n  name: hello\n  contains:\n    spec: {replicas: 111}\n")
+	write("negative.values.yaml", "replicas: -1\n")
+	write("negative.assert.yaml", "error: can't be negative\n")
+	write("unrelated.yaml", "replicas: 1\n")
+
+	cases, err := Discover(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Case{
+		{Name: "negative", ValuesFile: filepath.Join(dir, "negative.values.yaml"), GoldenDir: filepath.Join(dir, "negative.golden"), AssertFile: filepath.Join(dir, "negative.assert.yaml")},
+		{Name: "three", ValuesFile: filepath.Join(dir, "three.values.yaml"), GoldenDir: filepath.Join(dir, "three.golden"), AssertFile: filepath.Join(dir, "three.assert.yaml")},
+	}, cases)
+
+	ctx := context.Background()
+	failed := func(results []Result) (ret []string) {
+		for _, r := range results {
+			if r.Err != nil {
+				ret = append(ret, r.Case.Name)
+			}
+		}
+		return ret
+	}
+
+	// Golden directory does not exist yet.
+	testutil.Equals(t, []string{"three"}, failed(Run(ctx, render, cases, false)))
+	testutil.Equals(t, []string(nil), failed(Run(ctx, render, cases, true)))
+	testutil.Equals(t, []string(nil), failed(Run(ctx, render, cases, false)))
+	_, err = os.Stat(filepath.Join(dir, "negative.golden"))
+	testutil.Assert(t, os.IsNotExist(err), "golden directory is not used for failing case")
+
+	// Reformatted golden file is still fine.
+	golden := filepath.Join(dir, "three.golden", "hello", "0-deployment.yaml")
+	testutil.Ok(t, ioutil.WriteFile(golden, []byte(`{"spec": {"replicas": 111}, "metadata": {"name": "hello"}, "kind": "Deployment", "apiVersion": "apps/v1"}`), os.ModePerm))
+	testutil.Equals(t, []string(nil), failed(Run(ctx, render, cases, false)))
+
+	write("three.values.yaml", "replicas: 2\n")
+	write("negative.values.yaml", "replicas: 1\n")
+	results := Run(ctx, render, cases, false)
+	testutil.Equals(t, []string{"negative", "three"}, failed(results))
+	testutil.Equals(t, `expected rendering to fail with "can't be negative", but it succeeded`, results[0].Err.Error())
+	testutil.Equals(t, "Deployment hello does not match expected .spec.replicas", results[1].Err.Error())
+
+	// Objects with the same name in different namespaces can't be matched without namespace.
+	multi := func(_ context.Context, _ []byte) (rndrapi.Groups, error) {
+		return rndrapi.Groups{"hello": {
+			{Item: "a", Object: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata: {name: hello, namespace: a}\n")},
+			{Item: "b", Object: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata: {name: hello, namespace: b}\ndata: {x: y}\n")},
+		}}, nil
+	}
+	multiCase := []Case{{Name: "multi", ValuesFile: cases[1].ValuesFile, GoldenDir: filepath.Join(dir, "multi.golden"), AssertFile: filepath.Join(dir, "multi.assert.yaml")}}
+	write("multi.assert.yaml", "objects:\n- kind: ConfigMap\n  name: hello\n")
+	results = Run(ctx, multi, multiCase, true)
+	testutil.Equals(t, "ConfigMap hello matches 2 objects: [v1 ConfigMap a/hello v1 ConfigMap b/hello]; specify apiVersion or namespace", results[0].Err.Error())
+	write("multi.assert.yaml", "objects:\n- kind: ConfigMap\n  name: hello\n  namespace: b\n  contains: {data: {x: y}}\n")
+	testutil.Equals(t, []string(nil), failed(Run(ctx, multi, multiCase, true)))
+
+	write("three.assert.yaml", "")
+	results = Run(ctx, render, cases, false)
+	testutil.Assert(t, strings.Contains(results[1].Err.Error(), "-  replicas: 111\n+  replicas: 11\n"), results[1].Err.Error())
+}
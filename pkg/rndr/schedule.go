@@ -0,0 +1,206 @@
+package rndr
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// PackageResult is a result of rendering single package.
+type PackageResult struct {
+	Name string
+	// Err is nil if package was rendered.
+	Err error
+}
+
+// RenderPackages renders given packages concurrently, at most parallelism at once. Package is rendered once packages
+// from its DependsOn are rendered; dependencies that are not given are assumed to be rendered already. Failed package
+// does not stop rendering of others, except those depending on it. Template API is loaded only once.
+// Logs of each package are buffered and written in package name order, so they are not interleaved. It returns results
+// sorted by package name.
+func RenderPackages(ctx context.Context, logger log.Logger, name, author string, t Template, pkgs map[string]Package, parallelism int) ([]PackageResult, error) {
+	if cycle := dependencyCycle(pkgs); len(cycle) > 0 {
+		return nil, errors.Errorf("packages dependency cycle %s", strings.Join(cycle, " -> "))
+	}
+	api, err := LoadAPI(ctx, logger, t.API)
+	if err != nil {
+		return nil, errors.Wrap(err, "load template API")
+	}
+	return schedule(ctx, logger, pkgs, parallelism, func(ctx context.Context, logger log.Logger, p string) error {
+		return renderPackage(ctx, logger, name, author, t, api, pkgs[p], pkgs[p].OutputDir)
+	}), nil
+}
+
+// schedule runs fn for each package once its dependencies succeeded, with at most parallelism fn calls at once.
+// Packages must not have dependency cycles.
+func schedule(ctx context.Context, logger log.Logger, pkgs map[string]Package, parallelism int, fn func(ctx context.Context, logger log.Logger, p string) error) []PackageResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	names := make([]string, 0, len(pkgs))
+	for p := range pkgs {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	index := make(map[string]int, len(names))
+	for i, p := range names {
+		index[p] = i
+	}
+
+	type done struct {
+		i   int
+		err error
+	}
+	var (
+		results  = make([]PackageResult, len(names))
+		logs     = make([]*bufferedLogger, len(names))
+		started  = make([]bool, len(names))
+		finished = make([]bool, len(names))
+		doneCh   = make(chan done)
+
+		running, completed, flushed int
+	)
+	complete := func(i int, err error) {
+		results[i] = PackageResult{Name: names[i], Err: err}
+		finished[i] = true
+		completed++
+		// Write logs of packages in name order as soon as all previous ones are done.
+		for ; flushed < len(names) && finished[flushed]; flushed++ {
+			if logs[flushed] != nil {
+				logs[flushed].flush(logger)
+			}
+			if err := results[flushed].Err; err != nil {
+				level.Error(logger).Log("msg", "failed to render package", "package", names[flushed], "err", err)
+				continue
+			}
+			level.Info(logger).Log("msg", "rendered package", "package", names[flushed])
+		}
+	}
+	// ready returns true if all dependencies of the package are done, with error if any of them failed.
+	ready := func(i int) (bool, error) {
+		for _, d := range pkgs[names[i]].DependsOn {
+			j, ok := index[d]
+			if !ok {
+				continue
+			}
+			if !finished[j] {
+				return false, nil
+			}
+			if results[j].Err != nil {
+				return true, errors.Errorf("dependency %v failed", d)
+			}
+		}
+		return true, nil
+	}
+
+	for completed < len(names) {
+		// Packages can be completed without running when their dependency failed, which can make others ready.
+		for progress := true; progress; {
+			progress = false
+			for i := range names {
+				if started[i] || running >= parallelism {
+					continue
+				}
+				ok, err := ready(i)
+				if !ok {
+					continue
+				}
+				started[i] = true
+				if err != nil {
+					complete(i, err)
+					progress = true
+					continue
+				}
+
+				running++
+				logs[i] = &bufferedLogger{}
+				go func(i int) {
+					doneCh <- done{i: i, err: fn(ctx, log.With(logs[i], "package", names[i]), names[i])}
+				}(i)
+			}
+		}
+		if running == 0 {
+			break
+		}
+		d := <-doneCh
+		running--
+		complete(d.i, d.err)
+	}
+	return results
+}
+
+// dependencyCycle returns names of packages forming dependency cycle, with the first one repeated at the end, or nil
+// if there is no cycle. Dependencies on unknown packages are ignored.
+func dependencyCycle(pkgs map[string]Package) []string {
+	names := make([]string, 0, len(pkgs))
+	for p := range pkgs {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(pkgs))
+	var path []string
+	var visit func(p string) []string
+	visit = func(p string) []string {
+		switch state[p] {
+		case visited:
+			return nil
+		case visiting:
+			for i := range path {
+				if path[i] == p {
+					return append(append([]string{}, path[i:]...), p)
+				}
+			}
+		}
+		state[p] = visiting
+		path = append(path, p)
+		for _, d := range pkgs[p].DependsOn {
+			if _, ok := pkgs[d]; !ok {
+				continue
+			}
+			if cycle := visit(d); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[p] = visited
+		return nil
+	}
+	for _, p := range names {
+		if cycle := visit(p); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// bufferedLogger collects log lines, so logs of concurrent work can be written in deterministic order.
+type bufferedLogger struct {
+	mtx   sync.Mutex
+	lines [][]interface{}
+}
+
+func (l *bufferedLogger) Log(keyvals ...interface{}) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.lines = append(l.lines, append([]interface{}{}, keyvals...))
+	return nil
+}
+
+func (l *bufferedLogger) flush(logger log.Logger) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, kv := range l.lines {
+		_ = logger.Log(kv...)
+	}
+	l.lines = nil
+}
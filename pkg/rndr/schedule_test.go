@@ -0,0 +1,124 @@
+package rndr
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+func TestSchedule(t *testing.T) {
+	pkgs := map[string]Package{
+		"olm":       {DependsOn: []string{"operator"}},
+		"operator":  {},
+		"helm":      {},
+		"jsonnet":   {DependsOn: []string{"not-chosen"}},
+		"appsre":    {DependsOn: []string{"helm", "jsonnet"}},
+		"kustomize": {DependsOn: []string{"olm"}},
+	}
+
+	var (
+		mtx               sync.Mutex
+		running, maxSeen  int
+		order             []string
+		failing           = map[string]bool{"operator": true}
+		parallelism       = 2
+		b                 = bytes.Buffer{}
+		logger            = log.NewLogfmtLogger(&b)
+		renderedBeforeDep = func(p string) bool {
+			for _, d := range pkgs[p].DependsOn {
+				found := false
+				for _, o := range order {
+					found = found || o == d
+				}
+				if _, chosen := pkgs[d]; chosen && !found {
+					return true
+				}
+			}
+			return false
+		}
+	)
+	results := schedule(context.Background(), logger, pkgs, parallelism, func(_ context.Context, logger log.Logger, p string) error {
+		mtx.Lock()
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		testutil.Assert(t, !renderedBeforeDep(p), "%v rendered before its dependencies", p)
+		mtx.Unlock()
+
+		_ = logger.Log("msg", "rendering")
+		time.Sleep(20 * time.Millisecond)
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		running--
+		order = append(order, p)
+		if failing[p] {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	testutil.Equals(t, parallelism, maxSeen)
+	errs := map[string]string{}
+	for _, r := range results {
+		errs[r.Name] = ""
+		if r.Err != nil {
+			errs[r.Name] = r.Err.Error()
+		}
+	}
+	testutil.Equals(t, []string{"appsre", "helm", "jsonnet", "kustomize", "olm", "operator"}, names(results))
+	testutil.Equals(t, map[string]string{
+		"appsre":    "",
+		"helm":      "",
+		"jsonnet":   "",
+		"kustomize": "dependency olm failed",
+		"olm":       "dependency operator failed",
+		"operator":  "boom",
+	}, errs)
+	sort.Strings(order)
+	testutil.Equals(t, []string{"appsre", "helm", "jsonnet", "operator"}, order)
+
+	// Logs are grouped by package and ordered by name.
+	testutil.Equals(t, `package=appsre msg=rendering
+level=info msg="rendered package" package=appsre
+package=helm msg=rendering
+level=info msg="rendered package" package=helm
+package=jsonnet msg=rendering
+level=info msg="rendered package" package=jsonnet
+level=error msg="failed to render package" package=kustomize err="dependency olm failed"
+level=error msg="failed to render package" package=olm err="dependency operator failed"
+package=operator msg=rendering
+level=error msg="failed to render package" package=operator err=boom
+`, b.String())
+}
+
+func names(results []PackageResult) []string {
+	ret := make([]string, 0, len(results))
+	for _, r := range results {
+		ret = append(ret, r.Name)
+	}
+	return ret
+}
+
+func TestDependencyCycle(t *testing.T) {
+	testutil.Equals(t, []string(nil), dependencyCycle(map[string]Package{
+		"a": {DependsOn: []string{"b", "c"}},
+		"b": {DependsOn: []string{"c", "unknown"}},
+		"c": {},
+	}))
+	testutil.Equals(t, []string{"b", "c", "d", "b"}, dependencyCycle(map[string]Package{
+		"a": {DependsOn: []string{"b"}},
+		"b": {DependsOn: []string{"c"}},
+		"c": {DependsOn: []string{"d"}},
+		"d": {DependsOn: []string{"b"}},
+	}))
+	testutil.Equals(t, []string{"a", "a"}, dependencyCycle(map[string]Package{"a": {DependsOn: []string{"a"}}}))
+}
@@ -1,98 +1,360 @@
 package rndr
 
 import (
+	"bytes"
+	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/efficientgo/tools/core/pkg/merrors"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
 // Spec specifies the renderable definition file.
 type Spec struct {
+	// APIVersion is a version of the spec format. See CurrentSpecVersion.
+	APIVersion string `yaml:"apiVersion"`
+
 	Name    string
 	Authors string
 
-	Template *Template
-	TemplateRef *TemplateRef
-
+	// One of.
+	Template    *Template
+	TemplateRef *TemplateRef `yaml:"templateRef"`
 
 	// Packages is a map of packages made using provided renderable spec.
 	Packages map[string]Package
+
+	// Environments is a map of environments template is rendered for with `rndr output`.
+	Environments map[string]Environment
+}
+
+// Environment specifies values template is rendered with for a single environment e.g cluster.
+type Environment struct {
+	// Values are paths to values YAML files deep-merged in order, so later files override earlier ones
+	// (e.g base, environment and cluster overrides). API defaults are used for values not specified in any of those.
+	Values []string
+	// OutputDir is a directory resources are rendered into, relative to the `rndr output` output directory.
+	// Environment name is used if empty.
+	OutputDir string `yaml:"outputDir"`
 }
 
+// TemplateRef references template of another rndr spec, so it can be consumed with own packages. Only `template` of the
+// referenced spec is used. Referenced git commits and OCI manifests are pinned in the lock file (see LockFile).
 type TemplateRef struct {
-	// TODO
+	// One of.
+	// Path is a path to the rndr spec file on local filesystem.
+	Path string
+	Git  *GitTemplateRef
+	OCI  *OCITemplateRef `yaml:"oci"`
+
+	// Dir is a directory relative paths are resolved against. ParseSpec sets it to the spec directory.
+	Dir string `yaml:"-"`
+}
+
+// GitTemplateRef references rndr spec in a git repository. Repository is mirrored into the rndr cache directory and the
+// revision is checked out from there.
+type GitTemplateRef struct {
+	// Repository is a URL or local path (e.g local mirror) of the git repository.
+	Repository string
+	// Revision is a branch, tag or commit to check out. HEAD is used if empty.
+	Revision string
+	// Spec is a path to the rndr spec file within the repository.
+	Spec string
+}
+
+// OCITemplateRef references rndr spec in a directory with OCI image layout
+// (https://github.com/opencontainers/image-spec/blob/master/image-layout.md). Image layers are unpacked into the rndr
+// cache directory.
+type OCITemplateRef struct {
+	// Layout is a path to the OCI image layout directory.
+	Layout string
+	// Tag is a `org.opencontainers.image.ref.name` annotation of the manifest in the layout index. It can be empty if
+	// layout has only one manifest.
+	Tag string
+	// Spec is a path to the rndr spec file within the image.
+	Spec string
 }
 
-// ParseSpec parses Spec from bytes.
-// TODO(bwplotka): Version it.
-// TODO(bwplotka): Validate one-offs.
+// String returns reference in a form used as a lock file key.
+func (r TemplateRef) String() string {
+	switch {
+	case r.Git != nil:
+		rev := r.Git.Revision
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return fmt.Sprintf("git:%s@%s:%s", r.Git.Repository, rev, r.Git.Spec)
+	case r.OCI != nil:
+		return fmt.Sprintf("oci:%s@%s:%s", r.OCI.Layout, r.OCI.Tag, r.OCI.Spec)
+	default:
+		return "path:" + r.Path
+	}
+}
+
+// ParseSpec parses Spec from bytes. Unknown fields are rejected. Specs in older format versions are migrated in memory,
+// use MigrateSpec to update them permanently.
+// All problems found in the spec are returned together as a multi error, with YAML line numbers.
 func ParseSpec(b []byte, dir string) (Spec, error) {
+	doc, err := parseSpecNode(b)
+	if err != nil {
+		return Spec{}, err
+	}
+	v, err := apiVersion(doc)
+	if err != nil {
+		return Spec{}, err
+	}
+	if v != CurrentSpecVersion() {
+		if b, err = MigrateSpec(b); err != nil {
+			return Spec{}, err
+		}
+		if doc, err = parseSpecNode(b); err != nil {
+			return Spec{}, err
+		}
+	}
+
+	sv := specValidator{doc: doc.Content[0], errs: merrors.New()}
 	s := Spec{}
-	if err := yaml.Unmarshal(b, &s); err != nil {
-		return Spec{}, errors.Wrapf(err, "parsing template content %q", string(b))
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(&s); err != nil {
+		terr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return Spec{}, errors.Wrap(err, "parse spec")
+		}
+		// Type errors do not stop decoding, so we can report them together with other problems.
+		for _, e := range terr.Errors {
+			sv.errs.Add(errors.New(e))
+		}
 	}
+	sv.validate(&s, dir)
 
-	if s.Name == "" {
-		return Spec{}, errors.New("name not specified, but required")
+	if err := sv.errs.Err(); err != nil {
+		if v != CurrentSpecVersion() {
+			return Spec{}, errors.Wrapf(err, "invalid spec migrated from %v to %v; run 'rndr spec migrate' to see migrated spec", v, CurrentSpecVersion())
+		}
+		return Spec{}, errors.Wrap(err, "invalid spec")
 	}
+	return s, nil
+}
+
+// specValidator validates parsed spec and resolves relative paths against spec directory.
+type specValidator struct {
+	doc  *yaml.Node
+	errs *merrors.NilOrMultiError
+}
 
-	if s.Authors == "" {
-		return Spec{}, errors.New("authors not specified, but required")
+// fail adds error pointing to the YAML line of given path (or its closest parent).
+func (sv specValidator) fail(path []string, format string, args ...interface{}) {
+	n := sv.doc
+	for i := range path {
+		next := lookupNode(sv.doc, path[:i+1]...)
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	p := strings.Join(path, ".")
+	if p == "" {
+		p = "<root>"
 	}
+	sv.errs.Add(errors.Errorf("line %d: %s: %s", n.Line, p, fmt.Sprintf(format, args...)))
+}
 
-	if s.Template != nil {
-		switch {
-		case s.Template.API.Go != nil:
-			if s.Template.API.Go.Struct == "" {
-				return Spec{}, errors.New("api.go.struct not specified, but required")
+type option struct {
+	name string
+	set  bool
+}
+
+// oneOf checks that exactly one of union options is set and returns its name.
+func (sv specValidator) oneOf(path []string, opts ...option) string {
+	var names, set []string
+	for _, o := range opts {
+		names = append(names, o.name)
+		if o.set {
+			set = append(set, o.name)
+		}
+	}
+	switch len(set) {
+	case 1:
+		return set[0]
+	case 0:
+		sv.fail(path, "exactly one of %s has to be specified, got none", strings.Join(names, ", "))
+	default:
+		sv.fail(path, "exactly one of %s has to be specified, got %s", strings.Join(names, ", "), strings.Join(set, ", "))
+	}
+	return ""
+}
+
+func (sv specValidator) required(path []string, v string) {
+	if v == "" {
+		sv.fail(path, "not specified, but required")
+	}
+}
+
+func (sv specValidator) validate(s *Spec, dir string) {
+	sv.required([]string{"name"}, s.Name)
+	sv.required([]string{"authors"}, s.Authors)
+
+	switch sv.oneOf(nil, option{"template", s.Template != nil}, option{"templateRef", s.TemplateRef != nil}) {
+	case "template":
+		sv.validateTemplate(s.Template, dir)
+	case "templateRef":
+		sv.validateTemplateRef(s.TemplateRef, dir)
+	}
+
+	// Map order is random; sort names, so errors are reported in the same order every time.
+	pkgs := make([]string, 0, len(s.Packages))
+	for p := range s.Packages {
+		pkgs = append(pkgs, p)
+	}
+	sort.Strings(pkgs)
+	for _, p := range pkgs {
+		o := s.Packages[p]
+		path := []string{"packages", p}
+		if o.OutputDir != "" {
+			o.OutputDir = abs(o.OutputDir, dir)
+			s.Packages[p] = o
+		}
+		for _, d := range o.DependsOn {
+			if _, ok := s.Packages[d]; !ok {
+				sv.fail(append(path, "dependsOn"), "package %v not found in spec", d)
+			}
+		}
+		switch sv.oneOf(path,
+			option{"olm", o.OLM != nil},
+			option{"kubeOperator", o.KubeOperator != nil},
+			option{"helm", o.Helm != nil},
+			option{"openshiftTemplate", o.OpenshiftTemplate != nil},
+			option{"jsonnet", o.Jsonnet != nil},
+			option{"kustomize", o.Kustomize != nil},
+		) {
+		case "olm":
+			if o.OLM.Icon != "" {
+				o.OLM.Icon = abs(o.OLM.Icon, dir)
+			}
+		case "openshiftTemplate":
+			if o.OpenshiftTemplate.Values != "" {
+				o.OpenshiftTemplate.Values = abs(o.OpenshiftTemplate.Values, dir)
+			}
+		case "jsonnet":
+			if o.Jsonnet.Values != "" {
+				o.Jsonnet.Values = abs(o.Jsonnet.Values, dir)
 			}
-		case s.Template.API.Proto != nil:
-			if s.Template.API.Proto.Message == "" {
-				return Spec{}, errors.New("api.proto.message not specified, but required")
+		case "kustomize":
+			if o.Kustomize.Values != "" {
+				o.Kustomize.Values = abs(o.Kustomize.Values, dir)
 			}
-			if s.Template.API.Proto.File == "" {
-				return Spec{}, errors.New("api.proto.file not specified, but required")
+			for i := range o.Kustomize.Overlays {
+				o.Kustomize.Overlays[i] = abs(o.Kustomize.Overlays[i], dir)
 			}
-			s.Template.API.Proto.File = abs(s.Template.API.Proto.File, dir)
-		default:
-			return Spec{}, errors.New("template api has to be specified, got none")
 		}
-	} else {
-		// TODO: Implement ref.
-		return Spec{}, errors.New("template has to be specified, got none")
 	}
 
+	if cycle := dependencyCycle(s.Packages); len(cycle) > 0 {
+		sv.fail([]string{"packages", cycle[0], "dependsOn"}, "dependency cycle %s", strings.Join(cycle, " -> "))
+	}
 
-	// TODO(bwplotka): Add validation for renderers.
-	switch {
-	case s.Template.Renderer.Jsonnet != nil:
-		if len(s.Template.Renderer.Jsonnet.Functions) == 0 {
-			return Spec{}, errors.New("jsonnet template renderer has to have at least single function file specified, got none")
+	envs := make([]string, 0, len(s.Environments))
+	for n := range s.Environments {
+		envs = append(envs, n)
+	}
+	sort.Strings(envs)
+	for _, n := range envs {
+		e := s.Environments[n]
+		if e.OutputDir == "" {
+			e.OutputDir = n
 		}
-		for i := range s.Template.Renderer.Jsonnet.Functions {
-			s.Template.Renderer.Jsonnet.Functions[i] = abs(s.Template.Renderer.Jsonnet.Functions[i], dir)
+		if filepath.IsAbs(e.OutputDir) || outsideDir(e.OutputDir) {
+			sv.fail([]string{"environments", n, "outputDir"}, "has to be a relative path within the output directory, got %v", e.OutputDir)
 		}
+		for i := range e.Values {
+			e.Values[i] = abs(e.Values[i], dir)
+		}
+		s.Environments[n] = e
+	}
+}
 
-	case s.Template.Renderer.Helm != nil:
-	case s.Template.Renderer.Process != nil:
-		s.Template.Renderer.Process.Command = abs(s.Template.Renderer.Process.Command, dir)
-	default:
-		return Spec{}, errors.New("template renderer has to be specified, got none")
+// outsideDir returns true if relative path points outside of the directory it's relative to. Names only starting with
+// two dots (e.g `..prod`) are within the directory.
+func outsideDir(rel string) bool {
+	c := filepath.Clean(rel)
+	return c == ".." || strings.HasPrefix(c, ".."+string(filepath.Separator))
+}
+
+func (sv specValidator) validateTemplate(t *Template, dir string) {
+	t.Dir = dir
+	api := t.API
+	path := []string{"template", "api"}
+	switch sv.oneOf(path, option{"go", api.Go != nil}, option{"proto", api.Proto != nil}, option{"jsonSchema", api.JSONSchema != nil}) {
+	case "go":
+		sv.required(append(path, "go", "struct"), api.Go.Struct)
+		api.Go.Dir = dir
+	case "proto":
+		sv.required(append(path, "proto", "message"), api.Proto.Message)
+		sv.required(append(path, "proto", "file"), api.Proto.File)
+		api.Proto.File = abs(api.Proto.File, dir)
+		for i := range api.Proto.ImportPaths {
+			api.Proto.ImportPaths[i] = abs(api.Proto.ImportPaths[i], dir)
+		}
+	case "jsonSchema":
+		sv.required(append(path, "jsonSchema", "file"), api.JSONSchema.File)
+		api.JSONSchema.File = abs(api.JSONSchema.File, dir)
 	}
 
-	for p, o := range s.Packages {
+	// TODO(bwplotka): Add validation for renderers.
+	r := t.Renderer
+	path = []string{"template", "renderer"}
+	switch sv.oneOf(path, option{"jsonnet", r.Jsonnet != nil}, option{"helm", r.Helm != nil}, option{"process", r.Process != nil}) {
+	case "jsonnet":
+		if len(r.Jsonnet.Functions) == 0 {
+			sv.fail(append(path, "jsonnet", "functions"), "jsonnet template renderer has to have at least single function file specified, got none")
+		}
+		for i := range r.Jsonnet.Functions {
+			r.Jsonnet.Functions[i] = abs(r.Jsonnet.Functions[i], dir)
+		}
+	case "helm":
+		if r.Helm.Chart == "" {
+			sv.fail(append(path, "helm", "chart"), "helm template renderer has to have chart specified, got none")
+		}
 		switch {
-		case o.OLM != nil:
-		case o.KubeOperator != nil:
-		case o.OpenshiftTemplate != nil:
-		case o.Helm != nil:
-		default:
-			return Spec{}, errors.Errorf("package type has to be specified, got none for %v", p)
+		case r.Helm.Repo == "":
+			r.Helm.Chart = abs(r.Helm.Chart, dir)
+		case !strings.Contains(r.Helm.Repo, "://"):
+			r.Helm.Repo = abs(r.Helm.Repo, dir)
+		}
+	case "process":
+		sv.required(append(path, "process", "command"), r.Process.Command)
+		r.Process.Command = abs(r.Process.Command, dir)
+		for i := range r.Process.Inputs {
+			r.Process.Inputs[i] = abs(r.Process.Inputs[i], dir)
 		}
 	}
+}
 
-	return s, nil
+func (sv specValidator) validateTemplateRef(r *TemplateRef, dir string) {
+	path := []string{"templateRef"}
+	switch sv.oneOf(path, option{"path", r.Path != ""}, option{"git", r.Git != nil}, option{"oci", r.OCI != nil}) {
+	case "git":
+		sv.required(append(path, "git", "repository"), r.Git.Repository)
+		sv.required(append(path, "git", "spec"), r.Git.Spec)
+		sv.relative(append(path, "git", "spec"), r.Git.Spec)
+	case "oci":
+		sv.required(append(path, "oci", "layout"), r.OCI.Layout)
+		sv.required(append(path, "oci", "spec"), r.OCI.Spec)
+		sv.relative(append(path, "oci", "spec"), r.OCI.Spec)
+	}
+	// Paths are kept as written, so lock file keys do not depend on where the spec is checked out.
+	r.Dir = dir
+}
+
+// relative checks that path stays within its root directory.
+func (sv specValidator) relative(path []string, p string) {
+	if filepath.IsAbs(p) || outsideDir(p) {
+		sv.fail(path, "has to be a relative path within the referenced source, got %v", p)
+	}
 }
 
 func abs(path string, relDir string) string {
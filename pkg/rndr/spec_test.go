@@ -1,11 +1,13 @@
 package rndr
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/efficientgo/tools/core/pkg/testutil"
 	"github.com/observatorium/rndr/pkg/rndr/engines/golang"
 	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+	"github.com/observatorium/rndr/pkg/rndr/engines/proto"
 )
 
 func TestParseSpec(t *testing.T) {
@@ -14,7 +16,8 @@ func TestParseSpec(t *testing.T) {
 		testutil.NotOk(t, err)
 	})
 	t.Run("valid", func(t *testing.T) {
-		tmpl, err := ParseSpec([]byte(`name: "helloservice"
+		tmpl, err := ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
 authors: "team@example.com"
 
 template:
@@ -33,6 +36,7 @@ template:
 `), "")
 		testutil.Ok(t, err)
 		testutil.Equals(t,  Spec{
+			APIVersion: SpecV1,
 			Name:    "helloservice",
 			Authors: "team@example.com",
 	Template: &Template{
@@ -52,7 +56,8 @@ template:
 		testutil.NotOk(t, err)
 	})
 	t.Run("parsable but too many entries for one-ofs", func(t *testing.T) {
-		_, err := ParseSpec([]byte(`name: "helloservice"
+		_, err := ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
 authors: "team@example.com"
 
 template:
@@ -62,13 +67,13 @@ template:
       default: "github.com/observatorium/rndr/examples/hellosvc/api.Default()"
       struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
     proto:
-      entry: "Config"
+      message: "Config"
       file: "openproto/protoconfig.proto"
 
   # renderer defines the rendering engine.
   renderer:
     jsonnet:
-      file: hellosvc.libsonnet
+      functions: [hellosvc.libsonnet]
     helm:
       chart: prometheus
       repo: 
@@ -76,8 +81,246 @@ template:
       command: "./my-cmd"
       inputEnvVar: "INPUT"
       arguments:
-      - "--config=${INPUT}
+      - "--config=${INPUT}"
+
+packages:
+  both:
+    helm: {}
+    olm: {}
+`), "")
+		testutil.NotOk(t, err)
+		for _, exp := range []string{
+			"line 8: template.api: exactly one of go, proto, jsonSchema has to be specified, got go, proto",
+			"line 17: template.renderer: exactly one of jsonnet, helm, process has to be specified, got jsonnet, helm, process",
+			"line 30: packages.both: exactly one of olm, kubeOperator, helm, openshiftTemplate, jsonnet, kustomize has to be specified, got olm, helm",
+		} {
+			testutil.Assert(t, strings.Contains(err.Error(), exp), "expected %q in %v", exp, err)
+		}
+	})
+	t.Run("all problems are reported", func(t *testing.T) {
+		_, err := ParseSpec([]byte(`apiVersion: v1
+authors: ""
+templat: {}
+`), "")
+		testutil.NotOk(t, err)
+		for _, exp := range []string{
+			"line 3: field templat not found in type rndr.Spec",
+			"line 1: name: not specified, but required",
+			"line 2: authors: not specified, but required",
+			"line 1: <root>: exactly one of template, templateRef has to be specified, got none",
+		} {
+			testutil.Assert(t, strings.Contains(err.Error(), exp), "expected %q in %v", exp, err)
+		}
+	})
+	t.Run("invalid templateRef", func(t *testing.T) {
+		_, err := ParseSpec([]byte(`apiVersion: v1
+name: "consumer"
+authors: "team@example.com"
+templateRef:
+  git:
+    repository: https://github.com/observatorium/rndr
+    spec: ../spec.yaml
+`), "")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "line 7: templateRef.git.spec: has to be a relative path within the referenced source, got ../spec.yaml"), err.Error())
+
+		// Names only starting with two dots are within the source.
+		_, err = ParseSpec([]byte(`apiVersion: v1
+name: "consumer"
+authors: "team@example.com"
+templateRef:
+  git:
+    repository: https://github.com/observatorium/rndr
+    spec: ..specs/spec.yaml
+`), "")
+		testutil.Ok(t, err)
+	})
+	t.Run("packages errors are ordered by name", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			_, err := ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+packages:
+  c: {}
+  a: {}
+  b: {}
+`), "")
+			testutil.NotOk(t, err)
+			a, b, c := strings.Index(err.Error(), "packages.a:"), strings.Index(err.Error(), "packages.b:"), strings.Index(err.Error(), "packages.c:")
+			testutil.Assert(t, a >= 0 && a < b && b < c, err.Error())
+		}
+	})
+	t.Run("environments", func(t *testing.T) {
+		s, err := ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+environments:
+  prod:
+    values: [base.values.yaml, /abs/prod.values.yaml]
+  prod-eu:
+    values: [base.values.yaml, prod.values.yaml, eu.values.yaml]
+    outputDir: prod/eu
+  staging:
+    values: [base.values.yaml]
+    outputDir: ..staging
+`), "/spec")
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]Environment{
+			"prod":    {Values: []string{"/spec/base.values.yaml", "/abs/prod.values.yaml"}, OutputDir: "prod"},
+			"prod-eu": {Values: []string{"/spec/base.values.yaml", "/spec/prod.values.yaml", "/spec/eu.values.yaml"}, OutputDir: "prod/eu"},
+			"staging": {Values: []string{"/spec/base.values.yaml"}, OutputDir: "..staging"},
+		}, s.Environments)
+
+		_, err = ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+environments:
+  prod:
+    outputDir: ../prod
+`), "")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "line 13: environments.prod.outputDir: has to be a relative path within the output directory, got ../prod"), err.Error())
+	})
+	t.Run("packages dependencies", func(t *testing.T) {
+		_, err := ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+packages:
+  operator:
+    kubeOperator: {}
+  olm:
+    dependsOn: [operator, unknown]
+    olm: {}
 `), "")
 		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "line 15: packages.olm.dependsOn: package unknown not found in spec"), err.Error())
+
+		_, err = ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+packages:
+  operator:
+    dependsOn: [olm]
+    kubeOperator: {}
+  olm:
+    dependsOn: [operator]
+    olm: {}
+`), "")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "line 16: packages.olm.dependsOn: dependency cycle olm -> operator -> olm"), err.Error())
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := ParseSpec([]byte(`apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+      function: [typo.libsonnet]
+`), "")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "line 11: field function not found"), err.Error())
+	})
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := ParseSpec([]byte(`apiVersion: v7
+name: "helloservice"
+`), "")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), `unsupported spec apiVersion "v7"`), err.Error())
+	})
+	t.Run("v1alpha1 is migrated", func(t *testing.T) {
+		s, err := ParseSpec([]byte(`version: v1
+name: "helloservice"
+authors: "team@example.com"
+template:
+  api:
+    proto:
+      entry: "Config"
+      message: "config.proto"
+  renderer:
+    jsonnet:
+      file: hellosvc.libsonnet
+`), "")
+		testutil.Ok(t, err)
+		testutil.Equals(t, SpecV1, s.APIVersion)
+		testutil.Equals(t, &proto.TemplateAPI{Message: "Config", File: "config.proto"}, s.Template.API.Proto)
+		testutil.Equals(t, []string{"hellosvc.libsonnet"}, s.Template.Renderer.Jsonnet.Functions)
 	})
 }
+
+func TestMigrateSpec(t *testing.T) {
+	b, err := MigrateSpec([]byte(`# Hello service spec.
+version: v1
+name: "helloservice" # Name is used for packages.
+authors: "team@example.com"
+
+template:
+  api:
+    # Our proto API.
+    proto:
+      entry: "Config"
+      message: "config.proto"
+  renderer:
+    jsonnet:
+      file: hellosvc.libsonnet
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, `# Hello service spec.
+apiVersion: v1
+name: "helloservice" # Name is used for packages.
+authors: "team@example.com"
+template:
+  api:
+    # Our proto API.
+    proto:
+      message: "Config"
+      file: "config.proto"
+  renderer:
+    jsonnet:
+      functions: [hellosvc.libsonnet]
+`, string(b))
+
+	// Current version is left as it is.
+	b2, err := MigrateSpec(b)
+	testutil.Ok(t, err)
+	testutil.Equals(t, string(b), string(b2))
+}
@@ -0,0 +1,199 @@
+package rndr
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SpecV1Alpha1 is the initial spec format. Specs without `apiVersion` are assumed to be in this version.
+	SpecV1Alpha1 = "v1alpha1"
+	// SpecV1 is the current spec format.
+	SpecV1 = "v1"
+)
+
+type specVersion struct {
+	version string
+	// migrate converts spec document of this version to the next version in place.
+	// Migrations work on YAML nodes, so comments are preserved.
+	migrate func(root *yaml.Node) error
+}
+
+// specVersions is a registry of all spec versions in order. The last one is current.
+// When changing spec format in incompatible way, add new version with migration from the previous one.
+var specVersions = []specVersion{
+	{version: SpecV1Alpha1, migrate: migrateV1Alpha1},
+	{version: SpecV1},
+}
+
+// CurrentSpecVersion returns version of the spec format this version of rndr uses.
+func CurrentSpecVersion() string {
+	return specVersions[len(specVersions)-1].version
+}
+
+// SpecAPIVersion returns apiVersion of given spec. Spec without apiVersion is assumed to be SpecV1Alpha1.
+func SpecAPIVersion(b []byte) (string, error) {
+	root, err := parseSpecNode(b)
+	if err != nil {
+		return "", err
+	}
+	return apiVersion(root)
+}
+
+// MigrateSpec rewrites spec of any supported version to the current version. Comments are kept, but formatting might change.
+func MigrateSpec(b []byte) ([]byte, error) {
+	root, err := parseSpecNode(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSpecNode(root); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(2)
+	if err := e.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseSpecNode(b []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(err, "parse spec")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("spec has to be a YAML object")
+	}
+	return &doc, nil
+}
+
+func apiVersion(doc *yaml.Node) (string, error) {
+	v := lookupNode(doc.Content[0], "apiVersion")
+	if v == nil {
+		return SpecV1Alpha1, nil
+	}
+	for _, sv := range specVersions {
+		if sv.version == v.Value {
+			return v.Value, nil
+		}
+	}
+	supported := make([]string, 0, len(specVersions))
+	for _, sv := range specVersions {
+		supported = append(supported, sv.version)
+	}
+	return "", errors.Errorf("line %d: unsupported spec apiVersion %q; supported: %s; newer rndr might be needed", v.Line, v.Value, strings.Join(supported, ", "))
+}
+
+// migrateSpecNode migrates spec document to the current version in place.
+func migrateSpecNode(doc *yaml.Node) error {
+	v, err := apiVersion(doc)
+	if err != nil {
+		return err
+	}
+
+	migrating := false
+	for _, sv := range specVersions {
+		if sv.version == v {
+			migrating = true
+		}
+		if !migrating || sv.migrate == nil {
+			continue
+		}
+		if err := sv.migrate(doc.Content[0]); err != nil {
+			return errors.Wrapf(err, "migrate spec from %v", sv.version)
+		}
+	}
+	setNode(doc.Content[0], "apiVersion", &yaml.Node{Kind: yaml.ScalarNode, Value: CurrentSpecVersion()})
+	return nil
+}
+
+// migrateV1Alpha1 migrates SpecV1Alpha1 to SpecV1:
+// * `version` is replaced by `apiVersion`.
+// * `template.api.proto.entry` is renamed to `message` and file previously put in `message` is moved to `file`.
+// * `template.renderer.jsonnet.file` is replaced by `functions` list.
+func migrateV1Alpha1(root *yaml.Node) error {
+	deleteNode(root, "version")
+
+	if proto := lookupNode(root, "template", "api", "proto"); proto != nil {
+		if lookupNode(proto, "entry") != nil {
+			if lookupNode(proto, "message") != nil {
+				renameNode(proto, "message", "file")
+			}
+			renameNode(proto, "entry", "message")
+		}
+	}
+	if jsonnet := lookupNode(root, "template", "renderer", "jsonnet"); jsonnet != nil {
+		if file := lookupNode(jsonnet, "file"); file != nil && file.Kind == yaml.ScalarNode {
+			renameNode(jsonnet, "file", "functions")
+			setNode(jsonnet, "functions", &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle, Content: []*yaml.Node{file}})
+		}
+	}
+	return nil
+}
+
+// lookupNode returns value under given keys path or nil if there is none.
+func lookupNode(n *yaml.Node, keys ...string) *yaml.Node {
+	for _, k := range keys {
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == k {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+// setNode sets value of the key. New keys are put first, taking over the head comment (e.g file header).
+func setNode(n *yaml.Node, key string, v *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = v
+			return
+		}
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+	if len(n.Content) > 0 {
+		k.HeadComment, n.Content[0].HeadComment = n.Content[0].HeadComment, ""
+	}
+	n.Content = append([]*yaml.Node{k, v}, n.Content...)
+}
+
+func renameNode(n *yaml.Node, from, to string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == from {
+			n.Content[i].Value = to
+		}
+	}
+}
+
+// deleteNode removes the key. Its head comment is kept with the next key.
+func deleteNode(n *yaml.Node, key string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			if c := n.Content[i].HeadComment; c != "" && i+2 < len(n.Content) {
+				next := n.Content[i+2]
+				next.HeadComment = strings.TrimSpace(c + "\n" + next.HeadComment)
+			}
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package rndr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultCacheDir returns directory rndr caches fetched sources in: `rndr` within user cache directory
+// (e.g `$XDG_CACHE_HOME/rndr`).
+func DefaultCacheDir() (string, error) {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "user cache dir")
+	}
+	return filepath.Join(d, "rndr"), nil
+}
+
+// Lock pins template references to exact content, so rendering is reproducible.
+type Lock struct {
+	// Digests maps template references (see TemplateRef.String) to digests they were resolved to: commit hash for git
+	// and manifest digest for OCI layout. Local paths are not pinned.
+	Digests map[string]string
+}
+
+// LockFile returns path of the lock file for given spec file e.g `hellosvc.rndr.lock.yaml` for `hellosvc.rndr.yaml`.
+func LockFile(specFile string) string {
+	return strings.TrimSuffix(specFile, filepath.Ext(specFile)) + ".lock.yaml"
+}
+
+const lockHeader = "# Generated by rndr; do not edit. Run 'rndr spec lock' to update pinned template references.\n"
+
+// ReadLock reads lock file. Missing lock file is the same as empty one.
+func ReadLock(file string) (*Lock, error) {
+	l := &Lock{Digests: map[string]string{}}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, l); err != nil {
+		return nil, errors.Wrapf(err, "parse lock file %v", file)
+	}
+	if l.Digests == nil {
+		l.Digests = map[string]string{}
+	}
+	return l, nil
+}
+
+// WriteLock writes lock file if its content changed. Empty lock is not written.
+func WriteLock(file string, l *Lock) error {
+	if len(l.Digests) == 0 {
+		return nil
+	}
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	b = append([]byte(lockHeader), b...)
+	if existing, err := ioutil.ReadFile(file); err == nil && bytes.Equal(existing, b) {
+		return nil
+	}
+	return ioutil.WriteFile(file, b, os.ModePerm)
+}
+
+// ResolveTemplate returns template of the spec, following template references (also of referenced specs).
+// Referenced sources are fetched into cacheDir. References pinned in lock are resolved to the locked digests, others are
+// resolved to the newest content and added to the lock. Pass empty lock to update all references.
+func ResolveTemplate(ctx context.Context, logger log.Logger, s Spec, cacheDir string, lock *Lock) (Template, error) {
+	if lock.Digests == nil {
+		lock.Digests = map[string]string{}
+	}
+
+	seen := map[string]bool{}
+	for s.Template == nil {
+		if s.TemplateRef == nil {
+			return Template{}, errors.New("template has to be specified, got none")
+		}
+		ref := *s.TemplateRef
+
+		specFile, err := fetchSpec(ctx, logger, ref, cacheDir, lock)
+		if err != nil {
+			return Template{}, errors.Wrapf(err, "resolve templateRef %v", ref)
+		}
+		if seen[specFile] {
+			return Template{}, errors.Errorf("templateRef %v references spec %v again, which makes a cycle", ref, specFile)
+		}
+		seen[specFile] = true
+
+		b, err := ioutil.ReadFile(specFile)
+		if err != nil {
+			return Template{}, errors.Wrapf(err, "read spec referenced by %v", ref)
+		}
+		if s, err = ParseSpec(b, filepath.Dir(specFile)); err != nil {
+			return Template{}, errors.Wrapf(err, "parse spec referenced by %v", ref)
+		}
+		level.Debug(logger).Log("msg", "resolved template reference", "ref", ref, "spec", specFile)
+	}
+	return *s.Template, nil
+}
+
+// fetchSpec makes referenced spec available on local filesystem and returns its absolute path.
+func fetchSpec(ctx context.Context, logger log.Logger, r TemplateRef, cacheDir string, lock *Lock) (_ string, err error) {
+	var root, rel, digest string
+	switch {
+	case r.Git != nil:
+		root, digest, err = fetchGit(ctx, logger, *r.Git, r.Dir, cacheDir, lock.Digests[r.String()])
+		rel = r.Git.Spec
+	case r.OCI != nil:
+		root, digest, err = fetchOCI(logger, *r.OCI, r.Dir, cacheDir, lock.Digests[r.String()])
+		rel = r.OCI.Spec
+	default:
+		return filepath.Abs(abs(r.Path, r.Dir))
+	}
+	if err != nil {
+		return "", err
+	}
+	lock.Digests[r.String()] = digest
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
+
+// fetchGit mirrors the repository into the cache and checks out the revision or the pinned commit. Unpinned revisions are
+// always fetched, pinned commits only if the mirror does not have them yet. It returns checkout directory and commit.
+func fetchGit(ctx context.Context, logger log.Logger, r GitTemplateRef, dir, cacheDir, pinned string) (string, string, error) {
+	repo := r.Repository
+	if isLocalRepository(repo) {
+		repo = abs(repo, dir)
+	}
+	sum := sha256.Sum256([]byte(repo))
+	mirror := filepath.Join(cacheDir, "git", "mirrors", hex.EncodeToString(sum[:]))
+
+	cloned := false
+	if _, err := os.Stat(mirror); os.IsNotExist(err) {
+		level.Debug(logger).Log("msg", "mirroring git repository", "repository", repo, "mirror", mirror)
+		if err := populate(mirror, func(tmp string) error {
+			_, err := runGit(ctx, "", "clone", "--quiet", "--mirror", repo, tmp)
+			return err
+		}); err != nil {
+			return "", "", err
+		}
+		cloned = true
+	} else if err != nil {
+		return "", "", err
+	}
+
+	rev := pinned
+	if rev == "" {
+		rev = r.Revision
+		if rev == "" {
+			rev = "HEAD"
+		}
+		if !cloned {
+			if err := fetchGitMirror(ctx, logger, repo, mirror); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	commit, err := runGit(ctx, mirror, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil && pinned != "" && !cloned {
+		// Pinned commit might be newer than our mirror.
+		if err := fetchGitMirror(ctx, logger, repo, mirror); err != nil {
+			return "", "", err
+		}
+		commit, err = runGit(ctx, mirror, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	}
+	if err != nil {
+		return "", "", errors.Wrapf(err, "revision %v not found in %v", rev, repo)
+	}
+
+	checkout := filepath.Join(cacheDir, "git", "checkouts", commit)
+	if err := populate(checkout, func(tmp string) error {
+		if _, err := runGit(ctx, "", "clone", "--quiet", "--shared", "--no-checkout", mirror, tmp); err != nil {
+			return err
+		}
+		_, err := runGit(ctx, tmp, "-c", "advice.detachedHead=false", "checkout", "--quiet", commit)
+		return err
+	}); err != nil {
+		return "", "", err
+	}
+	return checkout, commit, nil
+}
+
+func fetchGitMirror(ctx context.Context, logger log.Logger, repo, mirror string) error {
+	level.Debug(logger).Log("msg", "fetching git repository", "repository", repo, "mirror", mirror)
+	_, err := runGit(ctx, mirror, "fetch", "--quiet", "--prune")
+	return err
+}
+
+// isLocalRepository returns true if git repository is not a URL nor scp-like address (e.g `git@github.com:org/repo`).
+func isLocalRepository(repo string) bool {
+	if strings.Contains(repo, "://") {
+		return false
+	}
+	i := strings.Index(repo, ":")
+	return i <= 0 || strings.Contains(repo[:i], "/")
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "git %v; stderr: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+type ociDescriptor struct {
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// fetchOCI unpacks image layers from OCI layout into the cache. Image is chosen by the tag or the pinned manifest digest.
+// It returns directory with unpacked image and manifest digest.
+func fetchOCI(logger log.Logger, r OCITemplateRef, dir, cacheDir, pinned string) (string, string, error) {
+	layout := abs(r.Layout, dir)
+
+	digest := pinned
+	if digest == "" {
+		b, err := ioutil.ReadFile(filepath.Join(layout, "index.json"))
+		if err != nil {
+			return "", "", errors.Wrap(err, "read OCI layout index")
+		}
+		index := struct {
+			Manifests []ociDescriptor `json:"manifests"`
+		}{}
+		if err := json.Unmarshal(b, &index); err != nil {
+			return "", "", errors.Wrap(err, "parse OCI layout index")
+		}
+		var matched []string
+		for _, m := range index.Manifests {
+			if r.Tag == "" || m.Annotations[ociRefNameAnnotation] == r.Tag {
+				matched = append(matched, m.Digest)
+			}
+		}
+		if len(matched) != 1 {
+			return "", "", errors.Errorf("expected exactly one manifest tagged %q in OCI layout %v, got %d", r.Tag, layout, len(matched))
+		}
+		digest = matched[0]
+	}
+
+	b, err := readBlob(layout, digest)
+	if err != nil {
+		return "", "", errors.Wrap(err, "read manifest")
+	}
+	manifest := struct {
+		Layers []ociDescriptor `json:"layers"`
+	}{}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return "", "", errors.Wrapf(err, "parse manifest %v", digest)
+	}
+	if len(manifest.Layers) == 0 {
+		return "", "", errors.Errorf("manifest %v has no layers; image indexes are not supported", digest)
+	}
+
+	root := filepath.Join(cacheDir, "oci", strings.Replace(digest, ":", "-", 1))
+	if err := populate(root, func(tmp string) error {
+		level.Debug(logger).Log("msg", "unpacking OCI image", "layout", layout, "manifest", digest, "dir", root)
+		for _, l := range manifest.Layers {
+			b, err := readBlob(layout, l.Digest)
+			if err != nil {
+				return errors.Wrap(err, "read layer")
+			}
+			if err := untar(b, tmp); err != nil {
+				return errors.Wrapf(err, "unpack layer %v", l.Digest)
+			}
+		}
+		return nil
+	}); err != nil {
+		return "", "", err
+	}
+	return root, digest, nil
+}
+
+// readBlob reads blob from OCI layout and verifies its digest. Only sha256 digests are supported.
+func readBlob(layout, digest string) ([]byte, error) {
+	h := strings.TrimPrefix(digest, "sha256:")
+	if _, err := hex.DecodeString(h); err != nil || len(h) != 2*sha256.Size {
+		return nil, errors.Errorf("unsupported digest %q", digest)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(layout, "blobs", "sha256", h))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != h {
+		return nil, errors.Errorf("blob %v does not match its digest", digest)
+	}
+	return b, nil
+}
+
+// untar extracts (optionally gzipped) tar layer into dir. Whiteout files remove files of previous layers.
+// Only directories and regular files are extracted, since templates do not need anything else.
+func untar(b []byte, dir string) error {
+	var r io.Reader = bytes.NewReader(b)
+	if len(b) > 1 && b[0] == 0x1f && b[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(h.Name))
+		if filepath.IsAbs(name) || outsideDir(name) {
+			return errors.Errorf("path %v points outside of the image", h.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		if base := filepath.Base(name); strings.HasPrefix(base, ".wh.") {
+			if err := os.RemoveAll(filepath.Join(filepath.Dir(target), strings.TrimPrefix(base, ".wh."))); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				_ = f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// populate creates cache directory using fill, unless it already exists. Directory is filled in a temporary place first,
+// so partially filled directory is never used.
+func populate(dir string, fill func(tmp string) error) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := fill(tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.RemoveAll(tmp)
+		if _, serr := os.Stat(dir); serr == nil {
+			// Filled concurrently by someone else.
+			return nil
+		}
+		return err
+	}
+	return nil
+}
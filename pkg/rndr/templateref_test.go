@@ -0,0 +1,179 @@
+package rndr
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+	"github.com/observatorium/rndr/pkg/rndr/engines/jsonnet"
+)
+
+const referencedSpec = `apiVersion: v1
+name: "helloservice"
+authors: "team@example.com"
+
+template:
+  api:
+    go:
+      struct: "github.com/observatorium/rndr/examples/hellosvc/api.HelloService"
+  renderer:
+    jsonnet:
+      functions: [%s]
+`
+
+func parseTestSpec(t *testing.T, ref, dir string) Spec {
+	t.Helper()
+
+	s, err := ParseSpec([]byte(`apiVersion: v1
+name: "consumer"
+authors: "consumer@example.com"
+templateRef:
+`+ref), dir)
+	testutil.Ok(t, err)
+	return s
+}
+
+func TestResolveTemplate(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	t.Run("path", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rndr-ref")
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+		testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "tmpl"), os.ModePerm))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "tmpl", "spec.yaml"), []byte(fmt.Sprintf(referencedSpec, "hellosvc.libsonnet")), os.ModePerm))
+
+		lock := &Lock{}
+		tmpl, err := ResolveTemplate(ctx, logger, parseTestSpec(t, "  path: tmpl/spec.yaml\n", dir), filepath.Join(dir, "cache"), lock)
+		testutil.Ok(t, err)
+		testutil.Equals(t, &jsonnet.TemplateRenderer{Functions: []string{filepath.Join(dir, "tmpl", "hellosvc.libsonnet")}}, tmpl.Renderer.Jsonnet)
+		testutil.Equals(t, 0, len(lock.Digests))
+	})
+	t.Run("cycle", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rndr-ref")
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "spec.yaml"), []byte(`apiVersion: v1
+name: "loop"
+authors: "team@example.com"
+templateRef:
+  path: spec.yaml
+`), os.ModePerm))
+		_, err = ResolveTemplate(ctx, logger, parseTestSpec(t, "  path: spec.yaml\n", dir), filepath.Join(dir, "cache"), &Lock{})
+		testutil.NotOk(t, err)
+	})
+	t.Run("git", func(t *testing.T) {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git not installed")
+		}
+		dir, err := ioutil.TempDir("", "rndr-ref")
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+		repo := filepath.Join(dir, "repo")
+		testutil.Ok(t, os.MkdirAll(filepath.Join(repo, "tmpl"), os.ModePerm))
+		commit := func(fn string) string {
+			testutil.Ok(t, ioutil.WriteFile(filepath.Join(repo, "tmpl", "spec.yaml"), []byte(fmt.Sprintf(referencedSpec, fn)), os.ModePerm))
+			for _, args := range [][]string{
+				{"add", "-A"},
+				{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", fn},
+			} {
+				_, err := runGit(ctx, repo, args...)
+				testutil.Ok(t, err)
+			}
+			c, err := runGit(ctx, repo, "rev-parse", "HEAD")
+			testutil.Ok(t, err)
+			return c
+		}
+		_, err = runGit(ctx, repo, "init", "--quiet")
+		testutil.Ok(t, err)
+		first := commit("v1.libsonnet")
+
+		s := parseTestSpec(t, "  git:\n    repository: repo\n    spec: tmpl/spec.yaml\n", dir)
+		cache := filepath.Join(dir, "cache")
+		lock := &Lock{}
+		tmpl, err := ResolveTemplate(ctx, logger, s, cache, lock)
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"git:repo@HEAD:tmpl/spec.yaml": first}, lock.Digests)
+		testutil.Equals(t, filepath.Join(cache, "git", "checkouts", first, "tmpl", "v1.libsonnet"), tmpl.Renderer.Jsonnet.Functions[0])
+
+		second := commit("v2.libsonnet")
+
+		// Locked reference stays on the pinned commit.
+		tmpl, err = ResolveTemplate(ctx, logger, s, cache, lock)
+		testutil.Ok(t, err)
+		testutil.Equals(t, "v1.libsonnet", filepath.Base(tmpl.Renderer.Jsonnet.Functions[0]))
+
+		// Empty lock resolves the newest commit.
+		lock = &Lock{}
+		tmpl, err = ResolveTemplate(ctx, logger, s, cache, lock)
+		testutil.Ok(t, err)
+		testutil.Equals(t, "v2.libsonnet", filepath.Base(tmpl.Renderer.Jsonnet.Functions[0]))
+		testutil.Equals(t, map[string]string{"git:repo@HEAD:tmpl/spec.yaml": second}, lock.Digests)
+
+		lockFile := LockFile(filepath.Join(dir, "consumer.rndr.yaml"))
+		testutil.Equals(t, filepath.Join(dir, "consumer.rndr.lock.yaml"), lockFile)
+		testutil.Ok(t, WriteLock(lockFile, lock))
+		read, err := ReadLock(lockFile)
+		testutil.Ok(t, err)
+		testutil.Equals(t, lock, read)
+	})
+	t.Run("oci", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "rndr-ref")
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+		layout := filepath.Join(dir, "layout")
+		testutil.Ok(t, os.MkdirAll(filepath.Join(layout, "blobs", "sha256"), os.ModePerm))
+		blob := func(b []byte) string {
+			sum := sha256.Sum256(b)
+			testutil.Ok(t, ioutil.WriteFile(filepath.Join(layout, "blobs", "sha256", hex.EncodeToString(sum[:])), b, os.ModePerm))
+			return "sha256:" + hex.EncodeToString(sum[:])
+		}
+		layer := func(files map[string]string) string {
+			buf := bytes.Buffer{}
+			tw := tar.NewWriter(&buf)
+			for name, content := range files {
+				testutil.Ok(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+				_, err := tw.Write([]byte(content))
+				testutil.Ok(t, err)
+			}
+			testutil.Ok(t, tw.Close())
+			return blob(buf.Bytes())
+		}
+		manifest := blob([]byte(fmt.Sprintf(`{"schemaVersion":2,"layers":[{"digest":%q},{"digest":%q}]}`,
+			layer(map[string]string{"tmpl/spec.yaml": fmt.Sprintf(referencedSpec, "v1.libsonnet"), "tmpl/old.libsonnet": ""}),
+			layer(map[string]string{"tmpl/.wh.old.libsonnet": ""}),
+		)))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(layout, "index.json"), []byte(fmt.Sprintf(
+			`{"schemaVersion":2,"manifests":[{"digest":%q,"annotations":{"org.opencontainers.image.ref.name":"v1"}}]}`, manifest,
+		)), os.ModePerm))
+
+		cache := filepath.Join(dir, "cache")
+		lock := &Lock{}
+		tmpl, err := ResolveTemplate(ctx, logger, parseTestSpec(t, "  oci:\n    layout: layout\n    tag: v1\n    spec: tmpl/spec.yaml\n", dir), cache, lock)
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"oci:layout@v1:tmpl/spec.yaml": manifest}, lock.Digests)
+
+		unpacked := filepath.Join(cache, "oci", "sha256-"+manifest[len("sha256:"):], "tmpl")
+		testutil.Equals(t, filepath.Join(unpacked, "v1.libsonnet"), tmpl.Renderer.Jsonnet.Functions[0])
+		_, err = os.Stat(filepath.Join(unpacked, "old.libsonnet"))
+		testutil.Assert(t, os.IsNotExist(err), "whiteout should remove file from previous layer")
+
+		_, err = ResolveTemplate(ctx, logger, parseTestSpec(t, "  oci:\n    layout: layout\n    tag: v2\n    spec: tmpl/spec.yaml\n", dir), cache, &Lock{})
+		testutil.NotOk(t, err)
+	})
+}
@@ -0,0 +1,116 @@
+// Package watch calls function whenever watched local files change.
+package watch
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/efficientgo/tools/core/pkg/errcapture"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Watch calls fn whenever any of files changes, until ctx is cancelled. Changes are debounced, so burst of events (e.g
+// editor writing temporary file and renaming it over the original) results in single call once no event came for the
+// debounce duration. Files are listed again after each call, so e.g newly imported files are watched too. If listing
+// fails, previous files stay watched.
+//
+// Parent directories of files are watched instead of files themselves, so files replaced by rename are still tracked.
+func Watch(ctx context.Context, logger log.Logger, debounce time.Duration, files func() ([]string, error), fn func(ctx context.Context)) (err error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create watcher")
+	}
+	defer errcapture.Do(&err, w.Close, "close watcher")
+
+	s := &state{w: w, logger: logger, files: map[string]struct{}{}, dirs: map[string]struct{}{}}
+	if err := s.update(files); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(debounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case e, ok := <-w.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			if e.Op == fsnotify.Chmod {
+				continue
+			}
+			if _, ok := s.files[filepath.Clean(e.Name)]; !ok {
+				continue
+			}
+			level.Debug(logger).Log("msg", "file changed", "file", e.Name, "op", e.Op.String())
+			timer.Stop()
+			select {
+			case <-timer.C:
+			default:
+			}
+			timer.Reset(debounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			level.Warn(logger).Log("msg", "watch error", "err", err)
+		case <-timer.C:
+			fn(ctx)
+			if err := s.update(files); err != nil {
+				level.Warn(logger).Log("msg", "failed to list watched files; watching previous ones", "err", err)
+			}
+		}
+	}
+}
+
+type state struct {
+	w      *fsnotify.Watcher
+	logger log.Logger
+
+	files map[string]struct{}
+	dirs  map[string]struct{}
+}
+
+func (s *state) update(files func() ([]string, error)) error {
+	list, err := files()
+	if err != nil {
+		return err
+	}
+
+	newFiles := make(map[string]struct{}, len(list))
+	newDirs := map[string]struct{}{}
+	for _, f := range list {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		newFiles[abs] = struct{}{}
+		newDirs[filepath.Dir(abs)] = struct{}{}
+	}
+	for d := range newDirs {
+		if _, ok := s.dirs[d]; ok {
+			continue
+		}
+		if err := s.w.Add(d); err != nil {
+			return errors.Wrapf(err, "watch %v", d)
+		}
+	}
+	for d := range s.dirs {
+		if _, ok := newDirs[d]; ok {
+			continue
+		}
+		// Removed directories are not watched anymore already.
+		_ = s.w.Remove(d)
+	}
+	s.files, s.dirs = newFiles, newDirs
+	level.Debug(s.logger).Log("msg", "watching files", "files", len(s.files), "dirs", len(s.dirs))
+	return nil
+}
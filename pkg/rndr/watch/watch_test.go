@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/tools/core/pkg/testutil"
+	"github.com/go-kit/kit/log"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rndr-watch")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+
+	write := func(file, content string) {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), os.ModePerm))
+	}
+	write("main.jsonnet", "import 'lib.libsonnet'")
+	write("lib.libsonnet", "{}")
+	write("other.libsonnet", "{}")
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "nested"), os.ModePerm))
+
+	var (
+		mu      sync.Mutex
+		watched = []string{filepath.Join(dir, "main.jsonnet"), filepath.Join(dir, "lib.libsonnet")}
+	)
+	files := func() ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, watched...), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, log.NewNopLogger(), 100*time.Millisecond, files, func(context.Context) { calls <- struct{}{} })
+	}()
+	// Give watcher time to start.
+	time.Sleep(100 * time.Millisecond)
+
+	expectCalls := func(n int) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for i := 0; i < n; i++ {
+			select {
+			case <-calls:
+			case <-timeout:
+				t.Fatalf("expected %d calls, got %d", n, i)
+			}
+		}
+		select {
+		case <-calls:
+			t.Fatalf("expected %d calls, got more", n)
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+
+	// Burst of changes is debounced.
+	write("main.jsonnet", "import 'lib.libsonnet' + {}")
+	write("lib.libsonnet", "{a: 1}")
+	write("main.jsonnet", "import 'lib.libsonnet' + {b: 2}")
+	expectCalls(1)
+
+	// Unwatched file.
+	write("other.libsonnet", "{a: 1}")
+	expectCalls(0)
+
+	// Files are listed again after change.
+	mu.Lock()
+	watched = append(watched, filepath.Join(dir, "other.libsonnet"), filepath.Join(dir, "nested", "new.libsonnet"))
+	mu.Unlock()
+	write("main.jsonnet", "import 'other.libsonnet'")
+	expectCalls(1)
+	write("nested/new.libsonnet", "{}")
+	expectCalls(1)
+
+	// File replaced by rename.
+	write("tmp", "{a: 2}")
+	testutil.Ok(t, os.Rename(filepath.Join(dir, "tmp"), filepath.Join(dir, "other.libsonnet")))
+	expectCalls(1)
+
+	cancel()
+	testutil.Ok(t, <-done)
+}